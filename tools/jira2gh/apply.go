@@ -0,0 +1,176 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"jira2gh/pkg/config"
+	"jira2gh/pkg/github"
+	"jira2gh/pkg/jira"
+	"maps"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+var applyCmd = &cobra.Command{
+	Use:   "apply <plan-file>",
+	Short: "Apply a plan saved by jira2gh plan",
+	Long: `Adds, removes and updates exactly what the plan lists, without prompting.
+Nothing is applied if any project changed since the plan was made: PRs to add
+that are already in it, or items to remove or update that are gone or whose
+field values differ from the ones recorded in the plan.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		ctx := context.Background()
+		config.Quiet, _ = cmd.Flags().GetBool("quiet")
+		github.DryRun, _ = cmd.Flags().GetBool("dry-run")
+
+		replaying, err := configureBackend(cmd)
+		if err == nil {
+			err = apply(ctx, args[0], replaying)
+		}
+		if err != nil {
+			config.Stderr("Error: %v\n", err)
+			os.Exit(StatusCodeError)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(applyCmd)
+}
+
+// apply checks that the projects of a plan file are still in the state the
+// plans were made from, then applies them.
+func apply(ctx context.Context, path string, replaying bool) error {
+	github.Token = os.Getenv("GITHUB_TOKEN")
+	if replaying {
+		github.Token = cmp.Or(github.Token, replayToken)
+	}
+	if len(github.Token) == 0 {
+		return fmt.Errorf("GITHUB_TOKEN environment variable is not set")
+	}
+
+	plans, err := readPlans(path)
+	if err != nil {
+		return err
+	}
+
+	// Check every project before changing any of them
+	projs := make([]*config.ProjectConfig, len(plans))
+	for i, plan := range plans {
+		projs[i] = &config.ProjectConfig{GitHubOwner: plan.Owner, GitHubProject: plan.Project}
+		config.Printf("Checking project %s/%s...\n", plan.Owner, plan.Project)
+		if err := checkPlan(ctx, projs[i], plan); err != nil {
+			return err
+		}
+	}
+
+	for i, plan := range plans {
+		if err := applyPlan(ctx, projs[i], plan); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkPlan returns an error listing what changed in the project since the
+// plan was made, if anything did.
+func checkPlan(ctx context.Context, proj *config.ProjectConfig, plan projectPlan) error {
+	items, err := github.FetchGitHubPRs(ctx, proj)
+	if err != nil {
+		return err
+	}
+	if plan.ProjectID != "" && plan.ProjectID != proj.GitHubProjectID {
+		return fmt.Errorf("project %s/%s is not the one the plan was made for", plan.Owner, plan.Project)
+	}
+
+	var changed []string
+	for _, pr := range plan.Add {
+		if _, found := items[pr.URL]; found {
+			changed = append(changed, fmt.Sprintf("%s was added to the project", github.FormatPRShort(pr.URL)))
+		}
+	}
+	for _, pr := range plan.Remove {
+		item, found := items[pr.URL]
+		switch {
+		case !found || item.ItemID != pr.ItemID:
+			changed = append(changed, fmt.Sprintf("%s was removed from the project", github.FormatPRShort(pr.URL)))
+		case !maps.Equal(item.Fields, pr.Fields):
+			changed = append(changed, fmt.Sprintf("fields of %s were changed", github.FormatPRShort(pr.URL)))
+		}
+	}
+	for _, c := range plan.Updates {
+		item, found := items[c.URL]
+		switch {
+		case !found || item.ItemID != c.ItemID:
+			changed = append(changed, fmt.Sprintf("%s was removed from the project", github.FormatPRShort(c.URL)))
+		case item.Fields[c.Field] != c.Old:
+			changed = append(changed, fmt.Sprintf("%s: %s is %q instead of %q",
+				github.FormatPRShort(c.URL), c.Field, item.Fields[c.Field], c.Old))
+		}
+	}
+
+	if len(changed) > 0 {
+		return fmt.Errorf("project %s/%s changed since the plan was made, please create a new plan:\n  %s",
+			plan.Owner, plan.Project, strings.Join(changed, "\n  "))
+	}
+	return nil
+}
+
+// applyPlan makes the changes of a checked plan.
+func applyPlan(ctx context.Context, proj *config.ProjectConfig, plan projectPlan) error {
+	if plan.empty() {
+		config.Printf("\nNo changes to apply to project %s/%s.\n", plan.Owner, plan.Project)
+		return nil
+	}
+
+	if len(plan.Updates) > 0 {
+		config.Printf("\nUpdating project fields of %s/%s...\n", plan.Owner, plan.Project)
+		suffix := ""
+		if github.DryRun {
+			suffix = " (dry-run)"
+		}
+		updates := make([]github.FieldUpdate, 0, len(plan.Updates))
+		for _, c := range plan.Updates {
+			updates = append(updates, github.FieldUpdate{ItemID: c.ItemID, Field: c.Field, Value: c.New})
+			config.Printf("  ✓ %s: %s: %s → %s%s\n", github.FormatPRShort(c.URL), c.Field, cmp.Or(c.Old, "none"), cmp.Or(c.New, "none"), suffix)
+		}
+		if _, err := github.UpdateItemFields(ctx, proj, updates); err != nil {
+			return fmt.Errorf("failed to update project fields: %w", err)
+		}
+	}
+
+	if len(plan.Add) > 0 {
+		prs := make([]jira.PR, len(plan.Add))
+		for i, planned := range plan.Add {
+			prs[i] = jira.PR{
+				URL:           planned.URL,
+				Title:         planned.Title,
+				Author:        planned.Author,
+				State:         planned.State,
+				PlannedFields: planned.Fields,
+			}
+			if prs[i].PlannedFields == nil {
+				prs[i].PlannedFields = map[string]string{}
+			}
+		}
+		if err := github.AddToProject(ctx, proj, prs); err != nil {
+			return err
+		}
+	}
+
+	if len(plan.Remove) > 0 {
+		prs := make([]jira.PR, len(plan.Remove))
+		for i, planned := range plan.Remove {
+			prs[i] = jira.PR{URL: planned.URL, ItemID: planned.ItemID}
+		}
+		if err := github.RemoveFromProject(ctx, proj, prs); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
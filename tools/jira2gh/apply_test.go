@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"jira2gh/pkg/config"
+	"jira2gh/pkg/github"
+	"jira2gh/pkg/httpclient"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestApplyRefusesChangedProject applies the plan saved with the recorded
+// sync after changing it the way the project could have changed since, and
+// checks that nothing is written unless the plan still holds.
+func TestApplyRefusesChangedProject(t *testing.T) {
+	dir := filepath.Join("testdata", "replay", "sync")
+	t.Cleanup(func() {
+		httpclient.SetBackend(httpclient.Network{})
+		config.Quiet = false
+		github.ResetCache()
+	})
+	t.Setenv("GITHUB_TOKEN", "")
+	config.Quiet = true
+
+	tests := []struct {
+		name string
+		// change turns the saved plan into one made before the project
+		// changed
+		change  func(plan *projectPlan)
+		wantErr string
+	}{
+		{
+			name:   "unchanged",
+			change: func(plan *projectPlan) {},
+		},
+		{
+			name: "PR to add already in the project",
+			change: func(plan *projectPlan) {
+				plan.Add[0].URL = "https://github.com/example/repo/pull/1"
+			},
+			wantErr: "example/repo#1 was added to the project",
+		},
+		{
+			name: "item to remove gone",
+			change: func(plan *projectPlan) {
+				plan.Remove[0].ItemID = "PVTI_9"
+			},
+			wantErr: "example/repo#3 was removed from the project",
+		},
+		{
+			name: "old field value changed",
+			change: func(plan *projectPlan) {
+				plan.Updates[0].Old = "Backlog"
+			},
+			wantErr: `example/repo#1: Jira Status is "New" instead of "Backlog"`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			plans, err := readPlans(filepath.Join(dir, "plan.json"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			tt.change(&plans[0])
+			path := filepath.Join(t.TempDir(), "plan.json")
+			f, err := os.Create(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := writePlans(f, "json", plans); err != nil {
+				t.Fatal(err)
+			}
+			if err := f.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			replayer, err := httpclient.NewReplayer(dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			backend := &replayWithWrites{replayer: replayer}
+			httpclient.SetBackend(backend)
+			github.ResetCache()
+
+			err = apply(context.Background(), path, true)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatal(err)
+				}
+				if len(backend.writes) == 0 {
+					t.Error("unchanged plan was not applied")
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("got error %v, want it to contain %q", err, tt.wantErr)
+			}
+			if len(backend.writes) > 0 {
+				t.Errorf("changed plan was applied: %v", backend.writes)
+			}
+		})
+	}
+}
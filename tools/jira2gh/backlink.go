@@ -0,0 +1,176 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"jira2gh/pkg/config"
+	"jira2gh/pkg/github"
+	"jira2gh/pkg/jira"
+	"jira2gh/pkg/provider"
+	"maps"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+// jiraKeyRE matches Jira issue keys such as OCPBUGS-123.
+var jiraKeyRE = regexp.MustCompile(`\b[A-Z][A-Z0-9]+-[0-9]+\b`)
+
+// missingLink is a PR that mentions a tracked issue the issue does not link to.
+type missingLink struct {
+	issue string
+	url   string
+	title string
+}
+
+var backlinkCmd = &cobra.Command{
+	Use:   "backlink [<issue-id>...]",
+	Short: "Add missing Jira remote links for PRs that mention tracked issues",
+	Long: `Searches the repositories of the GitHub project for PRs whose title mentions a
+Jira issue tracked by the project (e.g. "OCPBUGS-123: fix foo"), and adds a
+remote link to the issue for every such PR it does not link to yet.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		ctx := context.Background()
+		cfg := loadConfig(ctx, cmd, args)
+		yes, _ := cmd.Flags().GetBool("yes")
+
+		for i, proj := range cfg.Projects {
+			if i > 0 {
+				config.Println("")
+			}
+			if err := runBacklink(ctx, cfg.Jira, proj, yes); err != nil {
+				config.Stderr("Error: %v\n", err)
+				os.Exit(StatusCodeError)
+			}
+		}
+	},
+}
+
+func init() {
+	backlinkCmd.Flags().BoolP("yes", "y", false, "Create the remote links without asking for confirmation")
+	rootCmd.AddCommand(backlinkCmd)
+}
+
+func runBacklink(ctx context.Context, jiraCfg *config.JiraConfig, proj *config.ProjectConfig, yes bool) error {
+	config.Println("Collecting tracked Jira issues...")
+	tracked := map[string]bool{}
+	for _, id := range proj.Jiras {
+		keys, err := jira.TrackedIssues(ctx, jiraCfg, proj, id)
+		if err != nil {
+			return err
+		}
+		for _, key := range keys {
+			tracked[key] = true
+		}
+	}
+	config.Printf("✓ Found %d tracked issues\n", len(tracked))
+
+	config.Printf("\nFetching repositories from GitHub Project %s/%s...\n", proj.GitHubOwner, proj.GitHubProject)
+	githubPRs, err := github.FetchGitHubPRs(ctx, proj)
+	if err != nil {
+		return err
+	}
+	repoSet := map[string]bool{}
+	for url := range githubPRs {
+		if ref, ok := provider.Parse(url); ok && ref.Kind == provider.GitHub && !slices.Contains(proj.IgnoreRepos, ref.Repo) {
+			repoSet[ref.Repo] = true
+		}
+	}
+	repos := slices.Sorted(maps.Keys(repoSet))
+	config.Printf("✓ Found %d repositories\n", len(repos))
+
+	if len(tracked) == 0 || len(repos) == 0 {
+		config.Println("\nNothing to search, skipping.")
+		return nil
+	}
+
+	config.Println("\nSearching PRs that mention tracked issues...")
+	found, err := github.SearchPRsByTitle(ctx, repos, slices.Sorted(maps.Keys(tracked)))
+	if err != nil {
+		return err
+	}
+
+	missing, err := missingLinks(ctx, jiraCfg, proj, tracked, found)
+	if err != nil {
+		return err
+	}
+	if len(missing) == 0 {
+		config.Println("\nNo missing remote links.")
+		return nil
+	}
+
+	linkWord := "links"
+	if len(missing) == 1 {
+		linkWord = "link"
+	}
+	config.Printf("\n%d missing remote %s:\n", len(missing), linkWord)
+	for _, m := range missing {
+		config.Printf("  %-20s ← %s  %s\n", m.issue, github.FormatPRShort(m.url), m.title)
+	}
+
+	if config.Quiet && !yes {
+		os.Exit(StatusCodeNewPRsFound)
+	}
+
+	if !yes {
+		ok, err := confirm(fmt.Sprintf("\nCreate %d remote %s in Jira?", len(missing), linkWord))
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return nil
+		}
+	}
+
+	config.Println("\nCreating remote links...")
+	for _, m := range missing {
+		if github.DryRun {
+			config.Printf("  ✓ %s ← %s (dry-run)\n", m.issue, github.FormatPRShort(m.url))
+			continue
+		}
+		if err := jira.AddRemoteLink(ctx, jiraCfg, m.issue, m.url, m.title); err != nil {
+			return err
+		}
+		config.Printf("  ✓ %s ← %s\n", m.issue, github.FormatPRShort(m.url))
+	}
+
+	return nil
+}
+
+// missingLinks returns the links from tracked issues to the found PRs that
+// mention them which the issues do not have yet, sorted by issue. The remote
+// links of every issue are fetched once.
+func missingLinks(ctx context.Context, jiraCfg *config.JiraConfig, proj *config.ProjectConfig, tracked map[string]bool, found []github.FoundPR) ([]missingLink, error) {
+	existing := map[string][]string{}
+	var missing []missingLink
+	for _, pr := range found {
+		if shouldIgnorePR(pr.URL, proj) {
+			continue
+		}
+		for _, key := range jiraKeyRE.FindAllString(pr.Title, -1) {
+			if !tracked[key] {
+				continue
+			}
+			if _, fetched := existing[key]; !fetched {
+				urls, err := jira.RemoteLinkURLs(ctx, jiraCfg, key)
+				if err != nil {
+					return nil, err
+				}
+				existing[key] = urls
+			}
+			if !slices.Contains(existing[key], pr.URL) {
+				missing = append(missing, missingLink{issue: key, url: pr.URL, title: pr.Title})
+				// Titles may mention the key more than once
+				existing[key] = append(existing[key], pr.URL)
+			}
+		}
+	}
+
+	slices.SortFunc(missing, func(a, b missingLink) int {
+		return strings.Compare(a.issue+" "+a.url, b.issue+" "+b.url)
+	})
+	return missing, nil
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"fmt"
+	"jira2gh/pkg/config"
+	"jira2gh/pkg/github"
+	"jira2gh/pkg/httpclient"
+	"jira2gh/pkg/jira"
+	"net/http"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// fakeRemoteLinks answers Jira remote link requests with the links of the
+// issue, without any network.
+type fakeRemoteLinks struct {
+	links    map[string][]string
+	requests []string
+}
+
+func (f *fakeRemoteLinks) Send(req *http.Request) (*httpclient.Response, error) {
+	f.requests = append(f.requests, req.URL.Path)
+	key, found := strings.CutSuffix(strings.TrimPrefix(req.URL.Path, "/rest/api/2/issue/"), "/remotelink")
+	if !found {
+		return &httpclient.Response{StatusCode: http.StatusNotFound, Header: http.Header{}}, nil
+	}
+	var objects []string
+	for _, url := range f.links[key] {
+		objects = append(objects, fmt.Sprintf(`{"object": {"url": %q}}`, url))
+	}
+	body := "[" + strings.Join(objects, ", ") + "]"
+	return &httpclient.Response{StatusCode: http.StatusOK, Header: http.Header{}, Body: []byte(body)}, nil
+}
+
+func TestMissingLinks(t *testing.T) {
+	fake := &fakeRemoteLinks{links: map[string][]string{
+		"PROJ-1": {"https://github.com/o/r/pull/1"},
+		"PROJ-2": {"https://github.com/o/r/pull/9"},
+	}}
+	httpclient.SetBackend(fake)
+	t.Cleanup(func() {
+		httpclient.SetBackend(httpclient.Network{})
+		jira.ResetCache()
+	})
+	jira.ResetCache()
+
+	jiraCfg := &config.JiraConfig{Host: "https://jira.example.com"}
+	proj := &config.ProjectConfig{IgnorePRs: []string{"o/r#4"}}
+	tracked := map[string]bool{"PROJ-1": true, "PROJ-2": true}
+	found := []github.FoundPR{
+		{URL: "https://github.com/o/r/pull/1", Title: "PROJ-1: already linked"},
+		{URL: "https://github.com/o/r/pull/2", Title: "PROJ-2, PROJ-1: fix both"},
+		{URL: "https://github.com/o/r/pull/3", Title: "OTHER-1: not tracked"},
+		{URL: "https://github.com/o/r/pull/4", Title: "PROJ-1: ignored"},
+		{URL: "https://github.com/o/r/pull/5", Title: "PROJ-2: not linked yet"},
+		{URL: "https://github.com/o/r/pull/6", Title: "PROJ-1: fix foo (PROJ-1 follow-up)"},
+	}
+
+	missing, err := missingLinks(t.Context(), jiraCfg, proj, tracked, found)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []missingLink{
+		{issue: "PROJ-1", url: "https://github.com/o/r/pull/2", title: "PROJ-2, PROJ-1: fix both"},
+		{issue: "PROJ-1", url: "https://github.com/o/r/pull/6", title: "PROJ-1: fix foo (PROJ-1 follow-up)"},
+		{issue: "PROJ-2", url: "https://github.com/o/r/pull/2", title: "PROJ-2, PROJ-1: fix both"},
+		{issue: "PROJ-2", url: "https://github.com/o/r/pull/5", title: "PROJ-2: not linked yet"},
+	}
+	if !slices.Equal(missing, want) {
+		t.Errorf("got missing links %v, want %v", missing, want)
+	}
+
+	// the links of every issue are fetched once
+	wantRequests := []string{"/rest/api/2/issue/PROJ-1/remotelink", "/rest/api/2/issue/PROJ-2/remotelink"}
+	if !slices.Equal(fake.requests, wantRequests) {
+		t.Errorf("got requests %v, want %v", fake.requests, wantRequests)
+	}
+}
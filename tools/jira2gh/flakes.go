@@ -0,0 +1,126 @@
+package main
+
+import (
+	"cmp"
+	"fmt"
+	"jira2gh/pkg/config"
+	"jira2gh/pkg/github"
+	"jira2gh/pkg/history"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// jobHistory keeps the job results of PRs across syncs. It is nil when
+// replaying a recording.
+var jobHistory *history.History
+
+// saveJobHistory writes the job results seen so far to the history file. Only
+// syncs that apply their changes save it, so that previews such as plan,
+// --output and --dry-run runs do not count towards the flakiness of jobs.
+func saveJobHistory() {
+	if jobHistory == nil || github.DryRun {
+		return
+	}
+	if err := jobHistory.Save(); err != nil {
+		config.Printf("  Warning: %v\n", err)
+	}
+}
+
+// historyPath returns the job history file given with --history, or the
+// default one.
+func historyPath(cmd *cobra.Command) string {
+	if path, _ := cmd.Flags().GetString("history"); path != "" {
+		return path
+	}
+	home, _ := os.UserHomeDir()
+	return filepath.Join(home, ".local/state/jira2gh/history.json")
+}
+
+var flakesCmd = &cobra.Command{
+	Use:   "flakes",
+	Short: "Report the jobs that flipped between passing and failing on the same commit",
+	Long: `Reads the job history kept by previous syncs and lists, for each job, the
+PRs on which it both passed and failed without the commit changing. Such jobs
+are flagged as flaky in the job summary as well. Only the history is read, no
+request is made.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		h, err := history.Load(historyPath(cmd))
+		if err != nil {
+			config.Stderr("Error: %v\n", err)
+			os.Exit(StatusCodeError)
+		}
+		since, _ := cmd.Flags().GetDuration("since")
+		reportFlakes(h, time.Now().Add(-since))
+	},
+}
+
+func init() {
+	flakesCmd.Flags().Duration("since", 14*24*time.Hour, "Only report PRs seen by a sync within this time")
+	rootCmd.AddCommand(flakesCmd)
+}
+
+// flakyPR is a PR on which a job flipped.
+type flakyPR struct {
+	url      string
+	flips    int
+	lastSeen time.Time
+}
+
+// reportFlakes prints the flaky jobs of the PRs seen since the given time,
+// the flakiest first.
+func reportFlakes(h *history.History, since time.Time) {
+	byJob := map[string][]flakyPR{}
+	for url, pr := range h.PRs {
+		if pr.LastSeen.Before(since) {
+			continue
+		}
+		for job, flips := range h.Flips(url) {
+			byJob[job] = append(byJob[job], flakyPR{url: url, flips: flips, lastSeen: pr.LastSeen})
+		}
+	}
+	if len(byJob) == 0 {
+		fmt.Println("No flaky jobs found.")
+		return
+	}
+
+	total := func(prs []flakyPR) int {
+		n := 0
+		for _, pr := range prs {
+			n += pr.flips
+		}
+		return n
+	}
+	jobs := make([]string, 0, len(byJob))
+	for job := range byJob {
+		jobs = append(jobs, job)
+	}
+	slices.SortFunc(jobs, func(a, b string) int {
+		return cmp.Or(cmp.Compare(total(byJob[b]), total(byJob[a])), strings.Compare(a, b))
+	})
+
+	fmt.Printf("Jobs that both passed and failed on the same commit since %s:\n", since.Format(time.DateOnly))
+	for _, job := range jobs {
+		prs := byJob[job]
+		slices.SortFunc(prs, func(a, b flakyPR) int {
+			return cmp.Or(cmp.Compare(b.flips, a.flips), strings.Compare(a.url, b.url))
+		})
+		fmt.Printf("\n  %s: %s on %s\n", job, plural(total(prs), "flip"), plural(len(prs), "PR"))
+		for _, pr := range prs {
+			fmt.Printf("    • %-40s %s, last seen %s\n", github.FormatPRShort(pr.url), plural(pr.flips, "flip"), pr.lastSeen.Format(time.DateOnly))
+		}
+	}
+}
+
+// plural renders a count with the word in singular or plural.
+func plural(n int, word string) string {
+	if n == 1 {
+		return fmt.Sprintf("%d %s", n, word)
+	}
+	return fmt.Sprintf("%d %ss", n, word)
+}
@@ -1,19 +1,23 @@
 package main
 
 // this program has been partially written with Claude Code
-// TODO fetch OCPSTRAT->EPIC->ISSUE recursively
 
 import (
 	"bufio"
+	"cmp"
 	"context"
 	"fmt"
 	"jira2gh/pkg/config"
 	"jira2gh/pkg/github"
+	"jira2gh/pkg/gitlab"
+	"jira2gh/pkg/history"
 	"jira2gh/pkg/jira"
+	"jira2gh/pkg/provider"
 	"maps"
 	"os"
 	"slices"
 	"strings"
+	"time"
 
 	"github.com/spf13/cobra"
 )
@@ -25,109 +29,190 @@ const (
 )
 
 type prInfo struct {
-	repo   string // owner/repo
-	number string // PR number
+	repo   string // owner/repo, or the GitLab project path
+	number string // PR or MR number
+	ref    string // #number for PRs, !number for MRs
 	title  string // PR title
 	author string // PR author
 	state  string // PR state
 	issue  string
 	epic   string
+	path   string // Jira hierarchy down to the issue
+	via    string // Jira links that brought the issue in
 	url    string // PR URL
 }
 
-func parsePRURL(url string) (owner, repo, number string) {
-	// URL format: https://github.com/owner/repo/pull/number
-	parts := strings.Split(url, "/")
-	if len(parts) >= 7 && parts[2] == "github.com" && parts[5] == "pull" {
-		return parts[3], parts[4], parts[6]
-	}
-	return "", "", ""
-}
-
 var rootCmd = &cobra.Command{
 	Use:   "jira2gh <issue-id>...",
 	Short: "Sync Jira issues to GitHub project",
 	Long:  `A CLI tool to sync Jira issues to GitHub project by finding PRs in issues that aren't in the project.`,
 	Args:  cobra.MinimumNArgs(0),
 	Run: func(cmd *cobra.Command, args []string) {
-		config.Quiet, _ = cmd.Flags().GetBool("quiet")
-		github.DryRun, _ = cmd.Flags().GetBool("dry-run")
 		ctx := context.Background()
+		cfg := loadConfig(ctx, cmd, args)
 
-		cfg := &config.NewConfig{
-			Jira:   &config.JiraConfig{},
-			GitHub: &config.GitHubConfig{},
+		skipJira, _ := cmd.Flags().GetBool("skip-jira")
+		if skipJira {
+			for _, proj := range cfg.Projects {
+				proj.SkipJira = true
+			}
 		}
 
-		cfg.Jira.Token = os.Getenv("JIRA_API_TOKEN")
-		if len(cfg.Jira.Token) == 0 {
-			config.Stderr("Error: JIRA_API_TOKEN environment variable is not set\n")
-			os.Exit(StatusCodeError)
+		selectPRs, _ = cmd.Flags().GetBool("select")
+
+		if output := cmd.Flag("output").Value.String(); output != "" {
+			if output != "json" && output != "yaml" {
+				config.Stderr("Error: unknown output format %q, must be json or yaml\n", output)
+				os.Exit(StatusCodeError)
+			}
+			// The plan is the only thing written to stdout
+			config.Quiet = true
+			if err := outputPlans(ctx, cfg, output); err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(StatusCodeError)
+			}
+			return
 		}
 
-		cfg.GitHub.Token = os.Getenv("GITHUB_TOKEN")
-		if len(cfg.GitHub.Token) == 0 {
-			config.Stderr("Error: GITHUB_TOKEN environment variable is not set\n")
+		if err := run(ctx, cfg); err != nil {
+			config.Stderr("Error: %v\n", err)
 			os.Exit(StatusCodeError)
 		}
+	},
+}
 
-		var err error
-		cfgFile := cmd.Flag("config").Value.String()
-		if cfgFile == "" && len(args) == 0 {
-			// Try default config location
-			home, _ := os.UserHomeDir()
-			defaultCfg := home + "/.config/jira2gh/config.yaml"
-			if _, statErr := os.Stat(defaultCfg); statErr == nil {
-				cfgFile = defaultCfg
-			}
+// loadConfig builds the config from the environment, the config file and the
+// flags shared by all commands. It exits on error.
+func loadConfig(ctx context.Context, cmd *cobra.Command, args []string) *config.NewConfig {
+	cfg, err := buildConfig(ctx, cmd, args)
+	if err != nil {
+		config.Stderr("Error: %v\n", err)
+		os.Exit(StatusCodeError)
+	}
+	return cfg
+}
+
+// buildConfig is loadConfig without the exit, so that the config can be
+// reloaded by long-running commands.
+func buildConfig(ctx context.Context, cmd *cobra.Command, args []string) (*config.NewConfig, error) {
+	config.Quiet, _ = cmd.Flags().GetBool("quiet")
+	github.DryRun, _ = cmd.Flags().GetBool("dry-run")
+
+	cfg := &config.NewConfig{
+		Jira:   &config.JiraConfig{},
+		GitHub: &config.GitHubConfig{},
+		GitLab: &config.GitLabConfig{},
+	}
+
+	replaying, err := configureBackend(cmd)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg.Jira.Token = os.Getenv("JIRA_API_TOKEN")
+	cfg.GitHub.Token = os.Getenv("GITHUB_TOKEN")
+	if replaying {
+		cfg.Jira.Token = cmp.Or(cfg.Jira.Token, replayToken)
+		cfg.GitHub.Token = cmp.Or(cfg.GitHub.Token, replayToken)
+	}
+
+	if len(cfg.Jira.Token) == 0 {
+		return nil, fmt.Errorf("JIRA_API_TOKEN environment variable is not set")
+	}
+	if len(cfg.GitHub.Token) == 0 {
+		return nil, fmt.Errorf("GITHUB_TOKEN environment variable is not set")
+	}
+	github.Token = cfg.GitHub.Token
+
+	// Only needed for private GitLab projects
+	cfg.GitLab.Token = os.Getenv("GITLAB_TOKEN")
+	gitlab.Token = cfg.GitLab.Token
+
+	// Replays must not add to the job history of real syncs
+	if jobHistory == nil && !replaying {
+		jobHistory, err = history.Load(historyPath(cmd))
+		if err != nil {
+			return nil, err
 		}
-		if cfgFile != "" {
-			projectFilter := cmd.Flag("project").Value.String()
-			err = cfg.CompleteFromFile(cfgFile, projectFilter)
-		} else {
-			err = cfg.CompleteFromFlags(ctx, cmd, args)
+	}
+
+	cfgFile := cmd.Flag("config").Value.String()
+	if cfgFile == "" && len(args) == 0 {
+		cfgFile = replayedConfig(cmd)
+	}
+	if cfgFile == "" && len(args) == 0 {
+		// Try default config location
+		home, _ := os.UserHomeDir()
+		defaultCfg := home + "/.config/jira2gh/config.yaml"
+		if _, statErr := os.Stat(defaultCfg); statErr == nil {
+			cfgFile = defaultCfg
 		}
+	}
+	if cfgFile != "" {
+		projectFilter := cmd.Flag("project").Value.String()
+		err = cfg.CompleteFromFile(cfgFile, projectFilter)
+	} else {
+		err = cfg.CompleteFromFlags(cmd, args)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+	if err := recordConfig(cmd, cfgFile); err != nil {
+		return nil, err
+	}
 
+	for _, proj := range cfg.Projects {
+		if proj.GitHubOwner != "" {
+			continue
+		}
+		proj.GitHubOwner, err = github.FetchViewerLogin(ctx)
 		if err != nil {
-			config.Stderr("Error: %v\n", err)
-			os.Exit(StatusCodeError)
+			return nil, fmt.Errorf("failed to determine GitHub owner, please provide --github-owner: %v", err)
 		}
+	}
 
-		if authorsStr := cmd.Flag("authors").Value.String(); authorsStr != "" {
-			for _, proj := range cfg.Projects {
-				for author := range strings.SplitSeq(authorsStr, ",") {
-					proj.Authors = append(proj.Authors, strings.TrimSpace(author))
-				}
-			}
-		}
+	if auth := cmd.Flag("jira-auth").Value.String(); auth != "" {
+		cfg.Jira.Auth = auth
+	}
 
-		skipJira, _ := cmd.Flags().GetBool("skip-jira")
-		if skipJira {
-			for _, proj := range cfg.Projects {
-				proj.SkipJira = true
+	if authorsStr := cmd.Flag("authors").Value.String(); authorsStr != "" {
+		for _, proj := range cfg.Projects {
+			for author := range strings.SplitSeq(authorsStr, ",") {
+				proj.Authors = append(proj.Authors, strings.TrimSpace(author))
 			}
 		}
+	}
 
-		if err := run(ctx, cfg); err != nil {
-			config.Stderr("Error: %v\n", err)
-			os.Exit(StatusCodeError)
-		}
-	},
+	if cmd.Flags().Changed("concurrency") || cfg.GitHub.Concurrency == 0 {
+		cfg.GitHub.Concurrency, _ = cmd.Flags().GetInt("concurrency")
+	}
+	github.Concurrency = cfg.GitHub.Concurrency
+	gitlab.Concurrency = cfg.GitHub.Concurrency
+
+	return cfg, nil
 }
 
 func init() {
-	rootCmd.Flags().String("config", "", "yaml config file to use (has priority over CLI flags)")
-	rootCmd.Flags().String("project", "", "when using --config, filter to only run for the project with this github_project value")
-	rootCmd.Flags().String("jira-host", "", "Jira host URL (e.g., https://issues.redhat.com)")
-	rootCmd.Flags().String("github-project-id", "", "Self-explanatory")
-	rootCmd.Flags().String("github-owner", "", "GitHub owner (user or org). If not provided, will be fetched from GitHub CLI")
-	rootCmd.Flags().String("ignore-repos", "", "Comma-separated list of repositories to ignore (e.g., owner/repo1,owner/repo2)")
-	rootCmd.Flags().String("ignore-prs", "", "Comma-separated list of PRs to ignore (e.g., owner/repo#123,owner/repo#456)")
-	rootCmd.Flags().String("ignore-jiras", "", "Comma-separated list of Jira issues to ignore (e.g., OCPBUGS-123,OCPBUGS-456)")
-	rootCmd.Flags().String("authors", "", "Only sync PRs authored by these GitHub users (comma-separated)")
+	rootCmd.PersistentFlags().String("config", "", "yaml config file to use (has priority over CLI flags)")
+	rootCmd.PersistentFlags().String("project", "", "when using --config, filter to only run for the project with this github_project value")
+	rootCmd.PersistentFlags().String("jira-host", "", "Jira host URL (e.g., https://issues.redhat.com)")
+	rootCmd.PersistentFlags().String("jira-auth", "", "Jira auth mode: basic (email and token), bearer (personal access token) or cloud (Atlassian Cloud API token)")
+	rootCmd.PersistentFlags().String("github-project-id", "", "Self-explanatory")
+	rootCmd.PersistentFlags().String("github-owner", "", "GitHub owner (user or org). If not provided, defaults to the user owning GITHUB_TOKEN")
+	rootCmd.PersistentFlags().String("ignore-repos", "", "Comma-separated list of repositories to ignore (e.g., owner/repo1,owner/repo2)")
+	rootCmd.PersistentFlags().String("ignore-prs", "", "Comma-separated list of PRs to ignore (e.g., owner/repo#123,owner/repo#456)")
+	rootCmd.PersistentFlags().String("ignore-jiras", "", "Comma-separated list of Jira issues to ignore (e.g., OCPBUGS-123,OCPBUGS-456)")
+	rootCmd.PersistentFlags().String("authors", "", "Only sync PRs authored by these GitHub users (comma-separated)")
 	rootCmd.Flags().Bool("skip-jira", false, "Skip Jira sync, only update job summaries for PRs already in the project")
-	rootCmd.Flags().BoolP("quiet", "q", false, "Quiet mode: suppress all output, exit with 0=no new PRs, 1=new PRs found, 2=error")
-	rootCmd.Flags().BoolP("dry-run", "", false, "Dry-run mode: do not make any changes to the github project")
+	rootCmd.Flags().Bool("select", false, "Pick the PRs to add and remove one by one, and PRs to ignore from now on, instead of confirming all at once")
+	rootCmd.Flags().String("output", "", "Print the sync plan as json or yaml instead of applying it; exits with 1 if it is not empty")
+	rootCmd.PersistentFlags().Int("concurrency", 4, "Number of parallel GitHub requests used to fetch PR details")
+	rootCmd.PersistentFlags().BoolP("quiet", "q", false, "Quiet mode: suppress all output, exit with 0=no new PRs, 1=new PRs found, 2=error")
+	rootCmd.PersistentFlags().String("history", "", "File keeping the job results of PRs across syncs to spot flaky jobs (default ~/.local/state/jira2gh/history.json)")
+	rootCmd.PersistentFlags().String("record", "", "Save every Jira, GitHub and GitLab response and the config file to this directory, for --replay")
+	rootCmd.PersistentFlags().String("replay", "", "Answer all Jira, GitHub and GitLab requests from a directory saved with --record, without any network and as of the time it was recorded")
+	rootCmd.PersistentFlags().BoolP("dry-run", "", false, "Dry-run mode: do not make any changes to the github project or Jira")
 }
 
 func main() {
@@ -141,63 +226,246 @@ func run(ctx context.Context, cfg *config.NewConfig) error {
 		if i > 0 {
 			config.Println("")
 		}
-		if err := runForProject(ctx, cfg.Jira, proj); err != nil {
+		if err := runForProject(ctx, cfg, proj); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// syncPlan holds the changes a sync would make to a project.
+type syncPlan struct {
+	add    []jira.PR
+	remove []jira.PR
+	// items are the PRs already in the project and changes the field values
+	// to update on them
+	items   map[string]jira.PR
+	changes []fieldChange
+	// skipped is set when Jira was skipped or had no PRs, so there is
+	// nothing to add or remove
+	skipped bool
+}
+
+// outputPlans writes the sync plans of all projects to stdout in the given
+// format without applying them, and exits with StatusCodeNewPRsFound if any
+// of them would change something.
+func outputPlans(ctx context.Context, cfg *config.NewConfig, format string) error {
+	plans, err := collectPlans(ctx, cfg)
+	if err != nil {
+		return err
+	}
+
+	if err := writePlans(os.Stdout, format, plans); err != nil {
+		return err
+	}
+	for _, plan := range plans {
+		if !plan.empty() {
+			os.Exit(StatusCodeNewPRsFound)
+		}
+	}
+	return nil
+}
+
+func runForProject(ctx context.Context, cfg *config.NewConfig, proj *config.ProjectConfig) error {
+	jiraCfg := cfg.Jira
+	plan, err := planSync(ctx, jiraCfg, proj)
+	if err != nil {
+		return err
+	}
+
+	// Update project fields for all PRs in the project
+	config.Println("\nUpdating project fields...")
+	applyFieldChanges(ctx, proj, plan.items, plan.changes)
+	saveJobHistory()
+	displayStalePRs(plan.items)
+
+	if plan.skipped {
+		return nil
+	}
+	newPRs, removedPRs := plan.add, plan.remove
+
+	if len(newPRs) == 0 && len(removedPRs) == 0 {
+		config.Println("\nNo changes to sync.")
+		return nil
+	}
+
+	// Display new PRs to add
+	if len(newPRs) > 0 {
+		prWord := "PRs"
+		if len(newPRs) == 1 {
+			prWord = "PR"
+		}
+		config.Printf("\n%d new %s to add to project:\n", len(newPRs), prWord)
+		displayGroupedPRs(groupPRsByRepo(newPRs), jiraCfg.Host)
+	}
+
+	// Display PRs to remove
+	if len(removedPRs) > 0 {
+		prWord := "PRs"
+		if len(removedPRs) == 1 {
+			prWord = "PR"
+		}
+		config.Printf("\n%d %s no longer linked to tracked issues:\n", len(removedPRs), prWord)
+		displayGroupedPRs(groupPRsByRepo(removedPRs), jiraCfg.Host)
+	}
+
+	if config.Quiet {
+		os.Exit(StatusCodeNewPRsFound)
+	}
+
+	if selectPRs {
+		return selectAndSync(ctx, cfg, proj, newPRs, removedPRs)
+	}
+
+	// Prompt for additions
+	if len(newPRs) > 0 {
+		prWord := "PRs"
+		if len(newPRs) == 1 {
+			prWord = "PR"
+		}
+		ok, err := confirm(fmt.Sprintf("\nAdd %d %s to GitHub Project?", len(newPRs), prWord))
+		if err != nil {
+			return err
+		}
+		if ok {
+			if err := github.AddToProject(ctx, proj, newPRs); err != nil {
+				return err
+			}
+		}
+	}
+
+	// Prompt for removals
+	if len(removedPRs) > 0 {
+		prWord := "PRs"
+		if len(removedPRs) == 1 {
+			prWord = "PR"
+		}
+		ok, err := confirm(fmt.Sprintf("\nRemove %d %s from GitHub Project?", len(removedPRs), prWord))
+		if err != nil {
+			return err
+		}
+		if ok {
+			if err := github.RemoveFromProject(ctx, proj, removedPRs); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// selectAndSync lets the user pick the PRs to add and remove one by one and
+// the ones to ignore from now on, then syncs them.
+func selectAndSync(ctx context.Context, cfg *config.NewConfig, proj *config.ProjectConfig, newPRs, removedPRs []jira.PR) error {
+	var add, remove, ignored []jira.PR
+	if len(newPRs) > 0 {
+		selected, ignore, err := pickPRs(stdinReader, newPRs, "add to", cfg.Jira.Host)
+		if err != nil {
 			return err
 		}
+		add = selected
+		ignored = append(ignored, ignore...)
+	}
+	if len(removedPRs) > 0 {
+		selected, ignore, err := pickPRs(stdinReader, removedPRs, "remove from", cfg.Jira.Host)
+		if err != nil {
+			return err
+		}
+		remove = selected
+		ignored = append(ignored, ignore...)
 	}
 
+	ignorePRs(cfg.Path, proj, ignored)
+	if len(add) > 0 {
+		if err := github.AddToProject(ctx, proj, add); err != nil {
+			return err
+		}
+	}
+	if len(remove) > 0 {
+		if err := github.RemoveFromProject(ctx, proj, remove); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
-func runForProject(ctx context.Context, jiraCfg *config.JiraConfig, proj *config.ProjectConfig) error {
+// planSync fetches the project and the Jira issues it tracks and works out
+// which PRs to add and remove and which fields to update, without changing
+// anything.
+func planSync(ctx context.Context, jiraCfg *config.JiraConfig, proj *config.ProjectConfig) (*syncPlan, error) {
 	config.Printf("Fetching PRs from GitHub Project %s/%s...\n", proj.GitHubOwner, proj.GitHubProject)
 	githubPRs, err := github.FetchGitHubPRs(ctx, proj)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	config.Printf("✓ Found %d PRs in project\n", len(githubPRs))
 
 	if proj.SkipJira {
 		// Only update project fields, skip Jira sync
 		config.Println("\nFetching PR details from GitHub...")
-		for url, pr := range githubPRs {
-			author, state, err := github.FetchPRDetails(ctx, url)
-			if err != nil {
-				config.Printf("  Warning: could not fetch details for %s: %v\n", url, err)
-				continue
-			}
-			pr.Author = author
-			pr.State = state
-			githubPRs[url] = pr
+		if err := enrichPRs(ctx, proj, githubPRs); err != nil {
+			return nil, err
 		}
 
-		config.Println("\nUpdating project fields...")
-		for url, pr := range githubPRs {
-			if pr.ItemID == "" {
-				continue
-			}
-			summary, err := github.FetchJobSummary(ctx, url, pr.State)
-			if err != nil {
-				config.Printf("  Warning: could not fetch job summary for %s: %v\n", github.FormatPRShort(url), err)
-				continue
-			}
-			if err := github.UpdateItemField(ctx, proj, pr.ItemID, "Job Summary", summary); err != nil {
-				config.Printf("  Warning: could not update job summary for %s: %v\n", github.FormatPRShort(url), err)
-			}
-			if err := github.UpdateItemField(ctx, proj, pr.ItemID, "PR Author", pr.Author); err != nil {
-				config.Printf("  Warning: could not update PR author for %s: %v\n", github.FormatPRShort(url), err)
-			}
-			config.Printf("  ✓ %s: %s\n", github.FormatPRShort(url), summary)
+		changes, err := fieldChanges(ctx, proj, githubPRs)
+		if err != nil {
+			return nil, err
 		}
-		return nil
+		return &syncPlan{items: githubPRs, changes: changes, skipped: true}, nil
 	}
 
 	config.Println("\nChecking Jira issues for linked PRs...")
+	jiraPRs, err := extractJiraPRs(ctx, jiraCfg, proj)
+	if err != nil {
+		return nil, err
+	}
+
+	// Enrich PRs with GitHub details (author, state, job summary)
+	config.Println("\nFetching PR details from GitHub...")
+	if err := enrichPRs(ctx, proj, jiraPRs, githubPRs); err != nil {
+		return nil, err
+	}
+
+	// Carry the current Jira fields over to PRs already in the project
+	for url, ghPR := range githubPRs {
+		if jiraPR, found := jiraPRs[url]; found {
+			ghPR.CopyJira(jiraPR)
+			githubPRs[url] = ghPR
+		}
+	}
+
+	filterAuthors(proj, jiraPRs)
+
+	prWord := "PRs"
+	if len(jiraPRs) == 1 {
+		prWord = "PR"
+	}
+	config.Printf("✓ Found %d unique %s across all Jira issues\n", len(jiraPRs), prWord)
+
+	if len(jiraPRs) == 0 {
+		config.Println("\nNo PRs found in Jira issues specified, skipping sync.")
+		return &syncPlan{skipped: true}, nil
+	}
+
+	findJiraRoots(ctx, jiraCfg, proj, jiraPRs, githubPRs)
+	newPRs, removedPRs := diffPRs(proj, jiraPRs, githubPRs)
+	changes, err := fieldChanges(ctx, proj, githubPRs)
+	if err != nil {
+		return nil, err
+	}
+
+	return &syncPlan{add: newPRs, remove: removedPRs, items: githubPRs, changes: changes}, nil
+}
+
+// extractJiraPRs collects the PRs linked from all Jira issues the project
+// tracks, leaving out ignored ones.
+func extractJiraPRs(ctx context.Context, jiraCfg *config.JiraConfig, proj *config.ProjectConfig) (map[string]jira.PR, error) {
 	jiraPRs := map[string]jira.PR{}
 	for _, id := range proj.Jiras {
-		prs, err := jira.ExtractJiraPRs(ctx, jiraCfg, id, proj.IgnoreJiras)
+		prs, err := jira.ExtractJiraPRs(ctx, jiraCfg, proj, id)
 		if err != nil {
-			return err
+			return nil, err
 		}
 		prCount := len(prs)
 		maps.Copy(jiraPRs, prs)
@@ -216,70 +484,42 @@ func runForProject(ctx context.Context, jiraCfg *config.JiraConfig, proj *config
 			delete(jiraPRs, url)
 		}
 	}
+	return jiraPRs, nil
+}
 
-	// Enrich PRs with GitHub details (author, state)
-	config.Println("\nFetching PR details from GitHub...")
-	for url, pr := range jiraPRs {
-		author, state, err := github.FetchPRDetails(ctx, url)
-		if err != nil {
-			config.Printf("  Warning: could not fetch details for %s: %v\n", url, err)
-			continue
-		}
-		pr.Author = author
-		pr.State = state
-		jiraPRs[url] = pr
+// filterAuthors drops the PRs not authored by one of the project's authors,
+// if any are configured.
+func filterAuthors(proj *config.ProjectConfig, prs map[string]jira.PR) {
+	if len(proj.Authors) == 0 {
+		return
 	}
-	for url, pr := range githubPRs {
-		author, state, err := github.FetchPRDetails(ctx, url)
-		if err != nil {
-			config.Printf("  Warning: could not fetch details for %s: %v\n", url, err)
-			continue
+	for url, pr := range prs {
+		if !slices.Contains(proj.Authors, pr.Author) {
+			delete(prs, url)
 		}
-		pr.Author = author
-		pr.State = state
-		githubPRs[url] = pr
-	}
-
-	// Filter by authors if specified
-	if len(proj.Authors) > 0 {
-		for url, pr := range jiraPRs {
-			if !slices.Contains(proj.Authors, pr.Author) {
-				delete(jiraPRs, url)
-			}
-		}
-	}
-
-	prWord := "PRs"
-	if len(jiraPRs) == 1 {
-		prWord = "PR"
-	}
-	config.Printf("✓ Found %d unique %s across all Jira issues\n", len(jiraPRs), prWord)
-
-	if len(jiraPRs) == 0 {
-		config.Println("\nNo PRs found in Jira issues specified, skipping sync.")
-		return nil
 	}
+}
 
+// diffPRs compares the PRs linked from Jira with those in the project and
+// returns the ones to add and remove, sorted by URL so that runs against
+// the same state send the same requests.
+func diffPRs(proj *config.ProjectConfig, jiraPRs, githubPRs map[string]jira.PR) ([]jira.PR, []jira.PR) {
 	newPRs := []jira.PR{}
-	for jiraPRUrl, jiraPR := range jiraPRs {
+	for _, jiraPRUrl := range slices.Sorted(maps.Keys(jiraPRs)) {
+		jiraPR := jiraPRs[jiraPRUrl]
 		if _, exists := githubPRs[jiraPRUrl]; !exists {
 			if !shouldIgnorePR(jiraPRUrl, proj) {
-				summary, err := github.FetchJobSummary(ctx, jiraPRUrl, jiraPR.State)
-				if err == nil {
-					jiraPR.JobSummary = summary
-				}
 				newPRs = append(newPRs, jiraPR)
 			}
 		}
 	}
 
-	// Find PRs to remove: in GitHub with tracked epic, but no longer in Jira
+	// Find PRs to remove: in GitHub under a tracked issue, but no longer in
+	// Jira
 	removedPRs := []jira.PR{}
-	for url, ghPR := range githubPRs {
-		if ghPR.JiraEpic == "" {
-			continue
-		}
-		if !slices.Contains(proj.Jiras, ghPR.JiraEpic) {
+	for _, url := range slices.Sorted(maps.Keys(githubPRs)) {
+		ghPR := githubPRs[url]
+		if ghPR.JiraRoot == "" || !slices.Contains(proj.Jiras, ghPR.JiraRoot) {
 			continue
 		}
 		if _, stillInJira := jiraPRs[url]; !stillInJira {
@@ -289,116 +529,262 @@ func runForProject(ctx context.Context, jiraCfg *config.JiraConfig, proj *config
 		}
 	}
 
-	// Update project fields for all PRs in the project
-	config.Println("\nUpdating project fields...")
-	for url, pr := range githubPRs {
-		if pr.ItemID == "" {
+	return newPRs, removedPRs
+}
+
+// findJiraRoots sets the tracked issue project items were added under, if
+// any, from the Jira keys in their fields. Items still linked from Jira
+// already have it.
+func findJiraRoots(ctx context.Context, jiraCfg *config.JiraConfig, proj *config.ProjectConfig, jiraPRs, githubPRs map[string]jira.PR) {
+	for _, url := range slices.Sorted(maps.Keys(githubPRs)) {
+		pr := githubPRs[url]
+		if _, linked := jiraPRs[url]; linked || pr.JiraRoot != "" {
 			continue
 		}
-		summary, err := github.FetchJobSummary(ctx, url, pr.State)
+		root, err := jira.TrackedRoot(ctx, jiraCfg, proj, pr.JiraIssue, pr.JiraEpic, pr.JiraFeature)
 		if err != nil {
-			config.Printf("  Warning: could not fetch job summary for %s: %v\n", github.FormatPRShort(url), err)
+			config.Printf("  Warning: could not tell which tracked issue %s is under: %v\n", github.FormatPRShort(url), err)
 			continue
 		}
-		if err := github.UpdateItemField(ctx, proj, pr.ItemID, "Job Summary", summary); err != nil {
-			config.Printf("  Warning: could not update job summary for %s: %v\n", github.FormatPRShort(url), err)
-		}
-		if err := github.UpdateItemField(ctx, proj, pr.ItemID, "PR Author", pr.Author); err != nil {
-			config.Printf("  Warning: could not update PR author for %s: %v\n", github.FormatPRShort(url), err)
-		}
-		config.Printf("  ✓ %s: %s\n", github.FormatPRShort(url), summary)
+		pr.JiraRoot = root
+		githubPRs[url] = pr
 	}
+}
 
-	if len(newPRs) == 0 && len(removedPRs) == 0 {
-		config.Println("\nNo changes to sync.")
-		return nil
+// stdinReader is shared by all prompts so that input buffered by one of
+// them is not lost.
+var stdinReader = bufio.NewReader(os.Stdin)
+
+// confirm asks a yes/no question on stdin, defaulting to yes.
+func confirm(question string) (bool, error) {
+	fmt.Printf("%s [Y/n] ", question)
+	response, err := stdinReader.ReadString('\n')
+	if err != nil {
+		return false, fmt.Errorf("failed to read confirmation: %w", err)
 	}
 
-	// Display new PRs to add
-	if len(newPRs) > 0 {
-		prWord = "PRs"
-		if len(newPRs) == 1 {
-			prWord = "PR"
+	response = strings.TrimSpace(strings.ToLower(response))
+	return response == "y" || response == "", nil
+}
+
+// enrichPRs fills in author, state, job summary, checks state and staleness
+// for the given PRs of a project. PRs present in more than one map are only
+// fetched once. The job results are added to the job history, which is left
+// to the caller to save, and the jobs it shows to be flaky to the job summary.
+func enrichPRs(ctx context.Context, proj *config.ProjectConfig, prMaps ...map[string]jira.PR) error {
+	var urls []string
+	for _, prs := range prMaps {
+		urls = slices.AppendSeq(urls, maps.Keys(prs))
+	}
+	details, err := provider.FetchDetails(ctx, urls)
+	if err != nil {
+		return err
+	}
+
+	now := clock()
+	for url, d := range details {
+		if jobHistory != nil && d.Err == nil && d.Commit != "" {
+			jobHistory.Record(url, d.Commit, d.JobResults, now)
 		}
-		config.Printf("\n%d new %s to add to project:\n", len(newPRs), prWord)
-		displayGroupedPRs(groupPRsByRepo(newPRs), jiraCfg.Host)
 	}
 
-	// Display PRs to remove
-	if len(removedPRs) > 0 {
-		prWord = "PRs"
-		if len(removedPRs) == 1 {
-			prWord = "PR"
+	warned := map[string]bool{}
+	for _, prs := range prMaps {
+		for url, pr := range prs {
+			d := details[url]
+			if d.Err != nil {
+				if !warned[url] {
+					config.Printf("  Warning: could not fetch details for %s: %v\n", url, d.Err)
+					warned[url] = true
+				}
+				continue
+			}
+			pr.HasDetails = true
+			pr.Author = d.Author
+			pr.State = d.State
+			pr.JobSummary = d.JobSummary
+			pr.Checks = d.Checks
+			pr.FailedJobs = d.FailedJobs
+			pr.Retests = d.Retests
+			pr.Mergeable = d.Mergeable
+			pr.Draft = d.Draft
+			pr.UpdatedAt = d.UpdatedAt
+			pr.Labels = d.Labels
+			pr.SetStaleness(proj.Staleness, now)
+			pr.Review = ""
+			if pr.State == "OPEN" {
+				pr.Review = d.Review.Summary(now)
+			}
+			if jobHistory != nil && pr.State == "OPEN" {
+				if flaky := jobHistory.FlakyJobs(url); len(flaky) > 0 {
+					pr.JobSummary = strings.TrimPrefix(pr.JobSummary+", flaky: "+strings.Join(flaky, ", "), ", ")
+				}
+			}
+			prs[url] = pr
 		}
-		config.Printf("\n%d %s no longer linked to tracked epics:\n", len(removedPRs), prWord)
-		displayGroupedPRs(groupPRsByRepo(removedPRs), jiraCfg.Host)
 	}
 
-	if config.Quiet {
-		os.Exit(StatusCodeNewPRsFound)
+	return nil
+}
+
+// fieldChange is a project field value that differs from what the field
+// mappings and rules want.
+type fieldChange struct {
+	URL    string `json:"url" yaml:"url"`
+	ItemID string `json:"item_id" yaml:"item_id"`
+	Field  string `json:"field" yaml:"field"`
+	Old    string `json:"old" yaml:"old"`
+	New    string `json:"new" yaml:"new"`
+	// Rule is the rule that set the value, if any
+	Rule string `json:"rule,omitempty" yaml:"rule,omitempty"`
+}
+
+// fieldChanges works out the mapped and rule-driven field values of PRs that
+// are already in the project which differ from the current ones. Fields the
+// project does not have are left out.
+func fieldChanges(ctx context.Context, proj *config.ProjectConfig, prs map[string]jira.PR) ([]fieldChange, error) {
+	known, err := github.FieldNames(ctx, proj)
+	if err != nil {
+		return nil, err
 	}
 
-	// Prompt for additions
-	if len(newPRs) > 0 {
-		prWord = "PRs"
-		if len(newPRs) == 1 {
-			prWord = "PR"
+	var changes []fieldChange
+	for _, url := range slices.Sorted(maps.Keys(prs)) {
+		pr := prs[url]
+		if pr.ItemID == "" {
+			continue
 		}
-		fmt.Printf("\nAdd %d %s to GitHub Project? [Y/n] ", len(newPRs), prWord)
-		reader := bufio.NewReader(os.Stdin)
-		response, err := reader.ReadString('\n')
-		if err != nil {
-			return fmt.Errorf("failed to read confirmation: %w", err)
+		values, transitions := pr.FieldValues(proj)
+		rules := map[string]string{}
+		for _, t := range transitions {
+			rules[t.Field] = t.Rule
 		}
-
-		response = strings.TrimSpace(strings.ToLower(response))
-		if response == "y" || response == "" {
-			if err := github.AddToProject(ctx, proj, newPRs); err != nil {
-				return err
+		for _, field := range slices.Sorted(maps.Keys(values)) {
+			if !known[field] || pr.Fields[field] == values[field] {
+				continue
 			}
+			changes = append(changes, fieldChange{
+				URL:    url,
+				ItemID: pr.ItemID,
+				Field:  field,
+				Old:    pr.Fields[field],
+				New:    values[field],
+				Rule:   rules[field],
+			})
+		}
+		// Mapped fields whose source became empty, e.g. an unassigned Jira
+		// issue, are cleared
+		cleared := map[string]bool{}
+		for _, m := range proj.FieldMappings() {
+			field := m.Field
+			if !known[field] || cleared[field] || values[field] != "" || pr.Fields[field] == "" || !pr.Known(m.Source) {
+				continue
+			}
+			cleared[field] = true
+			changes = append(changes, fieldChange{URL: url, ItemID: pr.ItemID, Field: field, Old: pr.Fields[field]})
 		}
 	}
+	return changes, nil
+}
+
+// applyFieldChanges sets the changed fields of PRs that are already in the
+// project and reports the fields changed by rules. It returns the number of
+// values set.
+func applyFieldChanges(ctx context.Context, proj *config.ProjectConfig, prs map[string]jira.PR, changes []fieldChange) int {
+	byURL := map[string][]fieldChange{}
+	updates := make([]github.FieldUpdate, 0, len(changes))
+	for _, c := range changes {
+		byURL[c.URL] = append(byURL[c.URL], c)
+		updates = append(updates, github.FieldUpdate{ItemID: c.ItemID, Field: c.Field, Value: c.New})
+	}
 
-	// Prompt for removals
-	if len(removedPRs) > 0 {
-		prWord = "PRs"
-		if len(removedPRs) == 1 {
-			prWord = "PR"
+	suffix := ""
+	if github.DryRun {
+		suffix = " (dry-run)"
+	}
+	for _, url := range slices.Sorted(maps.Keys(prs)) {
+		pr := prs[url]
+		if pr.ItemID == "" {
+			continue
 		}
-		fmt.Printf("\nRemove %d %s from GitHub Project? [Y/n] ", len(removedPRs), prWord)
-		reader := bufio.NewReader(os.Stdin)
-		response, err := reader.ReadString('\n')
-		if err != nil {
-			return fmt.Errorf("failed to read confirmation: %w", err)
+		config.Printf("  ✓ %s: %s\n", github.FormatPRShort(url), pr.JobSummary)
+		for _, c := range byURL[url] {
+			if c.Rule != "" {
+				config.Printf("      %s: %s → %s (%s)%s\n", c.Field, cmp.Or(c.Old, "none"), c.New, c.Rule, suffix)
+			}
 		}
+	}
 
-		response = strings.TrimSpace(strings.ToLower(response))
-		if response == "y" || response == "" {
-			if err := github.RemoveFromProject(ctx, proj, removedPRs); err != nil {
-				return err
-			}
+	updated, err := github.UpdateItemFields(ctx, proj, updates)
+	if err != nil {
+		config.Printf("  Warning: could not update project fields: %v\n", err)
+	}
+	return updated
+}
+
+// updateProjectFields refreshes the mapped and rule-driven fields of PRs that
+// are already in the project. It returns the number of values set.
+func updateProjectFields(ctx context.Context, proj *config.ProjectConfig, prs map[string]jira.PR) int {
+	changes, err := fieldChanges(ctx, proj, prs)
+	if err != nil {
+		config.Printf("  Warning: could not update project fields: %v\n", err)
+		return 0
+	}
+	return applyFieldChanges(ctx, proj, prs, changes)
+}
+
+// stalePRs returns the PRs flagged as needing a rebase or stale, sorted by
+// URL.
+func stalePRs(prs map[string]jira.PR) []jira.PR {
+	var stale []jira.PR
+	for _, url := range slices.Sorted(maps.Keys(prs)) {
+		if prs[url].Staleness != "" {
+			stale = append(stale, prs[url])
 		}
 	}
+	return stale
+}
 
-	return nil
+// displayStalePRs lists the PRs of the project that need a rebase or have
+// had no activity for too long.
+func displayStalePRs(prs map[string]jira.PR) {
+	stale := stalePRs(prs)
+	if len(stale) == 0 {
+		return
+	}
+	verb := "need"
+	if len(stale) == 1 {
+		verb = "needs"
+	}
+	config.Printf("\n%s in the project %s attention:\n", plural(len(stale), "PR"), verb)
+	for _, pr := range stale {
+		line := fmt.Sprintf("  %-13s %s  %s", pr.Staleness, github.FormatPRShort(pr.URL), pr.Title)
+		if pr.Staleness == jira.StalenessStale {
+			line += fmt.Sprintf(" (no activity since %s)", pr.UpdatedAt.Format(time.DateOnly))
+		}
+		config.Println(line)
+	}
 }
 
 func groupPRsByRepo(prs []jira.PR) map[string][]prInfo {
 	prsByRepo := make(map[string][]prInfo)
 	for _, pr := range prs {
-		owner, repo, number := parsePRURL(pr.URL)
-		if owner == "" {
+		ref, ok := provider.Parse(pr.URL)
+		if !ok {
 			continue
 		}
-		repoKey := owner + "/" + repo
+		repoKey := ref.Repo
 		prsByRepo[repoKey] = append(prsByRepo[repoKey], prInfo{
 			repo:   repoKey,
-			number: number,
+			number: ref.Number,
+			ref:    strings.TrimPrefix(ref.Short(), ref.Repo),
 			title:  pr.Title,
 			author: pr.Author,
 			state:  pr.State,
 			issue:  pr.JiraIssue,
 			epic:   pr.JiraEpic,
+			path:   formatHierarchy(pr.Hierarchy),
+			via:    formatLinkPath(pr.LinkPath),
 			url:    pr.URL,
 		})
 	}
@@ -420,9 +806,15 @@ func displayGroupedPRs(prsByRepo map[string][]prInfo, jiraHost string) {
 
 		config.Printf("\n  %s\n", repo)
 		for _, pr := range prs {
-			config.Printf("    • #%s  %s\n", pr.number, pr.title)
+			config.Printf("    • %s  %s\n", pr.ref, pr.title)
 			config.Printf("      Author: %-20s State: %s\n", pr.author, pr.state)
 			config.Printf("      Jira:   %-20s Epic: %s\n", pr.issue, pr.epic)
+			if pr.path != "" {
+				config.Printf("      Path:   %s\n", pr.path)
+			}
+			if pr.via != "" {
+				config.Printf("      Via:    %s\n", pr.via)
+			}
 			if pr.issue != "" {
 				config.Printf("      Jira Link: %s/browse/%s\n", jiraHost, pr.issue)
 			}
@@ -431,24 +823,45 @@ func displayGroupedPRs(prsByRepo map[string][]prInfo, jiraHost string) {
 	}
 }
 
+// formatHierarchy renders a Jira hierarchy as "KEY (Type) → KEY (Type)", or
+// an empty string if the PR's issue has no ancestors.
+func formatHierarchy(items []jira.HierarchyItem) string {
+	if len(items) < 2 {
+		return ""
+	}
+	parts := make([]string, len(items))
+	for i, item := range items {
+		parts[i] = item.Key
+		if item.Type != "" {
+			parts[i] += " (" + item.Type + ")"
+		}
+	}
+	return strings.Join(parts, " → ")
+}
+
+// formatLinkPath renders the Jira links that brought an issue in, e.g.
+// "A is blocked by B, B relates to C".
+func formatLinkPath(links []jira.IssueLink) string {
+	parts := make([]string, len(links))
+	for i, link := range links {
+		parts[i] = link.String()
+	}
+	return strings.Join(parts, ", ")
+}
+
 func shouldIgnorePR(prURL string, proj *config.ProjectConfig) bool {
-	// Extract owner/repo and PR number from URL (e.g., https://github.com/owner/repo/pull/123)
-	parts := strings.Split(prURL, "/")
-	if len(parts) < 5 {
+	ref, ok := provider.Parse(prURL)
+	if !ok {
 		return false
 	}
 
-	ownerRepo := parts[3] + "/" + parts[4] // owner/repo format
-
-	if slices.Contains(proj.IgnoreRepos, ownerRepo) {
+	if slices.Contains(proj.IgnoreRepos, ref.Repo) {
 		return true
 	}
 
-	if len(proj.IgnorePRs) > 0 && len(parts) >= 7 {
-		prIdentifier := ownerRepo + "#" + parts[6]
-		if slices.Contains(proj.IgnorePRs, prIdentifier) {
-			return true
-		}
+	// GitLab MRs may be listed as group/project#123 or group/project!123
+	if slices.Contains(proj.IgnorePRs, ref.Repo+"#"+ref.Number) || slices.Contains(proj.IgnorePRs, ref.Short()) {
+		return true
 	}
 
 	return false
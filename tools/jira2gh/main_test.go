@@ -0,0 +1,251 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"jira2gh/pkg/config"
+	"jira2gh/pkg/github"
+	"jira2gh/pkg/httpclient"
+	"jira2gh/pkg/jira"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestDiffPRs(t *testing.T) {
+	proj := &config.ProjectConfig{Jiras: []string{"OCPSTRAT-1"}, IgnorePRs: []string{"o/r#5"}}
+	jiraPRs := map[string]jira.PR{
+		"https://github.com/o/r/pull/1": {URL: "https://github.com/o/r/pull/1", JiraRoot: "OCPSTRAT-1"},
+		"https://github.com/o/r/pull/2": {URL: "https://github.com/o/r/pull/2", JiraRoot: "OCPSTRAT-1"},
+	}
+	githubPRs := map[string]jira.PR{
+		"https://github.com/o/r/pull/1": {URL: "https://github.com/o/r/pull/1", JiraRoot: "OCPSTRAT-1"},
+		// No longer linked, under the tracked root through its feature
+		"https://github.com/o/r/pull/3": {URL: "https://github.com/o/r/pull/3", JiraEpic: "EPIC-1", JiraRoot: "OCPSTRAT-1"},
+		// Added by hand or under another root
+		"https://github.com/o/r/pull/4": {URL: "https://github.com/o/r/pull/4", JiraEpic: "EPIC-2"},
+		"https://github.com/o/r/pull/5": {URL: "https://github.com/o/r/pull/5", JiraRoot: "OCPSTRAT-1"},
+	}
+
+	add, remove := diffPRs(proj, jiraPRs, githubPRs)
+	urls := func(prs []jira.PR) []string {
+		var out []string
+		for _, pr := range prs {
+			out = append(out, pr.URL)
+		}
+		return out
+	}
+	if got, want := urls(add), []string{"https://github.com/o/r/pull/2"}; !slices.Equal(got, want) {
+		t.Errorf("got PRs to add %v, want %v", got, want)
+	}
+	if got, want := urls(remove), []string{"https://github.com/o/r/pull/3"}; !slices.Equal(got, want) {
+		t.Errorf("got PRs to remove %v, want %v", got, want)
+	}
+}
+
+// fakeProjectFields answers the GitHub project fields query with text fields
+// of the given names, and any other request with no data, without any
+// network.
+type fakeProjectFields struct {
+	names   []string
+	queries []string
+}
+
+func (f *fakeProjectFields) Send(req *http.Request) (*httpclient.Response, error) {
+	body, err := io.ReadAll(req.Body)
+	if err != nil {
+		return nil, err
+	}
+	f.queries = append(f.queries, string(body))
+	if !strings.Contains(string(body), "fields(first") {
+		return &httpclient.Response{StatusCode: http.StatusOK, Header: http.Header{}, Body: []byte(`{"data": {}}`)}, nil
+	}
+	var nodes []string
+	for i, name := range f.names {
+		nodes = append(nodes, fmt.Sprintf(`{"id": "F_%d", "name": %q, "dataType": "TEXT"}`, i, name))
+	}
+	resp := fmt.Sprintf(`{"data": {"node": {"fields": {"nodes": [%s]}}}}`, strings.Join(nodes, ", "))
+	return &httpclient.Response{StatusCode: http.StatusOK, Header: http.Header{}, Body: []byte(resp)}, nil
+}
+
+// useFakeProjectFields sends all requests of the test to a fakeProjectFields.
+func useFakeProjectFields(t *testing.T, names ...string) *fakeProjectFields {
+	t.Helper()
+	fake := &fakeProjectFields{names: names}
+	httpclient.SetBackend(fake)
+	github.Token = "test"
+	github.ResetCache()
+	t.Cleanup(func() {
+		httpclient.SetBackend(httpclient.Network{})
+		github.Token = ""
+		github.ResetCache()
+	})
+	return fake
+}
+
+// captureStdout returns what f prints to stdout.
+func captureStdout(t *testing.T, f func()) string {
+	t.Helper()
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout := os.Stdout
+	os.Stdout = w
+	defer func() { os.Stdout = stdout }()
+
+	out := make(chan []byte)
+	go func() {
+		data, _ := io.ReadAll(r)
+		out <- data
+	}()
+	f()
+	w.Close()
+	return string(<-out)
+}
+
+func TestFieldChanges(t *testing.T) {
+	const url = "https://github.com/o/r/pull/1"
+	proj := &config.ProjectConfig{
+		GitHubProjectID: "PVT_1",
+		Fields: []config.FieldMapping{
+			{Field: "Jira Status", Source: "jira.status"},
+			{Field: "Jira Assignee", Source: "jira.assignee"},
+			{Field: "Jira Priority", Source: "jira.priority"},
+			{Field: "Fix Version", Source: "jira.fix_version"},
+		},
+	}
+	allFields := []string{"Jira Status", "Jira Assignee", "Jira Priority", "Fix Version"}
+	current := map[string]string{
+		"Jira Status":   "New",
+		"Jira Assignee": "alice",
+		"Jira Priority": "Major",
+		"Fix Version":   "4.18",
+	}
+	change := func(field, old, new string) fieldChange {
+		return fieldChange{URL: url, ItemID: "PVTI_1", Field: field, Old: old, New: new}
+	}
+
+	tests := []struct {
+		name          string
+		pr            jira.PR
+		projectFields []string
+		// notInProject leaves the PR without an item
+		notInProject bool
+		want         []fieldChange
+	}{
+		{
+			name: "unchanged",
+			pr:   jira.PR{JiraStatus: "New", JiraAssignee: "alice", JiraPriority: "Major", JiraFixVersion: "4.18", FromJira: true},
+		},
+		{
+			name: "changed",
+			pr:   jira.PR{JiraStatus: "In Progress", JiraAssignee: "bob", JiraPriority: "Critical", JiraFixVersion: "4.19", FromJira: true},
+			want: []fieldChange{
+				change("Fix Version", "4.18", "4.19"),
+				change("Jira Assignee", "alice", "bob"),
+				change("Jira Priority", "Major", "Critical"),
+				change("Jira Status", "New", "In Progress"),
+			},
+		},
+		{
+			name: "cleared when the issue has no value any more",
+			pr:   jira.PR{JiraStatus: "New", JiraPriority: "Major", FromJira: true},
+			want: []fieldChange{
+				change("Jira Assignee", "alice", ""),
+				change("Fix Version", "4.18", ""),
+			},
+		},
+		{
+			name: "kept when the issue was not read",
+			pr:   jira.PR{},
+		},
+		{
+			name:          "fields missing from the project are left alone",
+			pr:            jira.PR{JiraStatus: "Closed", FromJira: true},
+			projectFields: []string{"Jira Status"},
+			want:          []fieldChange{change("Jira Status", "New", "Closed")},
+		},
+		{
+			name:         "not in the project",
+			pr:           jira.PR{JiraStatus: "Closed", FromJira: true},
+			notInProject: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			projectFields := tt.projectFields
+			if projectFields == nil {
+				projectFields = allFields
+			}
+			useFakeProjectFields(t, projectFields...)
+			pr := tt.pr
+			pr.URL = url
+			if !tt.notInProject {
+				pr.ItemID = "PVTI_1"
+				pr.Fields = current
+			}
+
+			got, err := fieldChanges(t.Context(), proj, map[string]jira.PR{url: pr})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("got changes %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRuleTransitionsInDryRun(t *testing.T) {
+	defer func(dryRun bool) { github.DryRun = dryRun }(github.DryRun)
+	github.DryRun = true
+
+	fake := useFakeProjectFields(t, "Status")
+	proj := &config.ProjectConfig{
+		GitHubProjectID: "PVT_1",
+		Fields:          []config.FieldMapping{{Field: "Status", Source: "jira.status"}},
+		Rules: []config.Rule{{
+			Name: "merged",
+			When: map[string]config.RuleValues{"pr.state": {"MERGED"}},
+			Set:  map[string]string{"Status": "Done"},
+		}},
+	}
+	const url = "https://github.com/o/r/pull/1"
+	prs := map[string]jira.PR{url: {
+		URL:        url,
+		ItemID:     "PVTI_1",
+		State:      "MERGED",
+		JiraStatus: "Closed",
+		JobSummary: "merged",
+		Fields:     map[string]string{"Status": "In Review"},
+	}}
+
+	changes, err := fieldChanges(t.Context(), proj, prs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []fieldChange{{URL: url, ItemID: "PVTI_1", Field: "Status", Old: "In Review", New: "Done", Rule: "merged"}}
+	if !slices.Equal(changes, want) {
+		t.Fatalf("got changes %+v, want %+v", changes, want)
+	}
+
+	var updated int
+	out := captureStdout(t, func() {
+		updated = applyFieldChanges(t.Context(), proj, prs, changes)
+	})
+	if !strings.Contains(out, "Status: In Review → Done (merged) (dry-run)") {
+		t.Errorf("transition not reported as a dry run:\n%s", out)
+	}
+	if updated != 1 {
+		t.Errorf("got %d values set, want 1", updated)
+	}
+	for _, q := range fake.queries {
+		if strings.Contains(q, "mutation") {
+			t.Errorf("sent a mutation in dry-run mode: %s", q)
+		}
+	}
+}
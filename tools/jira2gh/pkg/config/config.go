@@ -1,11 +1,13 @@
 package config
 
 import (
-	"context"
 	"fmt"
+	"maps"
 	"os"
-	"os/exec"
+	"slices"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/spf13/cobra"
 	"gopkg.in/yaml.v3"
@@ -14,29 +16,277 @@ import (
 type NewConfig struct {
 	Jira     *JiraConfig      `yaml:"jira"`
 	GitHub   *GitHubConfig    `yaml:"github"`
+	GitLab   *GitLabConfig    `yaml:"gitlab"`
+	Watch    WatchConfig      `yaml:"watch"`
 	Projects []*ProjectConfig `yaml:"projects"`
+	// Path is the config file the config was read from, if any
+	Path string `yaml:"-"`
 }
 
+// WatchConfig holds the settings of the watch command.
+type WatchConfig struct {
+	// Interval is the time between two syncs, e.g. 10m
+	Interval time.Duration `yaml:"interval"`
+}
+
+// Watch policies, deciding which changes the watch command applies.
+const (
+	// WatchPolicyAddOnly adds new PRs but leaves removals for a manual run.
+	WatchPolicyAddOnly = "add-only"
+	// WatchPolicyAddRemove adds new PRs and removes stale ones.
+	WatchPolicyAddRemove = "add-remove"
+)
+
+// Jira authentication modes.
+const (
+	// JiraAuthBasic sends the email and token as basic auth.
+	JiraAuthBasic = "basic"
+	// JiraAuthBearer sends the token as a bearer token, as used by personal
+	// access tokens on Jira Server/DC.
+	JiraAuthBearer = "bearer"
+	// JiraAuthCloud sends an Atlassian Cloud API token as basic auth and
+	// defaults to the v3 REST API.
+	JiraAuthCloud = "cloud"
+)
+
 type JiraConfig struct {
-	Host  string `yaml:"host"`
+	Host string `yaml:"host"`
+	// Auth is one of basic (default), bearer or cloud
+	Auth  string `yaml:"auth"`
 	Email string `yaml:"email"`
 	Token string `yaml:"-"`
+	// APIVersion is the REST API version; defaults to 3 for cloud, 2 otherwise
+	APIVersion int              `yaml:"api_version"`
+	PageSize   int              `yaml:"page_size"`
+	Fields     JiraFieldsConfig `yaml:"fields"`
+	// ExtraFields are the IDs of the Jira fields mapped to project fields
+	// with a jira.field:<id> source
+	ExtraFields []string `yaml:"-"`
+}
+
+// JiraFieldsConfig holds the IDs of the custom fields the sync reads, e.g.
+// customfield_12311140. IDs left empty are looked up by field name.
+type JiraFieldsConfig struct {
+	EpicLink      string `yaml:"epic_link"`
+	ParentLink    string `yaml:"parent_link"`
+	Sprint        string `yaml:"sprint"`
+	TargetVersion string `yaml:"target_version"`
 }
 
 type GitHubConfig struct {
+	Token       string `yaml:"-"`
+	Concurrency int    `yaml:"concurrency"`
+}
+
+type GitLabConfig struct {
 	Token string `yaml:"-"`
 }
 
 type ProjectConfig struct {
-	GitHubProject   string   `yaml:"github_project"`
-	GitHubProjectID string   `yaml:"-"`
-	GitHubOwner     string   `yaml:"github_owner"`
-	Jiras           []string `yaml:"jiras"`
-	IgnoreRepos     []string `yaml:"ignore_repos"`
-	IgnorePRs       []string `yaml:"ignore_prs"`
-	IgnoreJiras     []string `yaml:"ignore_jiras"`
-	Authors         []string `yaml:"authors"`
-	SkipJira        bool     `yaml:"-"`
+	GitHubProject   string     `yaml:"github_project"`
+	GitHubProjectID string     `yaml:"-"`
+	GitHubOwner     string     `yaml:"github_owner"`
+	Jiras           []string   `yaml:"jiras"`
+	IgnoreRepos     []string   `yaml:"ignore_repos"`
+	IgnorePRs       []string   `yaml:"ignore_prs"`
+	IgnoreJiras     []string   `yaml:"ignore_jiras"`
+	Authors         []string   `yaml:"authors"`
+	HierarchyDepth  int        `yaml:"hierarchy_depth"`
+	Links           LinkConfig `yaml:"links"`
+	// Fields maps PR and Jira attributes to project fields; defaults to
+	// DefaultFieldMappings
+	Fields []FieldMapping `yaml:"fields"`
+	// Rules set project fields, e.g. the board status, based on the state of
+	// the PR and its Jira issue
+	Rules []Rule `yaml:"rules"`
+	// WatchPolicy is add-only (default) or add-remove
+	WatchPolicy string `yaml:"watch_policy"`
+	// Staleness sets when open PRs are flagged as stale
+	Staleness StalenessConfig `yaml:"staleness"`
+	SkipJira  bool            `yaml:"-"`
+}
+
+// DefaultStaleAfter is how long an open PR may go without activity before it
+// is flagged as stale, unless configured otherwise.
+const DefaultStaleAfter = 14 * 24 * time.Hour
+
+// StalenessConfig holds the thresholds after which open PRs without activity
+// are flagged as stale, e.g. 336h for two weeks.
+type StalenessConfig struct {
+	// StaleAfter defaults to DefaultStaleAfter; 0 disables it
+	StaleAfter *time.Duration `yaml:"stale_after"`
+	// DraftStaleAfter applies to draft PRs instead; they are never flagged
+	// by default
+	DraftStaleAfter time.Duration `yaml:"draft_stale_after"`
+}
+
+// Threshold returns how long a PR may go without activity before it is
+// stale, or 0 if it never is.
+func (s StalenessConfig) Threshold(draft bool) time.Duration {
+	if draft {
+		return s.DraftStaleAfter
+	}
+	if s.StaleAfter != nil {
+		return *s.StaleAfter
+	}
+	return DefaultStaleAfter
+}
+
+// FieldMappings returns the configured field mappings or the default ones.
+func (p *ProjectConfig) FieldMappings() []FieldMapping {
+	if len(p.Fields) > 0 {
+		return p.Fields
+	}
+	return DefaultFieldMappings
+}
+
+// FieldMapping writes the value of a source attribute to a project field.
+type FieldMapping struct {
+	Field  string `yaml:"field"`
+	Source string `yaml:"source"`
+	// Values optionally maps source values to the values written, e.g. Jira
+	// statuses to Status options. Values not listed are written unchanged,
+	// and the "" key sets a value for when the source is empty.
+	Values map[string]string `yaml:"values"`
+}
+
+// JiraFieldSource is the prefix of sources that read a Jira field by ID, e.g.
+// jira.field:customfield_12310243.
+const JiraFieldSource = "jira.field:"
+
+// FieldSources are the sources a field mapping can read from, besides
+// JiraFieldSource.
+var FieldSources = []string{
+	"pr.url", "pr.title", "pr.author", "pr.state", "pr.checks", "pr.repo", "pr.number",
+	"pr.draft", "pr.mergeable", "pr.updated_at", "pr.staleness", "pr.review",
+	"jira.issue", "jira.epic", "jira.feature", "jira.status", "jira.assignee",
+	"jira.priority", "jira.fix_version", "jira.sprint", "jira.target_version",
+	"summary.jobs", "summary.failed_jobs",
+}
+
+// DefaultFieldMappings is the board layout used when a project has no fields
+// configured.
+var DefaultFieldMappings = []FieldMapping{
+	{Field: "Jira Feature", Source: "jira.feature"},
+	{Field: "Jira Epic", Source: "jira.epic"},
+	{Field: "Jira Issue", Source: "jira.issue"},
+	{Field: "Jira Status", Source: "jira.status"},
+	{Field: "Jira Assignee", Source: "jira.assignee"},
+	{Field: "Jira Priority", Source: "jira.priority"},
+	{Field: "Fix Version", Source: "jira.fix_version"},
+	{Field: "PR Author", Source: "pr.author"},
+	{Field: "Job Summary", Source: "summary.jobs"},
+	{Field: "Failed Jobs", Source: "summary.failed_jobs"},
+	{Field: "Staleness", Source: "pr.staleness"},
+	{Field: "Review", Source: "pr.review"},
+}
+
+// Rule sets project fields on items matching all of its conditions, e.g.
+//
+//	when: {pr.state: MERGED, jira.status: [Closed, Verified]}
+//	set: {Status: Done}
+type Rule struct {
+	Name string `yaml:"name"`
+	// When maps field mapping sources to the values they must have; values
+	// are compared case-insensitively and "" matches an empty value
+	When map[string]RuleValues `yaml:"when"`
+	Set  map[string]string     `yaml:"set"`
+}
+
+// String returns the rule name, or its conditions if it has none.
+func (r Rule) String() string {
+	if r.Name != "" {
+		return r.Name
+	}
+	conds := make([]string, 0, len(r.When))
+	for _, source := range slices.Sorted(maps.Keys(r.When)) {
+		conds = append(conds, source+"="+strings.Join(r.When[source], "|"))
+	}
+	return "when " + strings.Join(conds, ", ")
+}
+
+// RuleValues are the accepted values of a rule condition. A plain string in
+// YAML is shorthand for a single value.
+type RuleValues []string
+
+func (v *RuleValues) UnmarshalYAML(value *yaml.Node) error {
+	if value.Kind == yaml.ScalarNode {
+		*v = RuleValues{value.Value}
+		return nil
+	}
+	return value.Decode((*[]string)(v))
+}
+
+// validateFields checks the field mappings, rules and watch policies of all
+// projects and collects the Jira fields they read.
+func (cfg *NewConfig) validateFields() error {
+	for _, proj := range cfg.Projects {
+		switch proj.WatchPolicy {
+		case "", WatchPolicyAddOnly, WatchPolicyAddRemove:
+		default:
+			return fmt.Errorf("project %s: unknown watch policy %q", proj.GitHubProject, proj.WatchPolicy)
+		}
+		for _, m := range proj.Fields {
+			if m.Field == "" {
+				return fmt.Errorf("project %s: field mapping for %q has no field name", proj.GitHubProject, m.Source)
+			}
+			if err := cfg.validateSource(m.Source); err != nil {
+				return fmt.Errorf("project %s: field '%s': %w", proj.GitHubProject, m.Field, err)
+			}
+		}
+		for _, rule := range proj.Rules {
+			if len(rule.When) == 0 || len(rule.Set) == 0 {
+				return fmt.Errorf("project %s: rule %q needs both when and set", proj.GitHubProject, rule.String())
+			}
+			for source := range rule.When {
+				if err := cfg.validateSource(source); err != nil {
+					return fmt.Errorf("project %s: rule %q: %w", proj.GitHubProject, rule.String(), err)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// validateSource checks a field mapping source, adding the Jira fields read
+// by jira.field:<id> sources to ExtraFields.
+func (cfg *NewConfig) validateSource(source string) error {
+	if id, found := strings.CutPrefix(source, JiraFieldSource); found && id != "" {
+		if !slices.Contains(cfg.Jira.ExtraFields, id) {
+			cfg.Jira.ExtraFields = append(cfg.Jira.ExtraFields, id)
+		}
+		return nil
+	}
+	if !slices.Contains(FieldSources, source) {
+		return fmt.Errorf("unknown source %q", source)
+	}
+	return nil
+}
+
+// LinkConfig controls which Jira issue links are followed to find more PRs.
+type LinkConfig struct {
+	Allow []LinkRule `yaml:"allow"`
+	Deny  []LinkRule `yaml:"deny"`
+	// Depth is how many links away from the hierarchy to look; 0 disables
+	// link expansion. Defaults to 1.
+	Depth *int `yaml:"depth"`
+}
+
+// LinkRule matches a link type name (e.g. "Blocks") or the relation as seen
+// from the linking issue (e.g. "is blocked by"), optionally restricted to one
+// direction. A plain string in YAML is shorthand for a rule with only a type.
+type LinkRule struct {
+	Type      string `yaml:"type"`
+	Direction string `yaml:"direction"` // inward, outward or empty for both
+}
+
+func (r *LinkRule) UnmarshalYAML(value *yaml.Node) error {
+	if value.Kind == yaml.ScalarNode {
+		r.Type = value.Value
+		return nil
+	}
+	type plain LinkRule
+	return value.Decode((*plain)(r))
 }
 
 type GitHubFieldValue struct {
@@ -46,25 +296,15 @@ type GitHubFieldValue struct {
 	ValueID string `yaml:"-"`
 }
 
-func (cfg *NewConfig) CompleteFromFlags(ctx context.Context, cmd *cobra.Command, jiras []string) error {
+func (cfg *NewConfig) CompleteFromFlags(cmd *cobra.Command, jiras []string) error {
 	if len(jiras) == 0 {
 		return fmt.Errorf("no jiras provided")
 	}
 
-	// Get GitHub owner from flag or GitHub CLI
-	githubOwner := cmd.Flag("github-owner").Value.String()
-	if len(githubOwner) == 0 {
-		// Try to get owner from GitHub CLI
-		var err error
-		githubOwner, err = getGitHubOwner(ctx)
-		if err != nil {
-			return fmt.Errorf("Failed to determine GitHub owner. Please provide --github-owner flag or ensure GitHub CLI is configured: %v", err)
-		}
-	}
-
 	cfg.Jira.Host = cmd.Flag("jira-host").Value.String()
 	proj := &ProjectConfig{
 		GitHubProject: cmd.Flag("github-project-id").Value.String(),
+		GitHubOwner:   cmd.Flag("github-owner").Value.String(),
 		Jiras:         jiras,
 	}
 
@@ -102,6 +342,7 @@ func (cfg *NewConfig) CompleteFromFile(filename string, projectFilter string) er
 	if err := yaml.Unmarshal(data, cfg); err != nil {
 		return fmt.Errorf("failed to parse YAML from %s: %w", filename, err)
 	}
+	cfg.Path = filename
 
 	// Filter projects if a project filter is specified
 	if projectFilter != "" {
@@ -121,21 +362,161 @@ func (cfg *NewConfig) CompleteFromFile(filename string, projectFilter string) er
 		cfg.Projects = filtered
 	}
 
+	return cfg.validateFields()
+}
+
+// AddIgnoredPRs adds PRs to the ignore_prs of a project in a config file.
+// Only the lines holding the new entries are touched, so the rest of the file
+// keeps its formatting and comments.
+func AddIgnoredPRs(path string, proj *ProjectConfig, prs []string) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return fmt.Errorf("failed to read config file %s: %w", path, err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read config file %s: %w", path, err)
+	}
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return fmt.Errorf("failed to parse YAML from %s: %w", path, err)
+	}
+
+	projNode := findProjectNode(&doc, proj)
+	if projNode == nil {
+		return fmt.Errorf("project %s not found in %s", proj.GitHubProject, path)
+	}
+	ignoredKey, ignored := mappingEntry(projNode, "ignore_prs")
+	if ignored != nil && ignored.Kind != yaml.SequenceNode && ignored.Tag != "!!null" {
+		return fmt.Errorf("ignore_prs of project %s in %s is not a list", proj.GitHubProject, path)
+	}
+
+	var add []string
+	for _, pr := range prs {
+		if slices.Contains(add, pr) || ignored != nil && slices.ContainsFunc(ignored.Content, func(n *yaml.Node) bool { return n.Value == pr }) {
+			continue
+		}
+		add = append(add, pr)
+	}
+	if len(add) == 0 {
+		return nil
+	}
+
+	lines := strings.SplitAfter(strings.TrimSuffix(string(data), "\n")+"\n", "\n")
+	lines = lines[:len(lines)-1]
+	switch {
+	case ignored == nil:
+		// Right below github_project, which the project is found by
+		key, _ := mappingEntry(projNode, "github_project")
+		indent := strings.Repeat(" ", key.Column-1)
+		entry := []string{indent + "ignore_prs:\n"}
+		for _, pr := range add {
+			entry = append(entry, indent+"  - "+yamlScalar(pr)+"\n")
+		}
+		lines = slices.Insert(lines, key.Line, entry...)
+	case ignored.Kind != yaml.SequenceNode:
+		// ignore_prs without a value, or with an explicit null
+		if ignored.Line == ignoredKey.Line && ignored.Value != "" {
+			lines[ignored.Line-1] = strings.TrimRight(lines[ignored.Line-1][:ignored.Column-1], " ") + "\n"
+		}
+		indent := strings.Repeat(" ", ignoredKey.Column-1)
+		var entry []string
+		for _, pr := range add {
+			entry = append(entry, indent+"  - "+yamlScalar(pr)+"\n")
+		}
+		lines = slices.Insert(lines, ignoredKey.Line, entry...)
+	case ignored.Style&yaml.FlowStyle != 0:
+		// [a, b] gets the new entries before its closing bracket
+		text := strings.Join(lines, "")
+		start := len(strings.Join(lines[:ignored.Line-1], "")) + ignored.Column - 1
+		end := strings.IndexByte(text[start:], ']')
+		if end < 0 {
+			return fmt.Errorf("failed to parse ignore_prs of project %s in %s", proj.GitHubProject, path)
+		}
+		end += start
+		sep := ", "
+		if len(ignored.Content) == 0 {
+			sep = ""
+		}
+		quoted := make([]string, len(add))
+		for i, pr := range add {
+			quoted[i] = yamlScalar(pr)
+		}
+		lines = []string{text[:end] + sep + strings.Join(quoted, ", ") + text[end:]}
+	default:
+		// Below the last entry, indented like it
+		last := ignored.Content[len(ignored.Content)-1]
+		prefix := lines[last.Line-1][:last.Column-1]
+		if strings.Trim(prefix, " -") != "" {
+			prefix = strings.Repeat(" ", ignoredKey.Column+1) + "- "
+		}
+		var entry []string
+		for _, pr := range add {
+			entry = append(entry, prefix+yamlScalar(pr)+"\n")
+		}
+		lines = slices.Insert(lines, last.Line, entry...)
+	}
+	out := []byte(strings.Join(lines, ""))
+
+	// Make sure the edit kept the file valid before writing it
+	var check NewConfig
+	if err := yaml.Unmarshal(out, &check); err != nil {
+		return fmt.Errorf("failed to add ignored PRs to %s: %w", path, err)
+	}
+	if err := os.WriteFile(path, out, info.Mode().Perm()); err != nil {
+		return fmt.Errorf("failed to write config file %s: %w", path, err)
+	}
 	return nil
 }
 
-// getGitHubOwner retrieves the GitHub owner from the GitHub CLI
-func getGitHubOwner(ctx context.Context) (string, error) {
-	cmd := exec.CommandContext(ctx, "gh", "api", "user", "--jq", ".login")
-	output, err := cmd.Output()
+// yamlScalar renders a string as a YAML scalar, quoted only if needed.
+func yamlScalar(s string) string {
+	out, err := yaml.Marshal(s)
 	if err != nil {
-		return "", fmt.Errorf("failed to get GitHub user from gh CLI: %w", err)
+		return strconv.Quote(s)
 	}
+	return strings.TrimSuffix(string(out), "\n")
+}
 
-	owner := strings.TrimSpace(string(output))
-	if owner == "" {
-		return "", fmt.Errorf("GitHub CLI returned empty owner")
+// findProjectNode returns the mapping node of a project in a config
+// document. The owner only has to match if the file sets it.
+func findProjectNode(doc *yaml.Node, proj *ProjectConfig) *yaml.Node {
+	if doc.Kind != yaml.DocumentNode || len(doc.Content) == 0 {
+		return nil
+	}
+	projects := mappingValue(doc.Content[0], "projects")
+	if projects == nil || projects.Kind != yaml.SequenceNode {
+		return nil
+	}
+	for _, node := range projects.Content {
+		number := mappingValue(node, "github_project")
+		if number == nil || number.Value != proj.GitHubProject {
+			continue
+		}
+		if owner := mappingValue(node, "github_owner"); owner != nil && owner.Value != "" && owner.Value != proj.GitHubOwner {
+			continue
+		}
+		return node
 	}
+	return nil
+}
+
+// mappingValue returns the value node of a key in a mapping node, or nil.
+func mappingValue(node *yaml.Node, key string) *yaml.Node {
+	_, value := mappingEntry(node, key)
+	return value
+}
 
-	return owner, nil
+// mappingEntry returns the key and value nodes of a key in a mapping node,
+// or nils.
+func mappingEntry(node *yaml.Node, key string) (*yaml.Node, *yaml.Node) {
+	if node.Kind != yaml.MappingNode {
+		return nil, nil
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			return node.Content[i], node.Content[i+1]
+		}
+	}
+	return nil, nil
 }
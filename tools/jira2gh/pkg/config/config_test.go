@@ -0,0 +1,257 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestAddIgnoredPRs(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  string
+		proj    ProjectConfig
+		prs     []string
+		want    string
+		wantErr bool
+	}{
+		{
+			name: "new list below the project number",
+			config: `# sync config
+projects:
+  - github_project: "1"
+    jiras: [A-1] # tracked
+`,
+			proj: ProjectConfig{GitHubProject: "1"},
+			prs:  []string{"o/r#1", "o/r#2"},
+			want: `# sync config
+projects:
+  - github_project: "1"
+    ignore_prs:
+      - o/r#1
+      - o/r#2
+    jiras: [A-1] # tracked
+`,
+		},
+		{
+			name: "file without a final newline",
+			config: `projects:
+  - github_project: "1"
+    ignore_prs: [o/r#1]`,
+			proj: ProjectConfig{GitHubProject: "1"},
+			prs:  []string{"o/r#2"},
+			want: `projects:
+  - github_project: "1"
+    ignore_prs: [o/r#1, o/r#2]
+`,
+		},
+		{
+			name: "empty list",
+			config: `projects:
+  - github_project: "1"
+    ignore_prs:
+    jiras: [A-1]
+`,
+			proj: ProjectConfig{GitHubProject: "1"},
+			prs:  []string{"o/r#1"},
+			want: `projects:
+  - github_project: "1"
+    ignore_prs:
+      - o/r#1
+    jiras: [A-1]
+`,
+		},
+		{
+			name: "explicit null",
+			config: `projects:
+  - github_project: "1"
+    ignore_prs: ~ # none yet
+`,
+			proj: ProjectConfig{GitHubProject: "1"},
+			prs:  []string{"o/r#1"},
+			want: `projects:
+  - github_project: "1"
+    ignore_prs:
+      - o/r#1
+`,
+		},
+		{
+			name: "flow list",
+			config: `projects:
+  - github_project: "1"
+    ignore_prs: [o/r#1] # flaky
+`,
+			proj: ProjectConfig{GitHubProject: "1"},
+			prs:  []string{"o/r#2"},
+			want: `projects:
+  - github_project: "1"
+    ignore_prs: [o/r#1, o/r#2] # flaky
+`,
+		},
+		{
+			name: "empty flow list",
+			config: `projects:
+  - github_project: "1"
+    ignore_prs: []
+`,
+			proj: ProjectConfig{GitHubProject: "1"},
+			prs:  []string{"o/r#2"},
+			want: `projects:
+  - github_project: "1"
+    ignore_prs: [o/r#2]
+`,
+		},
+		{
+			name: "block list",
+			config: `projects:
+  - github_project: "1"
+    ignore_prs:
+    - o/r#1 # flaky
+    jiras: [A-1]
+`,
+			proj: ProjectConfig{GitHubProject: "1"},
+			prs:  []string{"o/r#2", "o/r#1", "o/r#2"},
+			want: `projects:
+  - github_project: "1"
+    ignore_prs:
+    - o/r#1 # flaky
+    - o/r#2
+    jiras: [A-1]
+`,
+		},
+		{
+			name: "already ignored",
+			config: `projects:
+  - github_project: "1"
+    ignore_prs: [o/r#1]
+`,
+			proj: ProjectConfig{GitHubProject: "1"},
+			prs:  []string{"o/r#1"},
+			want: `projects:
+  - github_project: "1"
+    ignore_prs: [o/r#1]
+`,
+		},
+		{
+			name: "project of the same number with another owner",
+			config: `projects:
+  - github_owner: a
+    github_project: "1"
+  - github_owner: b
+    github_project: "1"
+`,
+			proj: ProjectConfig{GitHubOwner: "b", GitHubProject: "1"},
+			prs:  []string{"o/r#1"},
+			want: `projects:
+  - github_owner: a
+    github_project: "1"
+  - github_owner: b
+    github_project: "1"
+    ignore_prs:
+      - o/r#1
+`,
+		},
+		{
+			name: "entries that need quoting added once",
+			config: `projects:
+  - github_project: "1"
+    ignore_prs:
+      - "@o/r#1"
+`,
+			proj: ProjectConfig{GitHubProject: "1"},
+			prs:  []string{"@o/r#1", "@o/r#2", "@o/r#2"},
+			want: `projects:
+  - github_project: "1"
+    ignore_prs:
+      - "@o/r#1"
+      - '@o/r#2'
+`,
+		},
+		{
+			name: "unknown project",
+			config: `projects:
+  - github_project: "1"
+`,
+			proj:    ProjectConfig{GitHubProject: "2"},
+			prs:     []string{"o/r#1"},
+			wantErr: true,
+		},
+		{
+			name: "not a list",
+			config: `projects:
+  - github_project: "1"
+    ignore_prs: o/r#1
+`,
+			proj:    ProjectConfig{GitHubProject: "1"},
+			prs:     []string{"o/r#2"},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "config.yaml")
+			if err := os.WriteFile(path, []byte(tt.config), 0o600); err != nil {
+				t.Fatal(err)
+			}
+
+			err := AddIgnoredPRs(path, &tt.proj, tt.prs)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v, want error %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			got, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("got config:\n%s\nwant:\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestStalenessThreshold(t *testing.T) {
+	tests := []struct {
+		name      string
+		yaml      string
+		want      time.Duration
+		wantDraft time.Duration
+	}{
+		{
+			name: "defaults",
+			yaml: `{}`,
+			want: DefaultStaleAfter,
+		},
+		{
+			name:      "configured",
+			yaml:      `{stale_after: 72h, draft_stale_after: 720h}`,
+			want:      72 * time.Hour,
+			wantDraft: 720 * time.Hour,
+		},
+		{
+			name: "disabled",
+			yaml: `{stale_after: 0s}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var cfg StalenessConfig
+			if err := yaml.Unmarshal([]byte(tt.yaml), &cfg); err != nil {
+				t.Fatal(err)
+			}
+			if got := cfg.Threshold(false); got != tt.want {
+				t.Errorf("got threshold %s, want %s", got, tt.want)
+			}
+			if got := cfg.Threshold(true); got != tt.wantDraft {
+				t.Errorf("got draft threshold %s, want %s", got, tt.wantDraft)
+			}
+		})
+	}
+}
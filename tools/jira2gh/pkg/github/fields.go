@@ -0,0 +1,248 @@
+package github
+
+import (
+	"context"
+	"fmt"
+	"jira2gh/pkg/config"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Project field data types, as reported by ProjectV2FieldCommon.dataType.
+const (
+	fieldText         = "TEXT"
+	fieldSingleSelect = "SINGLE_SELECT"
+	fieldDate         = "DATE"
+	fieldNumber       = "NUMBER"
+	fieldIteration    = "ITERATION"
+)
+
+// projectField is a field of a GitHub project along with what is needed to
+// write values of its type.
+type projectField struct {
+	ID       string
+	Name     string
+	DataType string
+	// Options maps single-select option names to option IDs
+	Options map[string]string
+	// Iterations maps iteration titles to iteration IDs, including completed
+	// iterations
+	Iterations map[string]string
+}
+
+// valueLiteral converts a value given as text to the GraphQL input value for
+// the field's type: option names for single-select fields, ISO dates (or RFC
+// 3339 timestamps) for date fields, numbers, and iteration titles or IDs.
+func (f *projectField) valueLiteral(value string) (string, error) {
+	switch f.DataType {
+	case fieldText, "":
+		return fmt.Sprintf("{text: %s}", gqlString(value)), nil
+
+	case fieldSingleSelect:
+		id := lookupFold(f.Options, value)
+		if id == "" {
+			return "", fmt.Errorf("no option %q in field '%s'", value, f.Name)
+		}
+		return fmt.Sprintf("{singleSelectOptionId: %s}", gqlString(id)), nil
+
+	case fieldDate:
+		date, err := time.Parse(time.DateOnly, value)
+		if err != nil {
+			ts, tsErr := time.Parse(time.RFC3339, value)
+			if tsErr != nil {
+				return "", fmt.Errorf("invalid date %q for field '%s'", value, f.Name)
+			}
+			date = ts
+		}
+		return fmt.Sprintf("{date: %s}", gqlString(date.Format(time.DateOnly))), nil
+
+	case fieldNumber:
+		num, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+		// GraphQL has no literal for NaN and infinities
+		if err != nil || math.IsNaN(num) || math.IsInf(num, 0) {
+			return "", fmt.Errorf("invalid number %q for field '%s'", value, f.Name)
+		}
+		return fmt.Sprintf("{number: %s}", strconv.FormatFloat(num, 'f', -1, 64)), nil
+
+	case fieldIteration:
+		id := lookupFold(f.Iterations, value)
+		if id == "" {
+			for _, iterID := range f.Iterations {
+				if iterID == value {
+					id = iterID
+				}
+			}
+		}
+		if id == "" {
+			return "", fmt.Errorf("no iteration %q in field '%s'", value, f.Name)
+		}
+		return fmt.Sprintf("{iterationId: %s}", gqlString(id)), nil
+
+	default:
+		return "", fmt.Errorf("field '%s' of type %s cannot be set", f.Name, f.DataType)
+	}
+}
+
+// lookupFold returns the value for name, matching case-insensitively if there
+// is no exact match.
+func lookupFold(m map[string]string, name string) string {
+	if id, found := m[name]; found {
+		return id
+	}
+	for key, id := range m {
+		if strings.EqualFold(key, name) {
+			return id
+		}
+	}
+	return ""
+}
+
+// ResetCache forgets the project fields fetched so far, so that the next sync
+// picks up fields and options added in the meantime.
+func ResetCache() {
+	fieldsMu.Lock()
+	defer fieldsMu.Unlock()
+	projectFields = map[string]map[string]*projectField{}
+}
+
+// FieldNames returns the names of the fields of the GitHub project.
+func FieldNames(ctx context.Context, proj *config.ProjectConfig) (map[string]bool, error) {
+	fields, err := ghGetFields(ctx, proj)
+	if err != nil {
+		return nil, err
+	}
+	names := make(map[string]bool, len(fields))
+	for name, field := range fields {
+		if field != nil {
+			names[name] = true
+		}
+	}
+	return names, nil
+}
+
+// ghGetFields retrieves the fields of the GitHub project by name.
+func ghGetFields(ctx context.Context, proj *config.ProjectConfig) (map[string]*projectField, error) {
+	projID, err := ghGetProjectID(ctx, proj)
+	if err != nil {
+		return nil, err
+	}
+	fieldsMu.Lock()
+	fields, found := projectFields[projID]
+	fieldsMu.Unlock()
+	if found {
+		return fields, nil
+	}
+
+	type iteration struct {
+		ID    string `json:"id"`
+		Title string `json:"title"`
+	}
+	var response struct {
+		Node struct {
+			Fields struct {
+				Nodes []struct {
+					ID       string `json:"id"`
+					Name     string `json:"name"`
+					DataType string `json:"dataType"`
+					Options  []struct {
+						ID   string `json:"id"`
+						Name string `json:"name"`
+					} `json:"options"`
+					Configuration struct {
+						Iterations          []iteration `json:"iterations"`
+						CompletedIterations []iteration `json:"completedIterations"`
+					} `json:"configuration"`
+				} `json:"nodes"`
+			} `json:"fields"`
+		} `json:"node"`
+	}
+	const query = `query($id: ID!) {
+  node(id: $id) {
+    ... on ProjectV2 {
+      fields(first: 100) {
+        nodes {
+          ... on ProjectV2FieldCommon { id name dataType }
+          ... on ProjectV2SingleSelectField { options { id name } }
+          ... on ProjectV2IterationField {
+            configuration {
+              iterations { id title }
+              completedIterations { id title }
+            }
+          }
+        }
+      }
+    }
+  }
+}`
+	if err := graphQL(ctx, query, map[string]any{"id": projID}, &response); err != nil {
+		return nil, fmt.Errorf("failed to fetch project fields: %w", err)
+	}
+
+	fields = map[string]*projectField{}
+	for _, node := range response.Node.Fields.Nodes {
+		field := &projectField{ID: node.ID, Name: node.Name, DataType: node.DataType}
+		if len(node.Options) > 0 {
+			field.Options = make(map[string]string, len(node.Options))
+			for _, opt := range node.Options {
+				field.Options[opt.Name] = opt.ID
+			}
+		}
+		iterations := append(node.Configuration.Iterations, node.Configuration.CompletedIterations...)
+		if len(iterations) > 0 {
+			field.Iterations = make(map[string]string, len(iterations))
+			for _, iter := range iterations {
+				field.Iterations[iter.Title] = iter.ID
+			}
+		}
+		fields[node.Name] = field
+	}
+	fieldsMu.Lock()
+	projectFields[projID] = fields
+	fieldsMu.Unlock()
+
+	return fields, nil
+}
+
+// ghItemEdit sets the given field values in a single mutation. Values that
+// do not fit their field's type are skipped with a warning. It returns the
+// number of values set, or that would be set in dry-run mode.
+func ghItemEdit(ctx context.Context, projectID string, fields map[string]*projectField, updates []FieldUpdate) (int, error) {
+	if len(updates) == 0 {
+		return 0, nil
+	}
+
+	var b strings.Builder
+	b.WriteString("mutation {\n")
+	edits := 0
+	for i, u := range updates {
+		field := fields[u.Field]
+		if field == nil {
+			continue
+		}
+		if u.Value == "" {
+			fmt.Fprintf(&b, "  u%d: clearProjectV2ItemFieldValue(input: {projectId: %s, itemId: %s, fieldId: %s}) { projectV2Item { id } }\n",
+				i, gqlString(projectID), gqlString(u.ItemID), gqlString(field.ID))
+			edits++
+			continue
+		}
+		value, err := field.valueLiteral(u.Value)
+		if err != nil {
+			config.Printf("  Warning: %v, skipping\n", err)
+			continue
+		}
+		fmt.Fprintf(&b, "  u%d: updateProjectV2ItemFieldValue(input: {projectId: %s, itemId: %s, fieldId: %s, value: %s}) { projectV2Item { id } }\n",
+			i, gqlString(projectID), gqlString(u.ItemID), gqlString(field.ID), value)
+		edits++
+	}
+	b.WriteString("}")
+
+	if edits == 0 || DryRun {
+		return edits, nil
+	}
+	if err := graphQL(ctx, b.String(), nil, nil); err != nil {
+		return 0, err
+	}
+	return edits, nil
+}
@@ -0,0 +1,189 @@
+package github
+
+import (
+	"jira2gh/pkg/config"
+	"strings"
+	"testing"
+)
+
+func TestValueLiteral(t *testing.T) {
+	tests := []struct {
+		name    string
+		field   projectField
+		value   string
+		want    string
+		wantErr bool
+	}{
+		{
+			name:  "text",
+			field: projectField{Name: "Title", DataType: fieldText},
+			value: `say "hi"`,
+			want:  `{text: "say \"hi\""}`,
+		},
+		{
+			name:  "untyped as text",
+			field: projectField{Name: "Title"},
+			value: "hi",
+			want:  `{text: "hi"}`,
+		},
+		{
+			name:  "single select",
+			field: projectField{Name: "Status", DataType: fieldSingleSelect, Options: map[string]string{"In Progress": "OPT_1"}},
+			value: "In Progress",
+			want:  `{singleSelectOptionId: "OPT_1"}`,
+		},
+		{
+			name:  "single select ignoring case",
+			field: projectField{Name: "Status", DataType: fieldSingleSelect, Options: map[string]string{"In Progress": "OPT_1"}},
+			value: "in progress",
+			want:  `{singleSelectOptionId: "OPT_1"}`,
+		},
+		{
+			name:    "unknown option",
+			field:   projectField{Name: "Status", DataType: fieldSingleSelect, Options: map[string]string{"In Progress": "OPT_1"}},
+			value:   "Done",
+			wantErr: true,
+		},
+		{
+			name:  "date",
+			field: projectField{Name: "Due", DataType: fieldDate},
+			value: "2024-03-01",
+			want:  `{date: "2024-03-01"}`,
+		},
+		{
+			name:  "timestamp as date",
+			field: projectField{Name: "Due", DataType: fieldDate},
+			value: "2024-03-01T15:04:05Z",
+			want:  `{date: "2024-03-01"}`,
+		},
+		{
+			name:    "invalid date",
+			field:   projectField{Name: "Due", DataType: fieldDate},
+			value:   "March 1st",
+			wantErr: true,
+		},
+		{
+			name:  "number",
+			field: projectField{Name: "Points", DataType: fieldNumber},
+			value: " 3.50 ",
+			want:  `{number: 3.5}`,
+		},
+		{
+			name:    "invalid number",
+			field:   projectField{Name: "Points", DataType: fieldNumber},
+			value:   "three",
+			wantErr: true,
+		},
+		{
+			name:    "not a number",
+			field:   projectField{Name: "Points", DataType: fieldNumber},
+			value:   "NaN",
+			wantErr: true,
+		},
+		{
+			name:    "infinite number",
+			field:   projectField{Name: "Points", DataType: fieldNumber},
+			value:   "+Inf",
+			wantErr: true,
+		},
+		{
+			name:  "iteration by title",
+			field: projectField{Name: "Sprint", DataType: fieldIteration, Iterations: map[string]string{"Sprint 1": "IT_1"}},
+			value: "sprint 1",
+			want:  `{iterationId: "IT_1"}`,
+		},
+		{
+			name:  "iteration by ID",
+			field: projectField{Name: "Sprint", DataType: fieldIteration, Iterations: map[string]string{"Sprint 1": "IT_1"}},
+			value: "IT_1",
+			want:  `{iterationId: "IT_1"}`,
+		},
+		{
+			name:    "unknown iteration",
+			field:   projectField{Name: "Sprint", DataType: fieldIteration, Iterations: map[string]string{"Sprint 1": "IT_1"}},
+			value:   "Sprint 2",
+			wantErr: true,
+		},
+		{
+			name:    "unsupported type",
+			field:   projectField{Name: "Assignees", DataType: "ASSIGNEES"},
+			value:   "someone",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.field.valueLiteral(tt.value)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v, want error %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUpdateItemFieldsCountsEdits(t *testing.T) {
+	updates := []FieldUpdate{
+		{ItemID: "I_1", Field: "Note", Value: "hello"},
+		{ItemID: "I_1", Field: "Status", Value: "done"},
+		{ItemID: "I_1", Field: "Points", Value: ""},
+		// rejected by the field's type
+		{ItemID: "I_1", Field: "Points", Value: "many"},
+		{ItemID: "I_2", Field: "Status", Value: "Blocked"},
+		// not in the project or without an item
+		{ItemID: "I_2", Field: "Missing", Value: "x"},
+		{Field: "Note", Value: "orphan"},
+	}
+
+	tests := []struct {
+		name   string
+		dryRun bool
+	}{
+		{name: "apply"},
+		{name: "dry-run", dryRun: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := useFakeGraphQL(t, func(query string) string {
+				if strings.Contains(query, "fields(first") {
+					return `{"data": {"node": {"fields": {"nodes": [
+						{"id": "F_NOTE", "name": "Note", "dataType": "TEXT"},
+						{"id": "F_STATUS", "name": "Status", "dataType": "SINGLE_SELECT", "options": [{"id": "O_DONE", "name": "Done"}]},
+						{"id": "F_POINTS", "name": "Points", "dataType": "NUMBER"}
+					]}}}}`
+				}
+				return `{"data": {}}`
+			})
+			defer func(dryRun bool) { DryRun = dryRun }(DryRun)
+			DryRun = tt.dryRun
+
+			proj := &config.ProjectConfig{GitHubProjectID: "PVT_1"}
+			got, err := UpdateItemFields(t.Context(), proj, updates)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != 3 {
+				t.Errorf("got %d values set, want the note, the status and the cleared points", got)
+			}
+
+			var mutations []string
+			for _, q := range fake.queries {
+				if strings.HasPrefix(q, "mutation") {
+					mutations = append(mutations, q)
+				}
+			}
+			if tt.dryRun != (len(mutations) == 0) {
+				t.Errorf("got mutations %v in dry-run mode %t", mutations, tt.dryRun)
+			}
+			for _, m := range mutations {
+				if n := strings.Count(m, "ProjectV2ItemFieldValue("); n != got {
+					t.Errorf("sent %d edits, counted %d: %s", n, got, m)
+				}
+			}
+		})
+	}
+}
@@ -1,82 +1,232 @@
 package github
 
 import (
+	"cmp"
 	"context"
-	"encoding/json"
+	"errors"
 	"fmt"
 	"jira2gh/pkg/config"
 	"jira2gh/pkg/jira"
-	"os/exec"
+	"jira2gh/pkg/provider"
+	"maps"
+	"regexp"
+	"slices"
+	"strconv"
 	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// prBatchSize is the number of PRs looked up per GraphQL query; each PR
+	// pulls its check contexts too, so keep this well below the node limit.
+	prBatchSize = 25
+	// mutationBatchSize is the number of project mutations sent per request.
+	mutationBatchSize = 50
 )
 
 var (
-	DryRun   bool
-	fieldIDs = map[string]string{}
+	DryRun bool
+	// Concurrency is the number of PR batches fetched in parallel
+	Concurrency = 4
+	// projectFields caches the fields by name, per project ID. The maps are
+	// never changed once cached, fieldsMu only guards projectFields itself.
+	projectFields = map[string]map[string]*projectField{}
+	fieldsMu      sync.Mutex
 )
 
+func init() {
+	provider.Register(provider.GitHub, prProvider{})
+}
+
+// prProvider fetches GitHub PR details for the provider package.
+type prProvider struct{}
+
+func (prProvider) FetchDetails(ctx context.Context, refs []provider.Ref) (map[string]provider.Details, error) {
+	urls := make([]string, len(refs))
+	for i, ref := range refs {
+		urls[i] = ref.URL
+	}
+	return FetchPRDetails(ctx, urls)
+}
+
+// FieldUpdate is a value to set on a project item field. Value is given as
+// text and converted to the field's type when written.
+type FieldUpdate struct {
+	ItemID string
+	Field  string
+	Value  string
+}
+
+// FetchViewerLogin returns the login of the user the token belongs to.
+func FetchViewerLogin(ctx context.Context) (string, error) {
+	var response struct {
+		Viewer struct {
+			Login string `json:"login"`
+		} `json:"viewer"`
+	}
+	if err := graphQL(ctx, `query { viewer { login } }`, nil, &response); err != nil {
+		return "", fmt.Errorf("failed to get GitHub user: %w", err)
+	}
+	if response.Viewer.Login == "" {
+		return "", fmt.Errorf("GitHub returned empty login")
+	}
+	return response.Viewer.Login, nil
+}
+
 func FetchGitHubPRs(ctx context.Context, proj *config.ProjectConfig) (map[string]jira.PR, error) {
-	// Run gh CLI to fetch project items
-	cmd := exec.CommandContext(ctx, "gh", "project", "item-list", proj.GitHubProject, "--owner", proj.GitHubOwner, "--format", "json", "--limit", "1000")
-	output, err := cmd.Output()
+	projID, err := ghGetProjectID(ctx, proj)
 	if err != nil {
-		if exitErr, ok := err.(*exec.ExitError); ok {
-			return nil, fmt.Errorf("failed to fetch GitHub project items: %w\nstderr: %s", err, string(exitErr.Stderr))
-		}
 		return nil, fmt.Errorf("failed to fetch GitHub project items: %w", err)
 	}
 
-	var response struct {
-		Items []struct {
-			ID      string `json:"id"`
-			Content struct {
-				URL string `json:"url"`
-			} `json:"content"`
-			FieldValues struct {
-				Nodes []struct {
-					Field struct {
-						Name string `json:"name"`
-					} `json:"field"`
-					Text string `json:"text"`
-				} `json:"nodes"`
-			} `json:"fieldValues"`
-		} `json:"items"`
-	}
-
-	if err := json.Unmarshal(output, &response); err != nil {
-		return nil, fmt.Errorf("failed to parse GitHub project items: %w", err)
-	}
-
-	// Extract PRs with metadata
+	const query = `query($id: ID!, $cursor: String) {
+  node(id: $id) {
+    ... on ProjectV2 {
+      items(first: 100, after: $cursor) {
+        pageInfo { hasNextPage endCursor }
+        nodes {
+          id
+          content {
+            ... on PullRequest { url title state author { login } }
+            ... on Issue { url title }
+            ... on DraftIssue { title body }
+          }
+          fieldValues(first: 50) {
+            nodes {
+              ... on ProjectV2ItemFieldTextValue {
+                text
+                field { ... on ProjectV2FieldCommon { name } }
+              }
+              ... on ProjectV2ItemFieldSingleSelectValue {
+                name
+                field { ... on ProjectV2FieldCommon { name } }
+              }
+              ... on ProjectV2ItemFieldDateValue {
+                date
+                field { ... on ProjectV2FieldCommon { name } }
+              }
+              ... on ProjectV2ItemFieldNumberValue {
+                number
+                field { ... on ProjectV2FieldCommon { name } }
+              }
+              ... on ProjectV2ItemFieldIterationValue {
+                title
+                field { ... on ProjectV2FieldCommon { name } }
+              }
+            }
+          }
+        }
+      }
+    }
+  }
+}`
+
 	prs := map[string]jira.PR{}
-	for _, item := range response.Items {
-		if item.Content.URL == "" {
-			continue
+	var cursor *string
+	for {
+		var response struct {
+			Node struct {
+				Items struct {
+					PageInfo struct {
+						HasNextPage bool   `json:"hasNextPage"`
+						EndCursor   string `json:"endCursor"`
+					} `json:"pageInfo"`
+					Nodes []struct {
+						ID      string `json:"id"`
+						Content struct {
+							URL    string `json:"url"`
+							Title  string `json:"title"`
+							Body   string `json:"body"`
+							State  string `json:"state"`
+							Author struct {
+								Login string `json:"login"`
+							} `json:"author"`
+						} `json:"content"`
+						FieldValues struct {
+							Nodes []itemFieldValue `json:"nodes"`
+						} `json:"fieldValues"`
+					} `json:"nodes"`
+				} `json:"items"`
+			} `json:"node"`
 		}
 
-		pr := jira.PR{
-			URL:    item.Content.URL,
-			ItemID: item.ID,
+		vars := map[string]any{"id": projID, "cursor": cursor}
+		if err := graphQL(ctx, query, vars, &response); err != nil {
+			return nil, fmt.Errorf("failed to fetch GitHub project items: %w", err)
 		}
 
-		// Extract custom field values
-		for _, fieldValue := range item.FieldValues.Nodes {
-			switch fieldValue.Field.Name {
-			case "Jira Feature":
-				pr.JiraFeature = fieldValue.Text
-			case "Jira Epic":
-				pr.JiraEpic = fieldValue.Text
-			case "Jira Issue":
-				pr.JiraIssue = fieldValue.Text
+		// Extract PRs with metadata
+		for _, item := range response.Node.Items.Nodes {
+			url := item.Content.URL
+			if url == "" {
+				// Change requests hosted elsewhere are draft items whose
+				// body starts with the URL
+				url = draftItemURL(item.Content.Body)
+			}
+			if url == "" {
+				continue
+			}
+
+			pr := jira.PR{
+				URL:    url,
+				Title:  item.Content.Title,
+				Author: item.Content.Author.Login,
+				State:  item.Content.State,
+				ItemID: item.ID,
+			}
+
+			// Extract custom field values
+			pr.Fields = map[string]string{}
+			for _, fieldValue := range item.FieldValues.Nodes {
+				if fieldValue.Field.Name != "" {
+					pr.Fields[fieldValue.Field.Name] = fieldValue.String()
+				}
+			}
+			for _, m := range proj.FieldMappings() {
+				switch m.Source {
+				case "jira.feature":
+					pr.JiraFeature = pr.Fields[m.Field]
+				case "jira.epic":
+					pr.JiraEpic = pr.Fields[m.Field]
+				case "jira.issue":
+					pr.JiraIssue = pr.Fields[m.Field]
+				}
 			}
+
+			prs[pr.URL] = pr
 		}
 
-		prs[pr.URL] = pr
+		pageInfo := response.Node.Items.PageInfo
+		if !pageInfo.HasNextPage {
+			break
+		}
+		cursor = &pageInfo.EndCursor
 	}
 
 	return prs, nil
 }
 
+// itemFieldValue is the value of a project item field of any type.
+type itemFieldValue struct {
+	Field struct {
+		Name string `json:"name"`
+	} `json:"field"`
+	Text   string   `json:"text"`
+	Name   string   `json:"name"`
+	Date   string   `json:"date"`
+	Number *float64 `json:"number"`
+	Title  string   `json:"title"`
+}
+
+// String returns the value as text, in the form valueLiteral accepts.
+func (v itemFieldValue) String() string {
+	if v.Number != nil {
+		return strconv.FormatFloat(*v.Number, 'f', -1, 64)
+	}
+	return cmp.Or(v.Text, v.Name, v.Date, v.Title)
+}
+
 func AddToProject(ctx context.Context, proj *config.ProjectConfig, prs []jira.PR) error {
 	prWord := "PRs"
 	if len(prs) == 1 {
@@ -84,20 +234,24 @@ func AddToProject(ctx context.Context, proj *config.ProjectConfig, prs []jira.PR
 	}
 	config.Printf("\nSyncing %s to project %s/%s...\n", prWord, proj.GitHubOwner, proj.GitHubProject)
 
-	projID, err := ghGetProjectID(ctx, proj)
-	if err != nil {
+	if _, err := ghGetProjectID(ctx, proj); err != nil {
 		return fmt.Errorf("could not get project ID: %v", err)
 	}
-	proj.GitHubProjectID = projID
 
-	for _, pr := range prs {
-		// Parse URL to get short format: owner/repo#number
-		shortPR := FormatPRShort(pr.URL)
-		err := ghItemAdd(ctx, proj, pr.URL, pr.Metadata())
+	total := 0
+	for _, batch := range chunks(prs, mutationBatchSize) {
+		added, err := ghItemAdd(ctx, proj, batch)
+		for _, pr := range added {
+			config.Printf("  ✓ %s\n", FormatPRShort(pr.URL))
+			_, transitions := pr.FieldValues(proj)
+			for _, t := range transitions {
+				config.Printf("      %s → %s (%s)\n", t.Field, t.Value, t.Rule)
+			}
+		}
+		total += len(added)
 		if err != nil {
-			return err
+			return fmt.Errorf("added %d of %d %s: %w", total, len(prs), prWord, err)
 		}
-		config.Printf("  ✓ %s\n", shortPR)
 	}
 
 	config.Printf("\n✓ Successfully added %d %s to the project!\n", len(prs), prWord)
@@ -111,23 +265,49 @@ func RemoveFromProject(ctx context.Context, proj *config.ProjectConfig, prs []ji
 	}
 	config.Printf("\nRemoving %s from project %s/%s...\n", prWord, proj.GitHubOwner, proj.GitHubProject)
 
-	for _, pr := range prs {
-		shortPR := FormatPRShort(pr.URL)
-		if DryRun {
-			config.Printf("  ✓ %s (dry-run)\n", shortPR)
-			continue
+	if DryRun {
+		for _, pr := range prs {
+			config.Printf("  ✓ %s (dry-run)\n", FormatPRShort(pr.URL))
 		}
+		config.Printf("\n✓ Successfully removed %d %s from the project!\n", len(prs), prWord)
+		return nil
+	}
 
-		_, err := exec.CommandContext(ctx, "gh", "project",
-			"item-delete", proj.GitHubProject,
-			"--owner", proj.GitHubOwner,
-			"--id", pr.ItemID,
-		).CombinedOutput()
+	projID, err := ghGetProjectID(ctx, proj)
+	if err != nil {
+		return fmt.Errorf("could not get project ID: %v", err)
+	}
 
-		if err != nil {
-			return fmt.Errorf("failed to remove %s: %v", shortPR, err)
+	// Items that could not be removed are reported once the others are
+	removed := 0
+	var failed []error
+	for _, batch := range chunks(prs, mutationBatchSize) {
+		var b strings.Builder
+		b.WriteString("mutation {\n")
+		for i, pr := range batch {
+			fmt.Fprintf(&b, "  d%d: deleteProjectV2Item(input: {projectId: %s, itemId: %s}) { deletedItemId }\n",
+				i, gqlString(projID), gqlString(pr.ItemID))
 		}
-		config.Printf("  ✓ %s\n", shortPR)
+		b.WriteString("}")
+
+		err := graphQL(ctx, b.String(), nil, nil)
+		var gqlErrs graphQLErrors
+		if err != nil && !errors.As(err, &gqlErrs) {
+			failed = append(failed, fmt.Errorf("failed to remove items: %v", err))
+			continue
+		}
+		for i, pr := range batch {
+			shortPR := FormatPRShort(pr.URL)
+			if itemErr := gqlErrs.forAlias(fmt.Sprintf("d%d", i)); itemErr != nil {
+				failed = append(failed, fmt.Errorf("failed to remove %s: %v", shortPR, itemErr))
+				continue
+			}
+			config.Printf("  ✓ %s\n", shortPR)
+			removed++
+		}
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("removed %d of %d %s: %w", removed, len(prs), prWord, errors.Join(failed...))
 	}
 
 	config.Printf("\n✓ Successfully removed %d %s from the project!\n", len(prs), prWord)
@@ -135,72 +315,310 @@ func RemoveFromProject(ctx context.Context, proj *config.ProjectConfig, prs []ji
 }
 
 func FormatPRShort(url string) string {
-	// URL format: https://github.com/owner/repo/pull/number
-	parts := strings.Split(url, "/")
-	if len(parts) >= 7 && parts[2] == "github.com" && parts[5] == "pull" {
-		return parts[3] + "/" + parts[4] + "#" + parts[6]
+	return provider.Short(url)
+}
+
+// draftItemURL returns the change request URL a draft item was created for,
+// or an empty string if the draft was not created by us.
+func draftItemURL(body string) string {
+	first, _, _ := strings.Cut(strings.TrimSpace(body), "\n")
+	if ref, ok := provider.Parse(strings.TrimSpace(first)); ok && ref.Kind != provider.GitHub {
+		return ref.URL
 	}
-	return url
+	return ""
 }
 
-// FetchPRDetails fetches PR details (author, state) from GitHub
-func FetchPRDetails(ctx context.Context, prURL string) (author, state string, err error) {
-	cmd := exec.CommandContext(ctx, "gh", "pr", "view", prURL, "--json", "author,state")
-	output, err := cmd.Output()
-	if err != nil {
-		return "", "", fmt.Errorf("failed to fetch PR details: %w", err)
+// FetchPRDetails fetches PR details (author, state, job summary) from GitHub
+// for the given PR URLs, batching several PRs into each GraphQL query and
+// running up to Concurrency queries at a time. Duplicate URLs are fetched once.
+// PRs that could not be fetched, including whole batches that failed, have Err
+// set; only a cancelled context fails the call.
+func FetchPRDetails(ctx context.Context, prURLs []string) (map[string]provider.Details, error) {
+	prURLs = slices.Clone(prURLs)
+	slices.Sort(prURLs)
+	prURLs = slices.Compact(prURLs)
+
+	batches := make(chan []string)
+	results := make(chan map[string]provider.Details)
+
+	workers := max(1, Concurrency)
+	var wg sync.WaitGroup
+	for range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for batch := range batches {
+				details := make(map[string]provider.Details, len(batch))
+				if err := fetchPRDetailsBatch(ctx, batch, details); err != nil {
+					for _, url := range batch {
+						details[url] = provider.Details{Err: err}
+					}
+				}
+				results <- details
+			}
+		}()
 	}
 
-	var response struct {
-		Author struct {
-			Login string `json:"login"`
-		} `json:"author"`
-		State string `json:"state"`
+	go func() {
+		defer close(batches)
+		for _, batch := range chunks(prURLs, prBatchSize) {
+			select {
+			case batches <- batch:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	details := make(map[string]provider.Details, len(prURLs))
+	for batchDetails := range results {
+		maps.Copy(details, batchDetails)
 	}
 
-	if err := json.Unmarshal(output, &response); err != nil {
-		return "", "", fmt.Errorf("failed to parse PR details: %w", err)
+	if err := ctx.Err(); err != nil {
+		return nil, err
 	}
+	return details, nil
+}
 
-	return response.Author.Login, response.State, nil
+// checkContext is a CheckRun or a StatusContext from a commit's check rollup.
+type checkContext struct {
+	Typename    string `json:"__typename"`
+	Name        string `json:"name"`
+	Status      string `json:"status"`
+	Conclusion  string `json:"conclusion"`
+	Context     string `json:"context"`
+	State       string `json:"state"`
+	Description string `json:"description"`
+	IsRequired  bool   `json:"isRequired"`
+	// DetailsURL is set for check runs and TargetURL for status contexts,
+	// e.g. the Prow job page
+	DetailsURL string `json:"detailsUrl"`
+	TargetURL  string `json:"targetUrl"`
 }
 
-// FetchJobSummary builds a short summary string for a PR based on its state,
-// required checks, and tide status.
-func FetchJobSummary(ctx context.Context, prURL string, prState string) (string, error) {
-	if prState == "MERGED" {
-		return "merged", nil
+type prNode struct {
+	ID        string    `json:"id"`
+	Title     string    `json:"title"`
+	State     string    `json:"state"`
+	Mergeable string    `json:"mergeable"`
+	IsDraft   bool      `json:"isDraft"`
+	UpdatedAt time.Time `json:"updatedAt"`
+	Author    struct {
+		Login string `json:"login"`
+	} `json:"author"`
+	Labels struct {
+		Nodes []struct {
+			Name string `json:"name"`
+		} `json:"nodes"`
+	} `json:"labels"`
+	Comments struct {
+		Nodes []struct {
+			Body string `json:"body"`
+		} `json:"nodes"`
+	} `json:"comments"`
+	ReviewRequests struct {
+		Nodes []struct {
+			// RequestedReviewer is a user or a team
+			RequestedReviewer struct {
+				Login        string `json:"login"`
+				CombinedSlug string `json:"combinedSlug"`
+			} `json:"requestedReviewer"`
+		} `json:"nodes"`
+	} `json:"reviewRequests"`
+	LatestReviews struct {
+		Nodes []struct {
+			State string `json:"state"`
+		} `json:"nodes"`
+	} `json:"latestReviews"`
+	// TimelineItems holds the last review request event
+	TimelineItems struct {
+		Nodes []struct {
+			CreatedAt time.Time `json:"createdAt"`
+		} `json:"nodes"`
+	} `json:"timelineItems"`
+	Commits struct {
+		Nodes []struct {
+			Commit struct {
+				OID               string `json:"oid"`
+				StatusCheckRollup *struct {
+					Contexts struct {
+						Nodes []checkContext `json:"nodes"`
+					} `json:"contexts"`
+				} `json:"statusCheckRollup"`
+			} `json:"commit"`
+		} `json:"nodes"`
+	} `json:"commits"`
+}
+
+// comments returns the bodies of the PR's most recent comments.
+func (n *prNode) comments() []string {
+	bodies := make([]string, len(n.Comments.Nodes))
+	for i, c := range n.Comments.Nodes {
+		bodies[i] = c.Body
 	}
-	if prState == "CLOSED" {
-		return "closed", nil
+	return bodies
+}
+
+func (n *prNode) labels() []string {
+	labels := make([]string, len(n.Labels.Nodes))
+	for i, l := range n.Labels.Nodes {
+		labels[i] = l.Name
 	}
+	return labels
+}
 
-	owner, repo, number := parsePRParts(prURL)
-	if owner == "" {
-		return "", fmt.Errorf("could not parse PR URL: %s", prURL)
+// review returns the PR's review status.
+func (n *prNode) review() provider.Review {
+	var r provider.Review
+	for _, req := range n.ReviewRequests.Nodes {
+		if name := cmp.Or(req.RequestedReviewer.Login, req.RequestedReviewer.CombinedSlug); name != "" {
+			r.Requested = append(r.Requested, name)
+		}
 	}
-	repoFull := owner + "/" + repo
+	for _, review := range n.LatestReviews.Nodes {
+		if r.States == nil {
+			r.States = map[string]int{}
+		}
+		r.States[review.State]++
+	}
+	if len(n.TimelineItems.Nodes) > 0 {
+		r.LastRequested = n.TimelineItems.Nodes[0].CreatedAt
+	}
+	r.Approvers = approvers(n.comments())
+	return r
+}
 
-	// Fetch required checks
-	cmd := exec.CommandContext(ctx, "gh", "pr", "checks", number, "-R", repoFull, "--required")
-	output, _ := cmd.Output()
+// headCommit returns the ID of the PR's last commit.
+func (n *prNode) headCommit() string {
+	if len(n.Commits.Nodes) == 0 {
+		return ""
+	}
+	return n.Commits.Nodes[0].Commit.OID
+}
+
+func (n *prNode) contexts() []checkContext {
+	if len(n.Commits.Nodes) == 0 || n.Commits.Nodes[0].Commit.StatusCheckRollup == nil {
+		return nil
+	}
+	return n.Commits.Nodes[0].Commit.StatusCheckRollup.Contexts.Nodes
+}
 
-	var passed, failed, running int
-	for _, line := range strings.Split(strings.TrimSpace(string(output)), "\n") {
-		if line == "" {
+// prFieldsQuery selects everything FetchPRDetails needs from a PR; the number
+// is needed twice for the isRequired arguments.
+const prFieldsQuery = `
+      id title state mergeable isDraft updatedAt author { login }
+      labels(first: 50) { nodes { name } }
+      comments(last: 100) { nodes { body } }
+      reviewRequests(first: 20) {
+        nodes { requestedReviewer { ... on User { login } ... on Team { combinedSlug } } }
+      }
+      latestReviews(first: 50) { nodes { state } }
+      timelineItems(last: 1, itemTypes: [REVIEW_REQUESTED_EVENT]) {
+        nodes { ... on ReviewRequestedEvent { createdAt } }
+      }
+      commits(last: 1) {
+        nodes {
+          commit {
+            oid
+            statusCheckRollup {
+              contexts(first: 100) {
+                nodes {
+                  __typename
+                  ... on CheckRun { name status conclusion detailsUrl isRequired(pullRequestNumber: %[1]s) }
+                  ... on StatusContext { context state description targetUrl isRequired(pullRequestNumber: %[1]s) }
+                }
+              }
+            }
+          }
+        }
+      }`
+
+func fetchPRDetailsBatch(ctx context.Context, prURLs []string, details map[string]provider.Details) error {
+	var b strings.Builder
+	aliases := map[string]string{}
+	b.WriteString("query {\n")
+	for i, url := range prURLs {
+		ref, ok := provider.Parse(url)
+		if _, err := strconv.Atoi(ref.Number); !ok || ref.Kind != provider.GitHub || err != nil {
+			details[url] = provider.Details{Err: fmt.Errorf("could not parse PR URL: %s", url)}
 			continue
 		}
-		fields := strings.Split(line, "\t")
-		if len(fields) < 2 {
+		owner, repo, _ := strings.Cut(ref.Repo, "/")
+		number := ref.Number
+		alias := fmt.Sprintf("pr%d", i)
+		aliases[alias] = url
+		fmt.Fprintf(&b, "  %s: repository(owner: %s, name: %s) {\n    pullRequest(number: %s) {%s\n    }\n  }\n",
+			alias, gqlString(owner), gqlString(repo), number, fmt.Sprintf(prFieldsQuery, number))
+	}
+	b.WriteString("}")
+
+	if len(aliases) == 0 {
+		return nil
+	}
+
+	var response map[string]*struct {
+		PullRequest *prNode `json:"pullRequest"`
+	}
+	err := graphQL(ctx, b.String(), nil, &response)
+	var gqlErrs graphQLErrors
+	if err != nil && !errors.As(err, &gqlErrs) {
+		return fmt.Errorf("failed to fetch PR details: %w", err)
+	}
+
+	for alias, url := range aliases {
+		repo := response[alias]
+		if repo == nil || repo.PullRequest == nil {
+			itemErr := gqlErrs.forAlias(alias)
+			if itemErr == nil {
+				itemErr = fmt.Errorf("PR not found")
+			}
+			details[url] = provider.Details{Err: fmt.Errorf("failed to fetch PR details: %w", itemErr)}
 			continue
 		}
-		switch fields[1] {
-		case "pass":
-			passed++
-		case "fail":
-			failed++
-		default:
-			running++
+		pr := repo.PullRequest
+		failed, retests := failedJobs(pr.contexts(), pr.comments())
+		details[url] = provider.Details{
+			Title:      pr.Title,
+			Author:     pr.Author.Login,
+			State:      pr.State,
+			JobSummary: jobSummary(pr.State, pr.contexts()),
+			Checks:     checksState(pr.contexts()),
+			FailedJobs: failed,
+			Retests:    retests,
+			Commit:     pr.headCommit(),
+			JobResults: jobResults(pr.contexts()),
+			Mergeable:  pr.Mergeable,
+			Draft:      pr.IsDraft,
+			UpdatedAt:  pr.UpdatedAt,
+			Labels:     pr.labels(),
+			Review:     pr.review(),
+		}
+	}
+
+	return nil
+}
+
+// jobSummary builds a short summary string for a PR based on its state,
+// required checks, and tide status.
+func jobSummary(prState string, contexts []checkContext) string {
+	if prState == "MERGED" {
+		return "merged"
+	}
+	if prState == "CLOSED" {
+		return "closed"
+	}
+
+	passed, failed, running := requiredChecks(contexts)
+	var tide *checkContext
+	for i, c := range contexts {
+		if c.Typename == "StatusContext" && c.Context == "tide" {
+			tide = &contexts[i]
 		}
 	}
 
@@ -220,16 +638,8 @@ func FetchJobSummary(ctx context.Context, prURL string, prState string) (string,
 		}
 	}
 
-	// Fetch tide status
-	cmd = exec.CommandContext(ctx, "gh", "pr", "checks", number, "-R", repoFull)
-	output, _ = cmd.Output()
-
-	for _, line := range strings.Split(string(output), "\n") {
-		if !strings.HasPrefix(line, "tide\t") {
-			continue
-		}
-		fields := strings.Split(line, "\t")
-		desc := fields[len(fields)-1]
+	if tide != nil {
+		desc := tide.Description
 
 		// Extract missing labels
 		if idx := strings.Index(desc, "Needs "); idx != -1 {
@@ -260,182 +670,391 @@ func FetchJobSummary(ctx context.Context, prURL string, prState string) (string,
 		if strings.Contains(desc, "In merge pool") {
 			parts = append(parts, "merging")
 		}
-
-		break
 	}
 
-	return strings.Join(parts, ", "), nil
+	return strings.Join(parts, ", ")
 }
 
-func parsePRParts(url string) (owner, repo, number string) {
-	parts := strings.Split(url, "/")
-	if len(parts) >= 7 && parts[2] == "github.com" && parts[5] == "pull" {
-		return parts[3], parts[4], parts[6]
+// requiredChecks counts the required checks that passed, failed or are still
+// running.
+func requiredChecks(contexts []checkContext) (passed, failed, running int) {
+	for _, c := range contexts {
+		if !c.IsRequired {
+			continue
+		}
+		switch checkBucket(c) {
+		case "pass":
+			passed++
+		case "fail":
+			failed++
+		default:
+			running++
+		}
 	}
-	return "", "", ""
+	return passed, failed, running
 }
 
-// UpdateItemField updates a text field for an item already in the project.
-func UpdateItemField(ctx context.Context, proj *config.ProjectConfig, itemID string, fieldName string, value string) error {
-	if DryRun || value == "" {
-		return nil
+// checksState reduces the required checks to their overall state.
+func checksState(contexts []checkContext) string {
+	passed, failed, running := requiredChecks(contexts)
+	switch {
+	case failed > 0:
+		return provider.ChecksFailed
+	case running > 0:
+		return provider.ChecksRunning
+	case passed > 0:
+		return provider.ChecksPassed
+	default:
+		return ""
 	}
+}
 
-	if proj.GitHubProjectID == "" {
-		projID, err := ghGetProjectID(ctx, proj)
-		if err != nil {
-			return err
+// failedJobs lists the failing required checks along with their links and
+// how often /test comments asked for each of them by name. It also returns
+// the number of /retest comments, which rerun every failed job at the time
+// and so cannot be told apart per job.
+func failedJobs(contexts []checkContext, comments []string) ([]provider.Job, int) {
+	retestAll := 0
+	retestJob := map[string]int{}
+	for _, body := range comments {
+		for line := range strings.Lines(body) {
+			fields := strings.Fields(line)
+			if len(fields) == 0 {
+				continue
+			}
+			switch fields[0] {
+			case "/retest", "/retest-required":
+				retestAll++
+			case "/test":
+				for _, name := range fields[1:] {
+					if name == "all" {
+						retestAll++
+						continue
+					}
+					retestJob[name]++
+				}
+			}
 		}
-		proj.GitHubProjectID = projID
 	}
 
-	if _, found := fieldIDs[fieldName]; !found {
-		fieldID, err := ghGetFieldID(ctx, proj, fieldName)
-		if err != nil {
-			return err
+	var jobs []provider.Job
+	for _, c := range contexts {
+		if !c.IsRequired || checkBucket(c) != "fail" {
+			continue
 		}
-		fieldIDs[fieldName] = fieldID
+		short := jobName(c)
+		jobs = append(jobs, provider.Job{
+			Name:    short,
+			URL:     cmp.Or(c.DetailsURL, c.TargetURL),
+			Retests: retestJob[short],
+		})
 	}
+	slices.SortFunc(jobs, func(a, b provider.Job) int { return strings.Compare(a.Name, b.Name) })
+	return jobs, retestAll
+}
 
-	if fieldIDs[fieldName] == "" {
-		return nil
+// approvalNotifier starts the comment Prow's approve plugin keeps up to date
+// on each PR until it is approved. It names the approvers to ask from the
+// OWNERS files still missing an approval, e.g. "please assign
+// [alice](https://github.com/alice), [bob](https://github.com/bob) for
+// approval" or "please ask for approval from alice".
+const approvalNotifier = "[APPROVALNOTIFIER]"
+
+var (
+	suggestedApprovers = regexp.MustCompile(`please (?:assign|ask for approval from) (.+?)(?: for approval)?(?:\. |\.?$)`)
+	markdownLink       = regexp.MustCompile(`\[([^\]]+)\]\(`)
+)
+
+// approvers returns the approvers whose approval is still needed, according
+// to the latest approval notifier comment.
+func approvers(comments []string) []string {
+	for i := len(comments) - 1; i >= 0; i-- {
+		if !strings.HasPrefix(comments[i], approvalNotifier) {
+			continue
+		}
+		var names []string
+		for line := range strings.Lines(comments[i]) {
+			m := suggestedApprovers.FindStringSubmatch(strings.TrimSpace(line))
+			if m == nil {
+				continue
+			}
+			if links := markdownLink.FindAllStringSubmatch(m[1], -1); len(links) > 0 {
+				for _, link := range links {
+					names = append(names, link[1])
+				}
+				continue
+			}
+			for name := range strings.SplitSeq(m[1], ",") {
+				if name = strings.Trim(name, " *@"); name != "" {
+					names = append(names, name)
+				}
+			}
+		}
+		return names
+	}
+	return nil
+}
+
+// jobResults returns the state of each required check by job name.
+func jobResults(contexts []checkContext) map[string]string {
+	results := map[string]string{}
+	for _, c := range contexts {
+		if !c.IsRequired {
+			continue
+		}
+		switch checkBucket(c) {
+		case "pass":
+			results[jobName(c)] = provider.ChecksPassed
+		case "fail":
+			results[jobName(c)] = provider.ChecksFailed
+		default:
+			results[jobName(c)] = provider.ChecksRunning
+		}
 	}
+	return results
+}
 
-	return ghItemEdit(ctx, proj.GitHubProjectID, itemID, "text", fieldIDs[fieldName], value)
+// jobName returns the short name of a check. Prow contexts look like
+// ci/prow/e2e-aws, and are run by /test e2e-aws.
+func jobName(c checkContext) string {
+	name := cmp.Or(c.Name, c.Context)
+	return name[strings.LastIndex(name, "/")+1:]
 }
 
-func ghItemAdd(ctx context.Context, proj *config.ProjectConfig, prURL string, metadata map[string]string) error {
-	if DryRun {
-		return nil
+// checkBucket maps a check run or status context to pass, fail or pending,
+// the same way `gh pr checks` does.
+func checkBucket(c checkContext) string {
+	if c.Typename == "StatusContext" {
+		switch c.State {
+		case "SUCCESS":
+			return "pass"
+		case "FAILURE", "ERROR":
+			return "fail"
+		default:
+			return "pending"
+		}
 	}
 
-	out, err := exec.CommandContext(ctx, "gh", "project",
-		"item-add", proj.GitHubProject,
-		"--owner", proj.GitHubOwner,
-		"--url", prURL,
-		"--format", "json",
-	).CombinedOutput()
-	if err != nil {
-		return fmt.Errorf("failed to add item to project: %v", err)
+	if c.Status != "COMPLETED" {
+		return "pending"
+	}
+	switch c.Conclusion {
+	case "SUCCESS", "NEUTRAL", "SKIPPED":
+		return "pass"
+	case "FAILURE", "ERROR", "TIMED_OUT", "CANCELLED", "ACTION_REQUIRED", "STARTUP_FAILURE":
+		return "fail"
+	default:
+		return "pending"
 	}
+}
 
-	item := map[string]any{}
-	if err := json.Unmarshal(out, &item); err != nil {
-		return fmt.Errorf("could not unmarshal response from json: %v", err)
+// UpdateItemFields sets fields on items already in the project, sending
+// the mutations in batches. Empty values clear the field and unknown fields
+// are skipped. It returns the number of values set, or that would be set in
+// dry-run mode.
+func UpdateItemFields(ctx context.Context, proj *config.ProjectConfig, updates []FieldUpdate) (int, error) {
+	fields, err := ghGetFields(ctx, proj)
+	if err != nil {
+		return 0, err
 	}
 
-	itemID := item["id"].(string)
-	for key, value := range metadata {
-		if len(key) == 0 || len(value) == 0 {
+	var valid []FieldUpdate
+	for _, u := range updates {
+		if u.ItemID == "" || fields[u.Field] == nil {
 			continue
 		}
+		valid = append(valid, u)
+	}
 
-		if _, found := fieldIDs[key]; !found {
-			fieldID, err := ghGetFieldID(ctx, proj, key)
-			if err != nil {
-				// Skip fields that don't exist in the project
-				config.Printf("  Warning: field '%s' not found in project, skipping\n", key)
-				fieldIDs[key] = "" // Mark as checked but not found
-				continue
-			}
-			fieldIDs[key] = fieldID
-		}
-
-		// Skip if field was previously not found
-		if fieldIDs[key] == "" {
-			continue
-		}
+	projID, err := ghGetProjectID(ctx, proj)
+	if err != nil {
+		return 0, err
+	}
 
-		err := ghItemEdit(ctx, proj.GitHubProjectID, itemID, "text", fieldIDs[key], value)
+	updated := 0
+	for _, batch := range chunks(valid, mutationBatchSize) {
+		edits, err := ghItemEdit(ctx, projID, fields, batch)
 		if err != nil {
-			return fmt.Errorf("failed to edit item: %v", err)
+			return updated, err
 		}
+		updated += edits
 	}
 
-	return nil
+	return updated, nil
 }
 
-func ghGetProjectID(ctx context.Context, proj *config.ProjectConfig) (string, error) {
-	type ghProject struct {
-		ID string `json:"id"`
+// ghItemAdd adds a batch of PRs to the project and sets their fields right
+// away, so that no item is left without the fields identifying it. It returns
+// the PRs that were added, even when it fails part way.
+func ghItemAdd(ctx context.Context, proj *config.ProjectConfig, prs []jira.PR) ([]jira.PR, error) {
+	if DryRun {
+		return prs, nil
 	}
 
-	out, err := exec.CommandContext(ctx, "gh", "project",
-		"view", proj.GitHubProject,
-		"--owner", proj.GitHubOwner,
-		"--format", "json",
-	).CombinedOutput()
-	if err != nil {
-		return "", fmt.Errorf("failed to get project ID: %v", err)
+	// Resolve PR URLs to node IDs; change requests hosted elsewhere are
+	// added as draft items instead
+	var b strings.Builder
+	b.WriteString("query {\n")
+	for i, pr := range prs {
+		if ref, ok := provider.Parse(pr.URL); ok && ref.Kind != provider.GitHub {
+			continue
+		}
+		fmt.Fprintf(&b, "  c%d: resource(url: %s) { ... on PullRequest { id } ... on Issue { id } }\n", i, gqlString(pr.URL))
 	}
+	b.WriteString("}")
 
-	var p ghProject
-	if err := json.Unmarshal(out, &p); err != nil {
-		return "", fmt.Errorf("could not unmarshal response from json: %v", err)
+	// PRs that cannot be resolved are reported as failed, the others are
+	// still added
+	var resources map[string]*struct {
+		ID string `json:"id"`
+	}
+	var resolveErrs graphQLErrors
+	if strings.Contains(b.String(), "resource(") {
+		err := graphQL(ctx, b.String(), nil, &resources)
+		if err != nil && !errors.As(err, &resolveErrs) {
+			return nil, fmt.Errorf("failed to resolve PRs: %v", err)
+		}
 	}
 
-	return p.ID, nil
-}
+	var failed []string
+	unresolved := map[int]bool{}
+	b.Reset()
+	b.WriteString("mutation {\n")
+	for i, pr := range prs {
+		if ref, ok := provider.Parse(pr.URL); ok && ref.Kind != provider.GitHub {
+			title := ref.Short()
+			if pr.Title != "" {
+				title += ": " + pr.Title
+			}
+			fmt.Fprintf(&b, "  a%d: addProjectV2DraftIssue(input: {projectId: %s, title: %s, body: %s}) { projectItem { id } }\n",
+				i, gqlString(proj.GitHubProjectID), gqlString(title), gqlString(pr.URL))
+			continue
+		}
+		alias := fmt.Sprintf("c%d", i)
+		res := resources[alias]
+		if res == nil || res.ID == "" {
+			resErr := cmp.Or(resolveErrs.forAlias(alias), errors.New("could not resolve it"))
+			failed = append(failed, fmt.Sprintf("%s: %v", FormatPRShort(pr.URL), resErr))
+			unresolved[i] = true
+			continue
+		}
+		fmt.Fprintf(&b, "  a%d: addProjectV2ItemById(input: {projectId: %s, contentId: %s}) { item { id } }\n",
+			i, gqlString(proj.GitHubProjectID), gqlString(res.ID))
+	}
+	b.WriteString("}")
+
+	var added map[string]*struct {
+		Item struct {
+			ID string `json:"id"`
+		} `json:"item"`
+		ProjectItem struct {
+			ID string `json:"id"`
+		} `json:"projectItem"`
+	}
+	var gqlErrs graphQLErrors
+	if len(unresolved) < len(prs) {
+		err := graphQL(ctx, b.String(), nil, &added)
+		if err != nil && !errors.As(err, &gqlErrs) {
+			return nil, fmt.Errorf("failed to add item to project: %v", err)
+		}
+	}
 
-// ghGetFieldID retrieves the field ID for a given field name from the GitHub project
-func ghGetFieldID(ctx context.Context, proj *config.ProjectConfig, fieldName string) (string, error) {
-	// Run gh CLI to fetch project fields
-	cmd := exec.CommandContext(ctx, "gh", "project",
-		"field-list", proj.GitHubProject,
-		"--owner", proj.GitHubOwner,
-		"--format", "json",
-	)
-	output, err := cmd.Output()
-	if err != nil {
-		if exitErr, ok := err.(*exec.ExitError); ok {
-			return "", fmt.Errorf("failed to fetch project fields: %w\nstderr: %s", err, string(exitErr.Stderr))
+	// Items GitHub did not add are reported once the others have their
+	// fields set
+	var done []jira.PR
+	itemIDs := map[string]string{}
+	for i, pr := range prs {
+		if unresolved[i] {
+			continue
+		}
+		alias := fmt.Sprintf("a%d", i)
+		item := added[alias]
+		if item == nil || cmp.Or(item.Item.ID, item.ProjectItem.ID) == "" {
+			itemErr := cmp.Or(gqlErrs.forAlias(alias), errors.New("no item returned"))
+			failed = append(failed, fmt.Sprintf("%s: %v", FormatPRShort(pr.URL), itemErr))
+			continue
 		}
-		return "", fmt.Errorf("failed to fetch project fields: %w", err)
+		itemIDs[pr.URL] = cmp.Or(item.Item.ID, item.ProjectItem.ID)
+		done = append(done, pr)
 	}
 
-	var response struct {
-		Fields []struct {
-			ID   string `json:"id"`
-			Name string `json:"name"`
-		} `json:"fields"`
+	if len(done) > 0 {
+		if err := setItemFields(ctx, proj, done, itemIDs); err != nil {
+			return done, fmt.Errorf("failed to set the fields of added items, they may not be recognised until the next sync: %v", err)
+		}
+	}
+	if len(failed) > 0 {
+		return done, fmt.Errorf("failed to add item to project: %s", strings.Join(failed, "; "))
 	}
+	return done, nil
+}
 
-	if err := json.Unmarshal(output, &response); err != nil {
-		return "", fmt.Errorf("failed to parse project fields: %w", err)
+// setItemFields sets the project fields of newly added items.
+func setItemFields(ctx context.Context, proj *config.ProjectConfig, prs []jira.PR, itemIDs map[string]string) error {
+	fields, err := ghGetFields(ctx, proj)
+	if err != nil {
+		return err
 	}
 
-	// Find the field with matching name
-	for _, field := range response.Fields {
-		if field.Name == fieldName {
-			return field.ID, nil
+	var updates []FieldUpdate
+	missing := map[string]bool{}
+	for _, pr := range prs {
+		values, _ := pr.FieldValues(proj)
+		for _, key := range slices.Sorted(maps.Keys(values)) {
+			value := values[key]
+			if len(key) == 0 || len(value) == 0 {
+				continue
+			}
+			if _, found := fields[key]; !found {
+				// Skip fields that don't exist in the project, warning once
+				if !missing[key] {
+					config.Printf("  Warning: field '%s' not found in project, skipping\n", key)
+					missing[key] = true
+				}
+				continue
+			}
+			updates = append(updates, FieldUpdate{ItemID: itemIDs[pr.URL], Field: key, Value: value})
 		}
 	}
 
-	return "", fmt.Errorf("field '%s' not found in project", fieldName)
+	for _, batch := range chunks(updates, mutationBatchSize) {
+		if _, err := ghItemEdit(ctx, proj.GitHubProjectID, fields, batch); err != nil {
+			return fmt.Errorf("failed to edit item: %v", err)
+		}
+	}
+	return nil
 }
 
-func ghItemEdit(ctx context.Context, projectID, itemID, fieldType, fieldID, value string) error {
-	if DryRun {
-		return nil
+func ghGetProjectID(ctx context.Context, proj *config.ProjectConfig) (string, error) {
+	if proj.GitHubProjectID != "" {
+		return proj.GitHubProjectID, nil
 	}
 
-	valueArg := ""
-	switch fieldType {
-	case "text":
-		valueArg = "--text"
-	case "option":
-		valueArg = "--single-select-option-id"
-	default:
-		return fmt.Errorf("unknown field type: %s", fieldType)
+	number, err := strconv.Atoi(proj.GitHubProject)
+	if err != nil {
+		return "", fmt.Errorf("invalid project number %q: %v", proj.GitHubProject, err)
 	}
 
-	_, err := exec.
-		CommandContext(ctx, "gh", "project", "item-edit",
-			"--project-id", projectID,
-			"--id", itemID,
-			"--field-id", fieldID,
-			valueArg, value,
-		).CombinedOutput()
+	var response struct {
+		RepositoryOwner *struct {
+			ProjectV2 *struct {
+				ID string `json:"id"`
+			} `json:"projectV2"`
+		} `json:"repositoryOwner"`
+	}
+	const query = `query($owner: String!, $number: Int!) {
+  repositoryOwner(login: $owner) {
+    ... on ProjectV2Owner { projectV2(number: $number) { id } }
+  }
+}`
+	vars := map[string]any{"owner": proj.GitHubOwner, "number": number}
+	if err := graphQL(ctx, query, vars, &response); err != nil {
+		return "", fmt.Errorf("failed to get project ID: %v", err)
+	}
+	if response.RepositoryOwner == nil || response.RepositoryOwner.ProjectV2 == nil {
+		return "", fmt.Errorf("project %s/%s not found", proj.GitHubOwner, proj.GitHubProject)
+	}
 
-	return err
+	proj.GitHubProjectID = response.RepositoryOwner.ProjectV2.ID
+	return proj.GitHubProjectID, nil
 }
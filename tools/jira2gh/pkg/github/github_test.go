@@ -0,0 +1,403 @@
+package github
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"jira2gh/pkg/config"
+	"jira2gh/pkg/httpclient"
+	"jira2gh/pkg/jira"
+	"jira2gh/pkg/provider"
+	"net/http"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fakeGraphQL answers GraphQL requests with the response respond returns for
+// their query, without any network. Requests may be sent concurrently.
+type fakeGraphQL struct {
+	mu      sync.Mutex
+	respond func(query string) string
+	queries []string
+}
+
+func (f *fakeGraphQL) Send(req *http.Request) (*httpclient.Response, error) {
+	body, err := io.ReadAll(req.Body)
+	if err != nil {
+		return nil, err
+	}
+	var gql struct {
+		Query string `json:"query"`
+	}
+	if err := json.Unmarshal(body, &gql); err != nil {
+		return nil, err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.queries = append(f.queries, gql.Query)
+	return &httpclient.Response{StatusCode: http.StatusOK, Header: http.Header{}, Body: []byte(f.respond(gql.Query))}, nil
+}
+
+// useFakeGraphQL sends all requests of the test to a fakeGraphQL.
+func useFakeGraphQL(t *testing.T, respond func(query string) string) *fakeGraphQL {
+	t.Helper()
+	fake := &fakeGraphQL{respond: respond}
+	httpclient.SetBackend(fake)
+	Token = "test"
+	ResetCache()
+	t.Cleanup(func() {
+		httpclient.SetBackend(httpclient.Network{})
+		Token = ""
+		ResetCache()
+	})
+	return fake
+}
+
+func TestItemAddSkipsUnresolvablePRs(t *testing.T) {
+	fake := useFakeGraphQL(t, func(query string) string {
+		switch {
+		case strings.Contains(query, "resource(url"):
+			return `{"data": {"c0": {"id": "PR_1"}, "c1": null, "c2": {"id": "PR_3"}},
+				"errors": [{"type": "NOT_FOUND", "message": "Could not resolve to a node", "path": ["c1"]}]}`
+		case strings.Contains(query, "addProjectV2ItemById"):
+			return `{"data": {"a0": {"item": {"id": "ITEM_1"}}, "a2": {"item": {"id": "ITEM_3"}}}}`
+		case strings.Contains(query, "fields(first"):
+			return `{"data": {"node": {"fields": {"nodes": []}}}}`
+		}
+		t.Fatalf("unexpected query: %s", query)
+		return ""
+	})
+
+	proj := &config.ProjectConfig{GitHubOwner: "o", GitHubProject: "1", GitHubProjectID: "PVT_1", Fields: []config.FieldMapping{{Field: "Title", Source: "pr.title"}}}
+	prs := []jira.PR{
+		{URL: "https://github.com/o/r/pull/1"},
+		{URL: "https://github.com/o/r/pull/2"},
+		{URL: "https://github.com/o/r/pull/3"},
+	}
+	done, err := ghItemAdd(t.Context(), proj, prs)
+	if err == nil || !strings.Contains(err.Error(), "o/r#2: Could not resolve to a node") {
+		t.Errorf("got error %v, want o/r#2 reported as not resolved", err)
+	}
+	if len(done) != 2 || done[0].URL != prs[0].URL || done[1].URL != prs[2].URL {
+		t.Errorf("got added %v, want #1 and #3", done)
+	}
+	for _, q := range fake.queries {
+		if strings.Contains(q, "addProjectV2ItemById") && strings.Contains(q, "a1:") {
+			t.Errorf("unresolved PR was added: %s", q)
+		}
+	}
+}
+
+func TestItemAddAddsMergeRequestsAsDrafts(t *testing.T) {
+	fake := useFakeGraphQL(t, func(query string) string {
+		switch {
+		case strings.Contains(query, "resource(url"):
+			return `{"data": {"c1": {"id": "PR_2"}}}`
+		case strings.Contains(query, "addProjectV2"):
+			return `{"data": {"a0": {"projectItem": {"id": "DRAFT_1"}}, "a1": {"item": {"id": "ITEM_2"}}}}`
+		case strings.Contains(query, "fields(first"):
+			return `{"data": {"node": {"fields": {"nodes": []}}}}`
+		}
+		t.Fatalf("unexpected query: %s", query)
+		return ""
+	})
+
+	proj := &config.ProjectConfig{GitHubOwner: "o", GitHubProject: "1", GitHubProjectID: "PVT_1"}
+	prs := []jira.PR{
+		{URL: "https://gitlab.com/g/p/-/merge_requests/1", Title: "Add GitLab support"},
+		{URL: "https://github.com/o/r/pull/2"},
+	}
+	done, err := ghItemAdd(t.Context(), proj, prs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(done) != 2 {
+		t.Errorf("got added %v, want both", done)
+	}
+	drafted := false
+	for _, q := range fake.queries {
+		if strings.Contains(q, "resource(url") && strings.Contains(q, "gitlab.com") {
+			t.Errorf("merge request was resolved on GitHub: %s", q)
+		}
+		if strings.Contains(q, `a0: addProjectV2DraftIssue(input: {projectId: "PVT_1", title: "g/p!1: Add GitLab support", body: "https://gitlab.com/g/p/-/merge_requests/1"})`) {
+			drafted = true
+		}
+	}
+	if !drafted {
+		t.Errorf("merge request not added as a draft with its URL in the body: %v", fake.queries)
+	}
+	if draftItemURL("https://gitlab.com/g/p/-/merge_requests/1") != prs[0].URL {
+		t.Errorf("draft body not recognised as the merge request it was created for")
+	}
+}
+
+func TestRemoveFromProjectContinuesAfterFailures(t *testing.T) {
+	fake := useFakeGraphQL(t, func(query string) string {
+		if strings.Contains(query, "d1: deleteProjectV2Item") {
+			return `{"data": {"d0": {"deletedItemId": "ITEM_0"}, "d1": null},
+				"errors": [{"type": "NOT_FOUND", "message": "Could not resolve to a node", "path": ["d1"]}]}`
+		}
+		return `{"data": {}}`
+	})
+
+	proj := &config.ProjectConfig{GitHubOwner: "o", GitHubProject: "1", GitHubProjectID: "PVT_1"}
+	var prs []jira.PR
+	for i := range mutationBatchSize + 1 {
+		prs = append(prs, jira.PR{URL: fmt.Sprintf("https://github.com/o/r/pull/%d", i), ItemID: fmt.Sprintf("ITEM_%d", i)})
+	}
+	err := RemoveFromProject(t.Context(), proj, prs)
+	if err == nil || !strings.Contains(err.Error(), "removed 50 of 51 PRs") || !strings.Contains(err.Error(), "o/r#1: Could not resolve to a node") {
+		t.Errorf("got error %v, want o/r#1 reported as not removed", err)
+	}
+	if len(fake.queries) != 2 {
+		t.Errorf("got %d mutations, want the second batch sent after the first failed", len(fake.queries))
+	}
+}
+
+func TestFetchPRDetailsFetchesSharedPRsOnce(t *testing.T) {
+	prQuery := regexp.MustCompile(`(pr\d+): repository\(owner: "o", name: "r"\) \{\s*pullRequest\(number: (\d+)\)`)
+	fake := useFakeGraphQL(t, func(query string) string {
+		data := map[string]any{}
+		for _, m := range prQuery.FindAllStringSubmatch(query, -1) {
+			data[m[1]] = map[string]any{"pullRequest": map[string]any{"id": "PR_" + m[2], "state": "OPEN"}}
+		}
+		resp, _ := json.Marshal(map[string]any{"data": data})
+		return string(resp)
+	})
+
+	// PRs 20 to 30 are both linked from Jira and in the project, as sync
+	// passes them, and span several batches
+	url := func(n int) string { return fmt.Sprintf("https://github.com/o/r/pull/%d", n) }
+	var urls []string
+	for n := 1; n <= 30; n++ {
+		urls = append(urls, url(n))
+	}
+	for n := 20; n <= 60; n++ {
+		urls = append(urls, url(n))
+	}
+	details, err := FetchPRDetails(t.Context(), urls)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fetched := map[string]int{}
+	for _, q := range fake.queries {
+		for _, m := range prQuery.FindAllStringSubmatch(q, -1) {
+			fetched[m[2]]++
+		}
+	}
+	for n := 1; n <= 60; n++ {
+		if got := fetched[strconv.Itoa(n)]; got != 1 {
+			t.Errorf("o/r#%d fetched %d times, want once", n, got)
+		}
+		if d, found := details[url(n)]; !found || d.Err != nil || d.State != "OPEN" {
+			t.Errorf("got details %+v for o/r#%d, want an open PR", d, n)
+		}
+	}
+}
+
+func TestSearchPRsByTitle(t *testing.T) {
+	searchRE := regexp.MustCompile(`(s\d+): search\(query: "((?:[^"\\]|\\.)*)", type: ISSUE, first: 100(, after: "([^"]*)")?\)`)
+	var searches []string
+	fake := useFakeGraphQL(t, func(query string) string {
+		data := map[string]any{}
+		for _, m := range searchRE.FindAllStringSubmatch(query, -1) {
+			q, _ := strconv.Unquote(`"` + m[2] + `"`)
+			searches = append(searches, q+" "+m[4])
+			result := map[string]any{"pageInfo": map[string]any{"hasNextPage": false}, "nodes": []any{}}
+			switch {
+			case strings.Contains(q, `"K-1" OR`) && m[4] == "":
+				// the first page of the first group goes on, and finds a PR
+				// the other repo's search finds too
+				result["pageInfo"] = map[string]any{"hasNextPage": true, "endCursor": "c1"}
+				result["nodes"] = []any{map[string]any{"url": "https://github.com/o/r/pull/1", "title": "K-1: first"}}
+			case m[4] == "c1":
+				result["nodes"] = []any{map[string]any{"url": "https://github.com/o/r/pull/2", "title": "K-2: second"}}
+			case strings.Contains(q, `"K-13"`):
+				result["nodes"] = []any{map[string]any{"url": "https://github.com/o/r/pull/1", "title": "K-1: first"}}
+			}
+			data[m[1]] = result
+		}
+		resp, _ := json.Marshal(map[string]any{"data": data})
+		return string(resp)
+	})
+
+	var terms []string
+	for i := 1; i <= 13; i++ {
+		terms = append(terms, fmt.Sprintf("K-%d", i))
+	}
+	found, err := SearchPRsByTitle(t.Context(), []string{"o/r", "o/s"}, terms)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// up to six terms, i.e. five ORs, per search and repo, then the next
+	// page of the first one
+	want := []string{
+		`repo:o/r is:pr in:title "K-1" OR "K-2" OR "K-3" OR "K-4" OR "K-5" OR "K-6" `,
+		`repo:o/r is:pr in:title "K-7" OR "K-8" OR "K-9" OR "K-10" OR "K-11" OR "K-12" `,
+		`repo:o/r is:pr in:title "K-13" `,
+		`repo:o/s is:pr in:title "K-1" OR "K-2" OR "K-3" OR "K-4" OR "K-5" OR "K-6" `,
+		`repo:o/s is:pr in:title "K-7" OR "K-8" OR "K-9" OR "K-10" OR "K-11" OR "K-12" `,
+		`repo:o/s is:pr in:title "K-13" `,
+		`repo:o/r is:pr in:title "K-1" OR "K-2" OR "K-3" OR "K-4" OR "K-5" OR "K-6" c1`,
+		`repo:o/s is:pr in:title "K-1" OR "K-2" OR "K-3" OR "K-4" OR "K-5" OR "K-6" c1`,
+	}
+	if !slices.Equal(searches, want) {
+		t.Errorf("got searches\n%s\nwant\n%s", strings.Join(searches, "\n"), strings.Join(want, "\n"))
+	}
+	if len(fake.queries) != 2 {
+		t.Errorf("got %d queries, want the first pages in one and the next pages in another", len(fake.queries))
+	}
+	wantFound := []FoundPR{
+		{URL: "https://github.com/o/r/pull/1", Title: "K-1: first"},
+		{URL: "https://github.com/o/r/pull/2", Title: "K-2: second"},
+	}
+	if !slices.Equal(found, wantFound) {
+		t.Errorf("got PRs %v, want %v", found, wantFound)
+	}
+}
+
+func TestCheckBucket(t *testing.T) {
+	tests := []struct {
+		name string
+		c    checkContext
+		want string
+	}{
+		{"status success", checkContext{Typename: "StatusContext", State: "SUCCESS"}, "pass"},
+		{"status failure", checkContext{Typename: "StatusContext", State: "FAILURE"}, "fail"},
+		{"status error", checkContext{Typename: "StatusContext", State: "ERROR"}, "fail"},
+		{"status pending", checkContext{Typename: "StatusContext", State: "PENDING"}, "pending"},
+		{"check in progress", checkContext{Typename: "CheckRun", Status: "IN_PROGRESS"}, "pending"},
+		{"check success", checkContext{Typename: "CheckRun", Status: "COMPLETED", Conclusion: "SUCCESS"}, "pass"},
+		{"check skipped", checkContext{Typename: "CheckRun", Status: "COMPLETED", Conclusion: "SKIPPED"}, "pass"},
+		{"check failure", checkContext{Typename: "CheckRun", Status: "COMPLETED", Conclusion: "FAILURE"}, "fail"},
+		{"check timed out", checkContext{Typename: "CheckRun", Status: "COMPLETED", Conclusion: "TIMED_OUT"}, "fail"},
+		{"check cancelled", checkContext{Typename: "CheckRun", Status: "COMPLETED", Conclusion: "CANCELLED"}, "fail"},
+		{"check stale", checkContext{Typename: "CheckRun", Status: "COMPLETED", Conclusion: "STALE"}, "pending"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := checkBucket(tt.c); got != tt.want {
+				t.Errorf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFailedJobs(t *testing.T) {
+	failed := func(context, url string) checkContext {
+		return checkContext{Typename: "StatusContext", Context: context, State: "FAILURE", IsRequired: true, TargetURL: url}
+	}
+	contexts := []checkContext{
+		failed("ci/prow/unit", "https://prow/unit"),
+		failed("ci/prow/e2e-aws", "https://prow/e2e-aws"),
+		{Typename: "CheckRun", Name: "lint", Status: "COMPLETED", Conclusion: "FAILURE", IsRequired: true, DetailsURL: "https://ci/lint"},
+		{Typename: "StatusContext", Context: "ci/prow/images", State: "SUCCESS", IsRequired: true},
+		{Typename: "StatusContext", Context: "ci/prow/e2e-optional", State: "FAILURE"},
+	}
+
+	tests := []struct {
+		name        string
+		comments    []string
+		wantJobs    []provider.Job
+		wantRetests int
+	}{
+		{
+			name: "no comments",
+			wantJobs: []provider.Job{
+				{Name: "e2e-aws", URL: "https://prow/e2e-aws"},
+				{Name: "lint", URL: "https://ci/lint"},
+				{Name: "unit", URL: "https://prow/unit"},
+			},
+		},
+		{
+			name: "tests by name are counted per job",
+			comments: []string{
+				"/test e2e-aws",
+				"/test e2e-aws unit\n/test e2e-aws",
+				"/test images",
+			},
+			wantJobs: []provider.Job{
+				{Name: "e2e-aws", URL: "https://prow/e2e-aws", Retests: 3},
+				{Name: "lint", URL: "https://ci/lint"},
+				{Name: "unit", URL: "https://prow/unit", Retests: 1},
+			},
+		},
+		{
+			name: "retests are counted once per PR",
+			comments: []string{
+				"/retest",
+				"Flaky again.\n/retest-required",
+				"/test all",
+				"not a /retest",
+			},
+			wantJobs: []provider.Job{
+				{Name: "e2e-aws", URL: "https://prow/e2e-aws"},
+				{Name: "lint", URL: "https://ci/lint"},
+				{Name: "unit", URL: "https://prow/unit"},
+			},
+			wantRetests: 3,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			jobs, retests := failedJobs(contexts, tt.comments)
+			if !slices.Equal(jobs, tt.wantJobs) {
+				t.Errorf("got jobs %v, want %v", jobs, tt.wantJobs)
+			}
+			if retests != tt.wantRetests {
+				t.Errorf("got %d retests of the PR, want %d", retests, tt.wantRetests)
+			}
+		})
+	}
+}
+
+func TestApprovers(t *testing.T) {
+	const notApproved = "[APPROVALNOTIFIER] This PR is **NOT APPROVED**\n\n" +
+		"This pull-request has been approved by: *<a href=\"https://github.com/o/r/pull/1#\" title=\"Author self-approved\">alice</a>*\n"
+
+	tests := []struct {
+		name     string
+		comments []string
+		want     []string
+	}{
+		{
+			name:     "no notifier",
+			comments: []string{"/lgtm", "please assign bob for approval"},
+		},
+		{
+			name: "assign by link",
+			comments: []string{notApproved + "**Once this PR has been reviewed and has the lgtm label**, please assign " +
+				"[bob](https://github.com/bob), [carol](https://github.com/carol) for approval. For more information see the Code Review Process.\n"},
+			want: []string{"bob", "carol"},
+		},
+		{
+			name:     "ask by name",
+			comments: []string{notApproved + "**Once this PR has been reviewed and has the lgtm label**, please ask for approval from bob, @carol.\n"},
+			want:     []string{"bob", "carol"},
+		},
+		{
+			name: "latest notifier",
+			comments: []string{
+				notApproved + "please assign [bob](https://github.com/bob) for approval.\n",
+				"/approve",
+				"[APPROVALNOTIFIER] This PR is **APPROVED**\n\nThis pull-request has been approved by: *alice*, *bob*\n",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := approvers(tt.comments); !slices.Equal(got, tt.want) {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
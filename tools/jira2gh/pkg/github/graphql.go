@@ -0,0 +1,225 @@
+package github
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"encoding/json"
+	"fmt"
+	"jira2gh/pkg/config"
+	"jira2gh/pkg/httpclient"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	graphQLEndpoint = "https://api.github.com/graphql"
+	// rateLimitReserve is the number of points left at which we stop sending
+	// requests and wait for the primary rate limit window to reset.
+	rateLimitReserve = 50
+)
+
+// Token is the GitHub token used to authenticate GraphQL requests.
+var Token string
+
+// limiter tracks GitHub's rate limit headers across concurrent requests.
+var limiter = &rateLimiter{}
+
+type rateLimiter struct {
+	mu        sync.Mutex
+	remaining int
+	reset     time.Time
+	// pausedUntil is set after a secondary rate limit to hold back every
+	// worker, not just the one that got the error.
+	pausedUntil time.Time
+}
+
+// wait blocks until it is reasonable to send another request.
+func (l *rateLimiter) wait(ctx context.Context) error {
+	l.mu.Lock()
+	until := l.pausedUntil
+	if !l.reset.IsZero() && l.remaining < rateLimitReserve && l.reset.After(until) {
+		until = l.reset
+	}
+	l.mu.Unlock()
+
+	d := time.Until(until)
+	if d <= 0 {
+		return nil
+	}
+	config.Stderr("  GitHub rate limit reached, waiting %s...\n", d.Round(time.Second))
+
+	return httpclient.Sleep(ctx, d)
+}
+
+// update records the primary rate limit state from the response headers.
+func (l *rateLimiter) update(h http.Header) {
+	remaining, err := strconv.Atoi(h.Get("X-RateLimit-Remaining"))
+	if err != nil {
+		return
+	}
+	reset, err := strconv.ParseInt(h.Get("X-RateLimit-Reset"), 10, 64)
+	if err != nil {
+		return
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.remaining = remaining
+	l.reset = time.Unix(reset, 0)
+}
+
+// pause holds back all requests for d.
+func (l *rateLimiter) pause(d time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if until := time.Now().Add(d); until.After(l.pausedUntil) {
+		l.pausedUntil = until
+	}
+}
+
+// rateLimitDelay is the httpclient.RateLimitFunc of GraphQL requests. It
+// keeps the limiter up to date with every response and returns how long to
+// wait if one of GitHub's rate limits was hit.
+func rateLimitDelay(resp *httpclient.Response, attempt int) time.Duration {
+	limiter.update(resp.Header)
+	if resp.StatusCode == http.StatusOK {
+		// GraphQL reports an exhausted primary limit as a 200 with an error
+		if bytes.Contains(resp.Body, []byte(`"RATE_LIMITED"`)) {
+			return cmp.Or(httpclient.Delay(resp.Header), httpclient.Backoff(attempt))
+		}
+		return 0
+	}
+	delay := secondaryRateLimitDelay(resp, attempt)
+	if delay > 0 {
+		// Hold back the other workers as well
+		limiter.pause(min(delay, httpclient.MaxWait))
+	}
+	return delay
+}
+
+// secondaryRateLimitDelay returns how long to back off if the response
+// signals a secondary rate limit, or zero if it does not.
+func secondaryRateLimitDelay(resp *httpclient.Response, attempt int) time.Duration {
+	if resp.StatusCode != http.StatusForbidden && resp.StatusCode != http.StatusTooManyRequests {
+		return 0
+	}
+	if delay := httpclient.Delay(resp.Header); delay > 0 {
+		return delay
+	}
+	if resp.StatusCode == http.StatusTooManyRequests || bytes.Contains(bytes.ToLower(resp.Body), []byte("secondary rate limit")) {
+		// GitHub asks to wait at least a minute when no header is given
+		return min(time.Minute<<min(attempt-1, 10), httpclient.MaxWait)
+	}
+	return 0
+}
+
+type graphQLError struct {
+	Type    string `json:"type"`
+	Message string `json:"message"`
+	Path    []any  `json:"path"`
+}
+
+// graphQLErrors is returned when the response carries errors. Data may still
+// have been decoded for the parts of the query that succeeded, which matters
+// for batched queries where a single missing PR should not fail the batch.
+type graphQLErrors []graphQLError
+
+func (e graphQLErrors) Error() string {
+	msgs := make([]string, 0, len(e))
+	for _, err := range e {
+		msgs = append(msgs, err.Message)
+	}
+	return "graphql: " + strings.Join(msgs, "; ")
+}
+
+// forAlias returns the error reported for the top-level field with the given
+// alias, or nil if there is none.
+func (e graphQLErrors) forAlias(alias string) error {
+	for _, err := range e {
+		if len(err.Path) > 0 && err.Path[0] == alias {
+			return fmt.Errorf("%s", err.Message)
+		}
+	}
+	return nil
+}
+
+// graphQL sends a query to the GitHub GraphQL API and decodes the data into out.
+func graphQL(ctx context.Context, query string, vars map[string]any, out any) error {
+	if Token == "" {
+		return fmt.Errorf("GitHub token is not set")
+	}
+
+	reqBody, err := json.Marshal(map[string]any{
+		"query":     query,
+		"variables": vars,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to marshal graphql request: %w", err)
+	}
+
+	if err := limiter.wait(ctx); err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", graphQLEndpoint, bytes.NewReader(reqBody))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Authorization", "bearer "+Token)
+	req.Header.Set("Content-Type", "application/json")
+
+	// Queries are safe to repeat after any failure, mutations only when
+	// GitHub has not acted on them; httpclient does all the retrying
+	mutation := strings.HasPrefix(strings.TrimSpace(query), "mutation")
+	resp, err := httpclient.DoWith(req, !mutation, rateLimitDelay)
+	if err != nil {
+		return err
+	}
+	respBody := resp.Body
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status code %d: %s", resp.StatusCode, string(respBody))
+	}
+
+	var envelope struct {
+		Data   json.RawMessage `json:"data"`
+		Errors graphQLErrors   `json:"errors"`
+	}
+	if err := json.Unmarshal(respBody, &envelope); err != nil {
+		return fmt.Errorf("failed to parse graphql response: %w", err)
+	}
+
+	if out != nil && len(envelope.Data) > 0 && string(envelope.Data) != "null" {
+		if err := json.Unmarshal(envelope.Data, out); err != nil {
+			return fmt.Errorf("failed to parse graphql data: %w", err)
+		}
+	}
+
+	if len(envelope.Errors) > 0 {
+		return envelope.Errors
+	}
+
+	return nil
+}
+
+// gqlString renders s as a GraphQL string literal; JSON string escaping is a
+// valid subset of GraphQL's.
+func gqlString(s string) string {
+	b, _ := json.Marshal(s)
+	return string(b)
+}
+
+// chunks splits items into slices of at most size elements.
+func chunks[T any](items []T, size int) [][]T {
+	var out [][]T
+	for len(items) > size {
+		out = append(out, items[:size])
+		items = items[size:]
+	}
+	if len(items) > 0 {
+		out = append(out, items)
+	}
+	return out
+}
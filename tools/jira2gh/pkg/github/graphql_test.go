@@ -0,0 +1,63 @@
+package github
+
+import (
+	"jira2gh/pkg/httpclient"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestSecondaryRateLimitDelay(t *testing.T) {
+	tests := []struct {
+		name    string
+		resp    httpclient.Response
+		attempt int
+		want    time.Duration
+	}{
+		{
+			name:    "not limited",
+			resp:    httpclient.Response{StatusCode: http.StatusOK},
+			attempt: 1,
+		},
+		{
+			name:    "forbidden for another reason",
+			resp:    httpclient.Response{StatusCode: http.StatusForbidden, Body: []byte(`{"message": "Resource not accessible by integration"}`)},
+			attempt: 1,
+		},
+		{
+			name:    "retry after",
+			resp:    httpclient.Response{StatusCode: http.StatusForbidden, Header: http.Header{"Retry-After": {"30"}}},
+			attempt: 1,
+			want:    30 * time.Second,
+		},
+		{
+			name:    "secondary rate limit without a header",
+			resp:    httpclient.Response{StatusCode: http.StatusForbidden, Body: []byte(`{"message": "You have exceeded a Secondary Rate Limit."}`)},
+			attempt: 1,
+			want:    time.Minute,
+		},
+		{
+			name:    "too many requests backs off further with every attempt",
+			resp:    httpclient.Response{StatusCode: http.StatusTooManyRequests},
+			attempt: 3,
+			want:    4 * time.Minute,
+		},
+		{
+			name:    "capped at the longest wait",
+			resp:    httpclient.Response{StatusCode: http.StatusTooManyRequests},
+			attempt: 10,
+			want:    httpclient.MaxWait,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.resp.Header == nil {
+				tt.resp.Header = http.Header{}
+			}
+			if got := secondaryRateLimitDelay(&tt.resp, tt.attempt); got != tt.want {
+				t.Errorf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
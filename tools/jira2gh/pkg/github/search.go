@@ -0,0 +1,131 @@
+package github
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+const (
+	// searchBatchSize is the number of searches sent per GraphQL query.
+	searchBatchSize = 20
+	// searchMaxOr is the number of OR operators GitHub allows in a search.
+	searchMaxOr = 5
+)
+
+// FoundPR is a PR returned by a search.
+type FoundPR struct {
+	URL   string `json:"url"`
+	Title string `json:"title"`
+}
+
+// CommitPRs returns the URLs of the open PRs of a repo, given as owner/repo,
+// whose branch contains the commit.
+func CommitPRs(ctx context.Context, repo, sha string) ([]string, error) {
+	owner, name, _ := strings.Cut(repo, "/")
+	const query = `query($owner: String!, $name: String!, $oid: GitObjectID!) {
+  repository(owner: $owner, name: $name) {
+    object(oid: $oid) {
+      ... on Commit { associatedPullRequests(first: 20) { nodes { url state } } }
+    }
+  }
+}`
+	var response struct {
+		Repository struct {
+			Object *struct {
+				AssociatedPullRequests struct {
+					Nodes []struct {
+						URL   string `json:"url"`
+						State string `json:"state"`
+					} `json:"nodes"`
+				} `json:"associatedPullRequests"`
+			} `json:"object"`
+		} `json:"repository"`
+	}
+	vars := map[string]any{"owner": owner, "name": name, "oid": sha}
+	if err := graphQL(ctx, query, vars, &response); err != nil {
+		return nil, fmt.Errorf("failed to look up the PRs of commit %s: %w", sha, err)
+	}
+	if response.Repository.Object == nil {
+		return nil, nil
+	}
+	var urls []string
+	for _, pr := range response.Repository.Object.AssociatedPullRequests.Nodes {
+		if pr.State == "OPEN" {
+			urls = append(urls, pr.URL)
+		}
+	}
+	return urls, nil
+}
+
+// SearchPRsByTitle returns the PRs of the repos whose title contains one of
+// the terms, e.g. Jira keys, following every page of search results.
+func SearchPRsByTitle(ctx context.Context, repos []string, terms []string) ([]FoundPR, error) {
+	type search struct {
+		query  string
+		cursor *string
+	}
+	var pending []search
+	for _, repo := range repos {
+		for _, group := range chunks(terms, searchMaxOr+1) {
+			quoted := make([]string, len(group))
+			for i, term := range group {
+				quoted[i] = strconv.Quote(term)
+			}
+			pending = append(pending, search{query: fmt.Sprintf("repo:%s is:pr in:title %s", repo, strings.Join(quoted, " OR "))})
+		}
+	}
+
+	seen := map[string]bool{}
+	var found []FoundPR
+	for len(pending) > 0 {
+		batch := pending[:min(len(pending), searchBatchSize)]
+		pending = pending[len(batch):]
+
+		var b strings.Builder
+		b.WriteString("query {\n")
+		for i, s := range batch {
+			after := ""
+			if s.cursor != nil {
+				after = ", after: " + gqlString(*s.cursor)
+			}
+			fmt.Fprintf(&b, "  s%d: search(query: %s, type: ISSUE, first: 100%s) { pageInfo { hasNextPage endCursor } nodes { ... on PullRequest { url title } } }\n",
+				i, gqlString(s.query), after)
+		}
+		b.WriteString("}")
+
+		var response map[string]*struct {
+			PageInfo struct {
+				HasNextPage bool   `json:"hasNextPage"`
+				EndCursor   string `json:"endCursor"`
+			} `json:"pageInfo"`
+			Nodes []FoundPR `json:"nodes"`
+		}
+		err := graphQL(ctx, b.String(), nil, &response)
+		var gqlErrs graphQLErrors
+		if err != nil && !errors.As(err, &gqlErrs) {
+			return nil, fmt.Errorf("failed to search PRs: %w", err)
+		}
+
+		for i, s := range batch {
+			result := response[fmt.Sprintf("s%d", i)]
+			if result == nil {
+				return nil, fmt.Errorf("failed to search PRs with %q: %v", s.query, gqlErrs.forAlias(fmt.Sprintf("s%d", i)))
+			}
+			for _, pr := range result.Nodes {
+				if pr.URL != "" && !seen[pr.URL] {
+					seen[pr.URL] = true
+					found = append(found, pr)
+				}
+			}
+			if result.PageInfo.HasNextPage {
+				cursor := result.PageInfo.EndCursor
+				pending = append(pending, search{query: s.query, cursor: &cursor})
+			}
+		}
+	}
+
+	return found, nil
+}
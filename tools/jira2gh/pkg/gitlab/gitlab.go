@@ -0,0 +1,206 @@
+package gitlab
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"jira2gh/pkg/httpclient"
+	"jira2gh/pkg/provider"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	// Token is sent as PRIVATE-TOKEN; public MRs can be read without one
+	Token string
+	// Concurrency is the number of MRs fetched in parallel
+	Concurrency = 4
+)
+
+func init() {
+	provider.Register(provider.GitLab, mrProvider{})
+}
+
+// mrProvider fetches GitLab MR details for the provider package.
+type mrProvider struct{}
+
+func (mrProvider) FetchDetails(ctx context.Context, refs []provider.Ref) (map[string]provider.Details, error) {
+	details := make(map[string]provider.Details, len(refs))
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, max(1, Concurrency))
+	for _, ref := range refs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			d := fetchMRDetails(ctx, ref)
+			mu.Lock()
+			details[ref.URL] = d
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+	return details, nil
+}
+
+// fetchMRDetails fetches author, state, pipeline status and, for open MRs,
+// approvals of a single MR.
+func fetchMRDetails(ctx context.Context, ref provider.Ref) provider.Details {
+	mrURL := fmt.Sprintf("https://%s/api/v4/projects/%s/merge_requests/%s", ref.Host, url.PathEscape(ref.Repo), ref.Number)
+	var mr struct {
+		Title        string    `json:"title"`
+		State        string    `json:"state"`
+		Draft        bool      `json:"draft"`
+		HasConflicts bool      `json:"has_conflicts"`
+		UpdatedAt    time.Time `json:"updated_at"`
+		Labels       []string  `json:"labels"`
+		Author       struct {
+			Username string `json:"username"`
+		} `json:"author"`
+		Reviewers []struct {
+			Username string `json:"username"`
+		} `json:"reviewers"`
+		HeadPipeline *struct {
+			Status string `json:"status"`
+		} `json:"head_pipeline"`
+	}
+	if err := getJSON(ctx, mrURL, &mr); err != nil {
+		return provider.Details{Err: fmt.Errorf("failed to fetch MR details: %w", err)}
+	}
+
+	state := normalizeState(mr.State)
+	mergeable := provider.Mergeable
+	if mr.HasConflicts {
+		mergeable = provider.Conflicting
+	}
+	var review provider.Review
+	if state == "OPEN" {
+		// Reviewers stay listed once they approved, so only those who did not
+		// are waited on
+		var approvals struct {
+			ApprovedBy []struct {
+				User struct {
+					Username string `json:"username"`
+				} `json:"user"`
+			} `json:"approved_by"`
+		}
+		if err := getJSON(ctx, mrURL+"/approvals", &approvals); err != nil {
+			return provider.Details{Err: fmt.Errorf("failed to fetch MR approvals: %w", err)}
+		}
+		approved := map[string]bool{}
+		for _, a := range approvals.ApprovedBy {
+			approved[a.User.Username] = true
+		}
+		if len(approved) > 0 {
+			review.States = map[string]int{"APPROVED": len(approved)}
+		}
+		for _, r := range mr.Reviewers {
+			if !approved[r.Username] {
+				review.Requested = append(review.Requested, r.Username)
+			}
+		}
+	}
+	pipeline := ""
+	if mr.HeadPipeline != nil {
+		pipeline = mr.HeadPipeline.Status
+	}
+
+	return provider.Details{
+		Title:      mr.Title,
+		Author:     mr.Author.Username,
+		State:      state,
+		JobSummary: jobSummary(state, pipeline, mr.Draft),
+		Checks:     checksState(pipeline),
+		Mergeable:  mergeable,
+		Draft:      mr.Draft,
+		UpdatedAt:  mr.UpdatedAt,
+		Labels:     mr.Labels,
+		Review:     review,
+	}
+}
+
+// getJSON sends a GET request to the GitLab API and decodes the response into
+// out.
+func getJSON(ctx context.Context, apiURL string, out any) error {
+	req, err := http.NewRequestWithContext(ctx, "GET", apiURL, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	if Token != "" {
+		req.Header.Set("PRIVATE-TOKEN", Token)
+	}
+
+	resp, err := httpclient.Do(req)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status code %d: %s", resp.StatusCode, string(resp.Body))
+	}
+	if err := json.Unmarshal(resp.Body, out); err != nil {
+		return fmt.Errorf("failed to parse response: %w", err)
+	}
+	return nil
+}
+
+// checksState maps a pipeline status to the overall checks state.
+func checksState(pipeline string) string {
+	switch pipeline {
+	case "success":
+		return provider.ChecksPassed
+	case "failed":
+		return provider.ChecksFailed
+	case "created", "waiting_for_resource", "preparing", "pending", "running", "scheduled":
+		return provider.ChecksRunning
+	default:
+		return ""
+	}
+}
+
+// normalizeState maps GitLab MR states to the GitHub ones used throughout.
+func normalizeState(state string) string {
+	switch state {
+	case "opened":
+		return "OPEN"
+	case "merged":
+		return "MERGED"
+	case "closed", "locked":
+		return "CLOSED"
+	default:
+		return strings.ToUpper(state)
+	}
+}
+
+// jobSummary builds a short summary string for an MR based on its state and
+// the status of its head pipeline.
+func jobSummary(state, pipeline string, draft bool) string {
+	if state == "MERGED" {
+		return "merged"
+	}
+	if state == "CLOSED" {
+		return "closed"
+	}
+
+	var parts []string
+	switch pipeline {
+	case "":
+	case "success":
+		parts = append(parts, "pipeline passed")
+	case "failed":
+		parts = append(parts, "pipeline failed")
+	case "created", "waiting_for_resource", "preparing", "pending", "running", "scheduled":
+		parts = append(parts, "pipeline running")
+	default:
+		parts = append(parts, "pipeline "+pipeline)
+	}
+	if draft {
+		parts = append(parts, "draft")
+	}
+	return strings.Join(parts, ", ")
+}
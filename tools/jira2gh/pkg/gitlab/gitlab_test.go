@@ -0,0 +1,105 @@
+package gitlab
+
+import (
+	"jira2gh/pkg/httpclient"
+	"jira2gh/pkg/provider"
+	"maps"
+	"net/http"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// fakeGitLab answers GitLab API requests with the responses for their path,
+// and with 404 for any other path.
+type fakeGitLab struct {
+	responses map[string]string
+	requests  []string
+}
+
+func (f *fakeGitLab) Send(req *http.Request) (*httpclient.Response, error) {
+	path := req.URL.EscapedPath()
+	f.requests = append(f.requests, path)
+	body, found := f.responses[path]
+	if !found {
+		return &httpclient.Response{StatusCode: http.StatusNotFound, Header: http.Header{}, Body: []byte(`{"message": "404 Not found"}`)}, nil
+	}
+	return &httpclient.Response{StatusCode: http.StatusOK, Header: http.Header{}, Body: []byte(body)}, nil
+}
+
+func TestFetchMRDetailsReview(t *testing.T) {
+	const (
+		mrPath        = "/api/v4/projects/group%2Frepo/merge_requests/1"
+		approvalsPath = mrPath + "/approvals"
+	)
+	ref := provider.Ref{Host: "gitlab.com", Repo: "group/repo", Number: "1", URL: "https://gitlab.com/group/repo/-/merge_requests/1"}
+
+	tests := []struct {
+		name          string
+		responses     map[string]string
+		wantRequested []string
+		wantStates    map[string]int
+		wantRequests  []string
+		wantErr       bool
+	}{
+		{
+			name: "approved reviewers are not waited on",
+			responses: map[string]string{
+				mrPath:        `{"state": "opened", "reviewers": [{"username": "alice"}, {"username": "bob"}]}`,
+				approvalsPath: `{"approved_by": [{"user": {"username": "bob"}}, {"user": {"username": "carol"}}]}`,
+			},
+			wantRequested: []string{"alice"},
+			wantStates:    map[string]int{"APPROVED": 2},
+			wantRequests:  []string{mrPath, approvalsPath},
+		},
+		{
+			name: "no approvals",
+			responses: map[string]string{
+				mrPath:        `{"state": "opened", "reviewers": [{"username": "alice"}]}`,
+				approvalsPath: `{"approved_by": []}`,
+			},
+			wantRequested: []string{"alice"},
+			wantRequests:  []string{mrPath, approvalsPath},
+		},
+		{
+			name: "merged MRs are not looked at for approvals",
+			responses: map[string]string{
+				mrPath: `{"state": "merged", "reviewers": [{"username": "alice"}]}`,
+			},
+			wantRequests: []string{mrPath},
+		},
+		{
+			name: "approvals that cannot be fetched",
+			responses: map[string]string{
+				mrPath: `{"state": "opened", "reviewers": [{"username": "alice"}]}`,
+			},
+			wantRequests: []string{mrPath, approvalsPath},
+			wantErr:      true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := &fakeGitLab{responses: tt.responses}
+			httpclient.SetBackend(fake)
+			t.Cleanup(func() { httpclient.SetBackend(httpclient.Network{}) })
+
+			d := fetchMRDetails(t.Context(), ref)
+			if (d.Err != nil) != tt.wantErr {
+				t.Fatalf("got error %v, want error %v", d.Err, tt.wantErr)
+			}
+			if d.Err != nil && !strings.Contains(d.Err.Error(), "approvals") {
+				t.Errorf("got error %v, want it to be about the approvals", d.Err)
+			}
+			if !slices.Equal(d.Review.Requested, tt.wantRequested) {
+				t.Errorf("got requested %v, want %v", d.Review.Requested, tt.wantRequested)
+			}
+			if !maps.Equal(d.Review.States, tt.wantStates) {
+				t.Errorf("got states %v, want %v", d.Review.States, tt.wantStates)
+			}
+			if !slices.Equal(fake.requests, tt.wantRequests) {
+				t.Errorf("got requests %v, want %v", fake.requests, tt.wantRequests)
+			}
+		})
+	}
+}
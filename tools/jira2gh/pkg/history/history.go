@@ -0,0 +1,143 @@
+// Package history keeps the results of each PR's CI jobs across syncs, so
+// that jobs which both pass and fail on the same commit can be told apart
+// from jobs that are really broken.
+package history
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"jira2gh/pkg/provider"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+)
+
+// Retention is how long the results of a PR are kept after it was last seen.
+const Retention = 30 * 24 * time.Hour
+
+// Result is a job result observed during a sync. Only changes are recorded,
+// so a result holds until the next one.
+type Result struct {
+	Commit string    `json:"commit"`
+	Result string    `json:"result"`
+	At     time.Time `json:"at"`
+}
+
+// PRHistory holds the job results of one PR.
+type PRHistory struct {
+	LastSeen time.Time           `json:"last_seen"`
+	Jobs     map[string][]Result `json:"jobs"`
+}
+
+// History holds the job results of all PRs, by URL.
+type History struct {
+	PRs map[string]*PRHistory `json:"prs"`
+
+	mu   sync.Mutex
+	path string
+}
+
+// Load reads the history from path. A missing file is an empty history.
+func Load(path string) (*History, error) {
+	h := &History{PRs: map[string]*PRHistory{}, path: path}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return h, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read job history: %w", err)
+	}
+	if err := json.Unmarshal(data, h); err != nil {
+		return nil, fmt.Errorf("failed to parse job history %s: %w", path, err)
+	}
+	if h.PRs == nil {
+		h.PRs = map[string]*PRHistory{}
+	}
+	return h, nil
+}
+
+// Save writes the history back to the file it was loaded from, dropping the
+// PRs not seen within Retention.
+func (h *History) Save() error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for url, pr := range h.PRs {
+		if time.Since(pr.LastSeen) > Retention {
+			delete(h.PRs, url)
+		}
+	}
+	data, err := json.MarshalIndent(h, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to write job history: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(h.path), 0o755); err != nil {
+		return fmt.Errorf("failed to write job history: %w", err)
+	}
+	// Write and rename so that an interrupted run cannot truncate the file
+	tmp := h.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return fmt.Errorf("failed to write job history: %w", err)
+	}
+	if err := os.Rename(tmp, h.path); err != nil {
+		return fmt.Errorf("failed to write job history: %w", err)
+	}
+	return nil
+}
+
+// Record adds the job results of a PR at the given commit. Results other
+// than provider.ChecksPassed and ChecksFailed, e.g. of running jobs, are
+// ignored.
+func (h *History) Record(url, commit string, results map[string]string, now time.Time) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	pr := h.PRs[url]
+	if pr == nil {
+		pr = &PRHistory{Jobs: map[string][]Result{}}
+		h.PRs[url] = pr
+	}
+	pr.LastSeen = now
+	for job, result := range results {
+		if result != provider.ChecksPassed && result != provider.ChecksFailed {
+			continue
+		}
+		past := pr.Jobs[job]
+		if n := len(past); n > 0 && past[n-1].Commit == commit && past[n-1].Result == result {
+			continue
+		}
+		pr.Jobs[job] = append(past, Result{Commit: commit, Result: result, At: now})
+	}
+}
+
+// Flips returns how often each job of a PR switched between passing and
+// failing without the commit changing, for the jobs that did.
+func (h *History) Flips(url string) map[string]int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	flips := map[string]int{}
+	pr := h.PRs[url]
+	if pr == nil {
+		return flips
+	}
+	for job, results := range pr.Jobs {
+		for i := 1; i < len(results); i++ {
+			if results[i].Commit == results[i-1].Commit && results[i].Result != results[i-1].Result {
+				flips[job]++
+			}
+		}
+	}
+	return flips
+}
+
+// FlakyJobs returns the sorted names of a PR's jobs that flipped between
+// passing and failing on the same commit.
+func (h *History) FlakyJobs(url string) []string {
+	return slices.Sorted(maps.Keys(h.Flips(url)))
+}
@@ -0,0 +1,132 @@
+package history
+
+import (
+	"jira2gh/pkg/provider"
+	"maps"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+const prURL = "https://github.com/o/r/pull/1"
+
+func TestFlips(t *testing.T) {
+	type sync struct {
+		commit  string
+		results map[string]string
+	}
+	pass, fail, running := provider.ChecksPassed, provider.ChecksFailed, provider.ChecksRunning
+
+	tests := []struct {
+		name      string
+		syncs     []sync
+		wantFlips map[string]int
+	}{
+		{
+			name: "steady results",
+			syncs: []sync{
+				{"a", map[string]string{"unit": fail, "e2e": pass}},
+				{"a", map[string]string{"unit": fail, "e2e": pass}},
+			},
+			wantFlips: map[string]int{},
+		},
+		{
+			name: "fixed by a new commit",
+			syncs: []sync{
+				{"a", map[string]string{"unit": fail}},
+				{"b", map[string]string{"unit": pass}},
+			},
+			wantFlips: map[string]int{},
+		},
+		{
+			name: "flips on the same commit",
+			syncs: []sync{
+				{"a", map[string]string{"unit": fail, "e2e": fail}},
+				{"a", map[string]string{"unit": pass, "e2e": fail}},
+				{"a", map[string]string{"unit": fail, "e2e": fail}},
+				{"b", map[string]string{"unit": pass, "e2e": pass}},
+				{"b", map[string]string{"unit": pass, "e2e": fail}},
+			},
+			wantFlips: map[string]int{"unit": 2, "e2e": 1},
+		},
+		{
+			name: "running jobs are ignored",
+			syncs: []sync{
+				{"a", map[string]string{"unit": fail}},
+				{"a", map[string]string{"unit": running}},
+				{"a", map[string]string{"unit": fail}},
+			},
+			wantFlips: map[string]int{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := &History{PRs: map[string]*PRHistory{}}
+			now := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+			for _, s := range tt.syncs {
+				h.Record(prURL, s.commit, s.results, now)
+				now = now.Add(time.Hour)
+			}
+
+			if got := h.Flips(prURL); !maps.Equal(got, tt.wantFlips) {
+				t.Errorf("got flips %v, want %v", got, tt.wantFlips)
+			}
+			wantFlaky := slices.Sorted(maps.Keys(tt.wantFlips))
+			if got := h.FlakyJobs(prURL); !slices.Equal(got, wantFlaky) {
+				t.Errorf("got flaky jobs %v, want %v", got, wantFlaky)
+			}
+		})
+	}
+}
+
+func TestFlipsUnknownPR(t *testing.T) {
+	h := &History{PRs: map[string]*PRHistory{}}
+	if got := h.FlakyJobs(prURL); len(got) != 0 {
+		t.Errorf("got flaky jobs %v for an unknown PR", got)
+	}
+}
+
+func TestRecordOnlyChanges(t *testing.T) {
+	h := &History{PRs: map[string]*PRHistory{}}
+	now := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	h.Record(prURL, "a", map[string]string{"unit": provider.ChecksFailed}, now)
+	h.Record(prURL, "a", map[string]string{"unit": provider.ChecksFailed}, now.Add(time.Hour))
+	h.Record(prURL, "b", map[string]string{"unit": provider.ChecksFailed}, now.Add(2*time.Hour))
+
+	pr := h.PRs[prURL]
+	if got := len(pr.Jobs["unit"]); got != 2 {
+		t.Errorf("got %d results, want 2", got)
+	}
+	if !pr.LastSeen.Equal(now.Add(2 * time.Hour)) {
+		t.Errorf("got last seen %s, want the last sync", pr.LastSeen)
+	}
+}
+
+func TestSaveDropsOldPRs(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history", "jobs.json")
+	h, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	results := map[string]string{"unit": provider.ChecksFailed}
+	h.Record("https://github.com/o/r/pull/1", "a", results, time.Now())
+	h.Record("https://github.com/o/r/pull/2", "a", results, time.Now().Add(-Retention+time.Hour))
+	h.Record("https://github.com/o/r/pull/3", "a", results, time.Now().Add(-Retention-time.Hour))
+	if err := h.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"https://github.com/o/r/pull/1", "https://github.com/o/r/pull/2"}
+	if got := slices.Sorted(maps.Keys(loaded.PRs)); !slices.Equal(got, want) {
+		t.Errorf("got PRs %v, want %v", got, want)
+	}
+	if got := loaded.PRs[want[0]].Jobs["unit"]; len(got) != 1 || got[0].Result != provider.ChecksFailed {
+		t.Errorf("got results %v, want the recorded failure", got)
+	}
+}
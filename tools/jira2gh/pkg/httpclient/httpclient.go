@@ -0,0 +1,213 @@
+// Package httpclient sends the HTTP requests of the Jira, GitHub and GitLab
+// clients, with a timeout and retries for transient failures.
+package httpclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"jira2gh/pkg/config"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+var (
+	// Timeout bounds a single attempt, including reading the response body.
+	Timeout = 60 * time.Second
+	// MaxAttempts is how often a request is sent before giving up.
+	MaxAttempts = 6
+	// BaseDelay is the backoff before the first retry; it doubles with every
+	// further attempt, up to MaxDelay.
+	BaseDelay = 2 * time.Second
+	MaxDelay  = time.Minute
+	// MaxWait is the longest a server may ask us to wait through Retry-After
+	// or rate limit headers; beyond that the request fails right away.
+	MaxWait = 15 * time.Minute
+)
+
+// Response is an HTTP response whose body has been read.
+type Response struct {
+	StatusCode int
+	Header     http.Header
+	Body       []byte
+}
+
+// Backend sends a single attempt of a request. Requests go over the network
+// unless another backend is set, e.g. to record or replay a session.
+type Backend interface {
+	Send(req *http.Request) (*Response, error)
+}
+
+var backend Backend = Network{}
+
+// SetBackend sets the backend all requests are sent through.
+func SetBackend(b Backend) {
+	backend = b
+}
+
+// Network sends requests over the network.
+type Network struct{}
+
+var client = &http.Client{}
+
+func (Network) Send(req *http.Request) (*Response, error) {
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response body: %w", err)
+	}
+	return &Response{StatusCode: resp.StatusCode, Header: resp.Header, Body: body}, nil
+}
+
+// Do sends an idempotent request, retrying network errors, timeouts and 429
+// and 5xx responses with exponential backoff and jitter, or after as long as
+// the server asks. Other responses are returned as they are, whatever their
+// status. The body of req must be replayable, as is the case for requests
+// created from a bytes.Reader.
+func Do(req *http.Request) (*Response, error) {
+	return DoWith(req, true, nil)
+}
+
+// DoOnce sends a request that must not be repeated if the server may have
+// acted on it. Only rate limited (429) responses are retried.
+func DoOnce(req *http.Request) (*Response, error) {
+	return DoWith(req, false, nil)
+}
+
+// RateLimitFunc is given every response to a request and returns how long
+// to wait before retrying it, for servers that signal rate limits in their own
+// way, or zero if the response is not rate limited.
+type RateLimitFunc func(resp *Response, attempt int) time.Duration
+
+// DoWith is Do, or DoOnce if the request is not idempotent, that also retries
+// the responses rateLimit asks to. Like any other, such delays fail the
+// request right away beyond MaxWait.
+func DoWith(req *http.Request, idempotent bool, rateLimit RateLimitFunc) (*Response, error) {
+	ctx := req.Context()
+	for attempt := 1; ; attempt++ {
+		resp, err := send(req)
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+
+		var limited time.Duration
+		if err == nil && rateLimit != nil {
+			limited = rateLimit(resp, attempt)
+		}
+
+		var delay time.Duration
+		reason := ""
+		switch {
+		case err != nil:
+			if !idempotent || errors.Is(err, ErrNotRecorded) {
+				return nil, err
+			}
+			delay, reason = Backoff(attempt), err.Error()
+		case limited > 0:
+			if limited > MaxWait {
+				return resp, nil
+			}
+			delay, reason = limited, "rate limited"
+		case resp.StatusCode == http.StatusTooManyRequests || (idempotent && resp.StatusCode >= 500):
+			delay, reason = Backoff(attempt), resp.status()
+			if wait := Delay(resp.Header); wait > 0 {
+				if wait > MaxWait {
+					return resp, nil
+				}
+				delay = wait
+			}
+		default:
+			return resp, nil
+		}
+
+		if attempt >= MaxAttempts {
+			if err != nil {
+				return nil, err
+			}
+			return resp, nil
+		}
+		config.Stderr("  %s %s: %s, retrying in %s...\n", req.Method, req.URL.Host, reason, delay.Round(time.Second))
+		if err := Sleep(ctx, delay); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// send makes a single attempt.
+func send(req *http.Request) (*Response, error) {
+	ctx, cancel := context.WithTimeout(req.Context(), Timeout)
+	defer cancel()
+
+	attempt := req.Clone(ctx)
+	if req.GetBody != nil {
+		body, err := req.GetBody()
+		if err != nil {
+			return nil, fmt.Errorf("failed to create request: %w", err)
+		}
+		attempt.Body = body
+	}
+
+	resp, err := backend.Send(attempt)
+	if errors.Is(err, context.DeadlineExceeded) {
+		return nil, fmt.Errorf("failed to send request: timed out after %s", Timeout)
+	}
+	return resp, err
+}
+
+func (r *Response) status() string {
+	return fmt.Sprintf("status %d %s", r.StatusCode, http.StatusText(r.StatusCode))
+}
+
+// Delay returns how long the server asks to wait before the next request,
+// from Retry-After or, once GitHub's rate limit is used up, the time it
+// resets at. It returns zero if the headers do not say.
+func Delay(h http.Header) time.Duration {
+	if retryAfter := h.Get("Retry-After"); retryAfter != "" {
+		if secs, err := strconv.Atoi(retryAfter); err == nil {
+			return time.Duration(secs) * time.Second
+		}
+		if at, err := http.ParseTime(retryAfter); err == nil {
+			return max(time.Until(at), time.Second)
+		}
+	}
+	if h.Get("X-RateLimit-Remaining") == "0" {
+		if reset, err := strconv.ParseInt(h.Get("X-RateLimit-Reset"), 10, 64); err == nil {
+			return max(time.Until(time.Unix(reset, 0)), 0) + time.Second
+		}
+	}
+	return 0
+}
+
+// Backoff returns the delay before retrying after the given attempt: BaseDelay
+// doubled for every previous attempt, capped at MaxDelay, of which a random
+// half is taken off to spread out concurrent retries.
+func Backoff(attempt int) time.Duration {
+	d := MaxDelay
+	if attempt < 30 {
+		d = min(BaseDelay<<(attempt-1), MaxDelay)
+	}
+	if d <= 0 {
+		return 0
+	}
+	return d/2 + rand.N(d/2+1)
+}
+
+// Sleep waits for d, or returns early with an error if ctx is done.
+func Sleep(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
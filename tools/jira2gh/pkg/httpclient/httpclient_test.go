@@ -0,0 +1,265 @@
+package httpclient
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestDelay(t *testing.T) {
+	tests := []struct {
+		name     string
+		header   http.Header
+		min, max time.Duration
+	}{
+		{
+			name: "no header",
+		},
+		{
+			name:   "retry after seconds",
+			header: http.Header{"Retry-After": {"30"}},
+			min:    30 * time.Second,
+			max:    30 * time.Second,
+		},
+		{
+			name:   "retry after date",
+			header: http.Header{"Retry-After": {time.Now().Add(time.Minute).UTC().Format(http.TimeFormat)}},
+			min:    58 * time.Second,
+			max:    time.Minute,
+		},
+		{
+			name:   "retry after date in the past",
+			header: http.Header{"Retry-After": {time.Now().Add(-time.Minute).UTC().Format(http.TimeFormat)}},
+			min:    time.Second,
+			max:    time.Second,
+		},
+		{
+			name:   "invalid retry after",
+			header: http.Header{"Retry-After": {"soon"}},
+		},
+		{
+			name: "rate limit used up",
+			header: http.Header{
+				"X-Ratelimit-Remaining": {"0"},
+				"X-Ratelimit-Reset":     {strconv.FormatInt(time.Now().Add(time.Minute).Unix(), 10)},
+			},
+			min: 59 * time.Second,
+			max: 61 * time.Second,
+		},
+		{
+			name: "rate limit reset in the past",
+			header: http.Header{
+				"X-Ratelimit-Remaining": {"0"},
+				"X-Ratelimit-Reset":     {strconv.FormatInt(time.Now().Add(-time.Minute).Unix(), 10)},
+			},
+			min: time.Second,
+			max: time.Second,
+		},
+		{
+			name: "rate limit left",
+			header: http.Header{
+				"X-Ratelimit-Remaining": {"10"},
+				"X-Ratelimit-Reset":     {strconv.FormatInt(time.Now().Add(time.Minute).Unix(), 10)},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Delay(tt.header); got < tt.min || got > tt.max {
+				t.Errorf("got %s, want between %s and %s", got, tt.min, tt.max)
+			}
+		})
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	tests := []struct {
+		attempt int
+		full    time.Duration
+	}{
+		{attempt: 1, full: BaseDelay},
+		{attempt: 2, full: 2 * BaseDelay},
+		{attempt: 3, full: 4 * BaseDelay},
+		{attempt: 10, full: MaxDelay},
+		{attempt: 100, full: MaxDelay},
+	}
+
+	for _, tt := range tests {
+		t.Run(strconv.Itoa(tt.attempt), func(t *testing.T) {
+			for range 100 {
+				if got := Backoff(tt.attempt); got < tt.full/2 || got > tt.full {
+					t.Fatalf("got %s, want between %s and %s", got, tt.full/2, tt.full)
+				}
+			}
+		})
+	}
+}
+
+// fakeBackend answers the attempts of a request with the given responses or
+// errors in turn.
+type fakeBackend struct {
+	responses []*Response
+	errs      []error
+	attempts  int
+}
+
+func (f *fakeBackend) Send(req *http.Request) (*Response, error) {
+	f.attempts++
+	i := min(f.attempts, len(f.responses)) - 1
+	return f.responses[i], f.errs[i]
+}
+
+func status(code int, header http.Header) *Response {
+	if header == nil {
+		header = http.Header{}
+	}
+	return &Response{StatusCode: code, Header: header}
+}
+
+func TestDoWith(t *testing.T) {
+	errNetwork := errors.New("connection reset")
+	limitedFor := func(d time.Duration) RateLimitFunc {
+		return func(resp *Response, attempt int) time.Duration {
+			if resp.StatusCode == http.StatusForbidden {
+				return d
+			}
+			return 0
+		}
+	}
+
+	tests := []struct {
+		name         string
+		idempotent   bool
+		rateLimit    RateLimitFunc
+		responses    []*Response
+		errs         []error
+		wantStatus   int
+		wantErr      bool
+		wantAttempts int
+	}{
+		{
+			name:         "success",
+			idempotent:   true,
+			responses:    []*Response{status(http.StatusOK, nil)},
+			errs:         []error{nil},
+			wantStatus:   http.StatusOK,
+			wantAttempts: 1,
+		},
+		{
+			name:         "client errors are not retried",
+			idempotent:   true,
+			responses:    []*Response{status(http.StatusNotFound, nil)},
+			errs:         []error{nil},
+			wantStatus:   http.StatusNotFound,
+			wantAttempts: 1,
+		},
+		{
+			name:         "server errors are retried",
+			idempotent:   true,
+			responses:    []*Response{status(http.StatusBadGateway, nil), status(http.StatusOK, nil)},
+			errs:         []error{nil, nil},
+			wantStatus:   http.StatusOK,
+			wantAttempts: 2,
+		},
+		{
+			name:         "server errors are not retried for requests that are not idempotent",
+			responses:    []*Response{status(http.StatusBadGateway, nil), status(http.StatusOK, nil)},
+			errs:         []error{nil, nil},
+			wantStatus:   http.StatusBadGateway,
+			wantAttempts: 1,
+		},
+		{
+			name:         "too many requests are retried for requests that are not idempotent",
+			responses:    []*Response{status(http.StatusTooManyRequests, nil), status(http.StatusOK, nil)},
+			errs:         []error{nil, nil},
+			wantStatus:   http.StatusOK,
+			wantAttempts: 2,
+		},
+		{
+			name:         "network errors are retried",
+			idempotent:   true,
+			responses:    []*Response{nil, status(http.StatusOK, nil)},
+			errs:         []error{errNetwork, nil},
+			wantStatus:   http.StatusOK,
+			wantAttempts: 2,
+		},
+		{
+			name:         "network errors are not retried for requests that are not idempotent",
+			responses:    []*Response{nil, status(http.StatusOK, nil)},
+			errs:         []error{errNetwork, nil},
+			wantErr:      true,
+			wantAttempts: 1,
+		},
+		{
+			name:         "unrecorded requests are not retried",
+			idempotent:   true,
+			responses:    []*Response{nil, status(http.StatusOK, nil)},
+			errs:         []error{ErrNotRecorded, nil},
+			wantErr:      true,
+			wantAttempts: 1,
+		},
+		{
+			name:         "gives up after the last attempt",
+			idempotent:   true,
+			responses:    []*Response{status(http.StatusServiceUnavailable, nil)},
+			errs:         []error{nil},
+			wantStatus:   http.StatusServiceUnavailable,
+			wantAttempts: 3,
+		},
+		{
+			name:         "retry after beyond the longest wait",
+			idempotent:   true,
+			responses:    []*Response{status(http.StatusTooManyRequests, http.Header{"Retry-After": {"3600"}}), status(http.StatusOK, nil)},
+			errs:         []error{nil, nil},
+			wantStatus:   http.StatusTooManyRequests,
+			wantAttempts: 1,
+		},
+		{
+			name:         "rate limited",
+			rateLimit:    limitedFor(time.Millisecond),
+			responses:    []*Response{status(http.StatusForbidden, nil), status(http.StatusOK, nil)},
+			errs:         []error{nil, nil},
+			wantStatus:   http.StatusOK,
+			wantAttempts: 2,
+		},
+		{
+			name:         "rate limited beyond the longest wait",
+			rateLimit:    limitedFor(time.Hour),
+			responses:    []*Response{status(http.StatusForbidden, nil), status(http.StatusOK, nil)},
+			errs:         []error{nil, nil},
+			wantStatus:   http.StatusForbidden,
+			wantAttempts: 1,
+		},
+	}
+
+	defer func(attempts int, base, maxDelay, maxWait time.Duration) {
+		MaxAttempts, BaseDelay, MaxDelay, MaxWait = attempts, base, maxDelay, maxWait
+		SetBackend(Network{})
+	}(MaxAttempts, BaseDelay, MaxDelay, MaxWait)
+	MaxAttempts, BaseDelay, MaxDelay, MaxWait = 3, time.Millisecond, time.Millisecond, time.Minute
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := &fakeBackend{responses: tt.responses, errs: tt.errs}
+			SetBackend(fake)
+
+			req, err := http.NewRequestWithContext(t.Context(), "GET", "https://example.com", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp, err := DoWith(req, tt.idempotent, tt.rateLimit)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v, want error %v", err, tt.wantErr)
+			}
+			if err == nil && resp.StatusCode != tt.wantStatus {
+				t.Errorf("got status %d, want %d", resp.StatusCode, tt.wantStatus)
+			}
+			if fake.attempts != tt.wantAttempts {
+				t.Errorf("got %d attempts, want %d", fake.attempts, tt.wantAttempts)
+			}
+		})
+	}
+}
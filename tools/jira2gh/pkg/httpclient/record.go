@@ -0,0 +1,169 @@
+package httpclient
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// capture is a recorded request and its response. Request headers are left
+// out so that no credentials end up in the recording.
+type capture struct {
+	Method      string      `json:"method"`
+	URL         string      `json:"url"`
+	RequestBody string      `json:"request_body,omitempty"`
+	StatusCode  int         `json:"status_code"`
+	Header      http.Header `json:"header"`
+	Body        string      `json:"body"`
+}
+
+// Recorder sends requests through Next and saves every response to Dir, for
+// a Replayer to serve later.
+type Recorder struct {
+	Dir  string
+	Next Backend
+
+	mu   sync.Mutex
+	seen map[string]int
+}
+
+// NewRecorder returns a Recorder saving the responses of the network to dir.
+func NewRecorder(dir string) (*Recorder, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create record directory: %w", err)
+	}
+	return &Recorder{Dir: dir, Next: Network{}, seen: map[string]int{}}, nil
+}
+
+func (r *Recorder) Send(req *http.Request) (*Response, error) {
+	body, err := requestBody(req)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := r.Next.Send(req)
+	if err != nil {
+		// Network errors are not recorded, replays only see responses
+		return nil, err
+	}
+
+	key := captureKey(req, body)
+	r.mu.Lock()
+	n := r.seen[key]
+	r.seen[key]++
+	r.mu.Unlock()
+
+	header := resp.Header.Clone()
+	header.Del("Set-Cookie")
+	data, err := json.MarshalIndent(capture{
+		Method:      req.Method,
+		URL:         req.URL.String(),
+		RequestBody: string(body),
+		StatusCode:  resp.StatusCode,
+		Header:      header,
+		Body:        string(resp.Body),
+	}, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to record response: %w", err)
+	}
+	if err := os.WriteFile(capturePath(r.Dir, key, n), data, 0o644); err != nil {
+		return nil, fmt.Errorf("failed to record response: %w", err)
+	}
+	return resp, nil
+}
+
+// ErrNotRecorded is returned when replaying a request that was not recorded.
+// Such requests are not retried.
+var ErrNotRecorded = errors.New("no recorded response")
+
+// Replayer serves the responses saved by a Recorder, without any network.
+// Identical requests get the responses recorded for them in order, the last
+// one being repeated once they run out.
+type Replayer struct {
+	Dir string
+
+	mu     sync.Mutex
+	served map[string]int
+}
+
+// NewReplayer returns a Replayer serving the responses recorded in dir.
+func NewReplayer(dir string) (*Replayer, error) {
+	if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+		return nil, fmt.Errorf("no recording found in %s", dir)
+	}
+	return &Replayer{Dir: dir, served: map[string]int{}}, nil
+}
+
+func (r *Replayer) Send(req *http.Request) (*Response, error) {
+	body, err := requestBody(req)
+	if err != nil {
+		return nil, err
+	}
+
+	key := captureKey(req, body)
+	r.mu.Lock()
+	n := r.served[key]
+	r.served[key]++
+	r.mu.Unlock()
+
+	data, err := os.ReadFile(capturePath(r.Dir, key, n))
+	for errors.Is(err, fs.ErrNotExist) && n > 0 {
+		n--
+		data, err = os.ReadFile(capturePath(r.Dir, key, n))
+	}
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("%w for %s %s", ErrNotRecorded, req.Method, req.URL)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read recorded response: %w", err)
+	}
+
+	var c capture
+	if err := json.Unmarshal(data, &c); err != nil {
+		return nil, fmt.Errorf("failed to parse recorded response %s: %w", capturePath(r.Dir, key, n), err)
+	}
+	return &Response{StatusCode: c.StatusCode, Header: c.Header, Body: []byte(c.Body)}, nil
+}
+
+// requestBody returns a copy of the request body, leaving req as it was.
+func requestBody(req *http.Request) ([]byte, error) {
+	switch {
+	case req.GetBody != nil:
+		body, err := req.GetBody()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read request body: %w", err)
+		}
+		defer body.Close()
+		return io.ReadAll(body)
+	case req.Body != nil && req.Body != http.NoBody:
+		data, err := io.ReadAll(req.Body)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read request body: %w", err)
+		}
+		req.Body = io.NopCloser(bytes.NewReader(data))
+		return data, nil
+	default:
+		return nil, nil
+	}
+}
+
+// captureKey identifies a request by its method, URL and body.
+func captureKey(req *http.Request, body []byte) string {
+	h := sha256.New()
+	fmt.Fprintf(h, "%s %s\n", req.Method, req.URL)
+	h.Write(body)
+	return req.URL.Hostname() + "-" + hex.EncodeToString(h.Sum(nil))[:16]
+}
+
+// capturePath returns the file of the nth response recorded for a request.
+func capturePath(dir, key string, n int) string {
+	return filepath.Join(dir, fmt.Sprintf("%s-%03d.json", key, n))
+}
@@ -0,0 +1,179 @@
+package jira
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"jira2gh/pkg/config"
+	"regexp"
+	"strings"
+	"sync/atomic"
+)
+
+// fieldsResolved is set once the custom field IDs have been filled in.
+var fieldsResolved atomic.Bool
+
+// sprintNameRE extracts the name from the string form of a sprint that
+// Jira Server returns, e.g. "...Sprint@1a2b[id=1,state=ACTIVE,name=Sprint 1,...]".
+var sprintNameRE = regexp.MustCompile(`[\[,]name=([^,\]]*)`)
+
+// resolveFields fills in the custom field IDs missing from the config by
+// looking up the fields by name.
+func resolveFields(ctx context.Context, jira *config.JiraConfig) error {
+	if fieldsResolved.Load() {
+		return nil
+	}
+
+	wanted := map[string]*string{
+		"Epic Link":      &jira.Fields.EpicLink,
+		"Parent Link":    &jira.Fields.ParentLink,
+		"Sprint":         &jira.Fields.Sprint,
+		"Target Version": &jira.Fields.TargetVersion,
+	}
+	missing := false
+	for _, id := range wanted {
+		if *id == "" {
+			missing = true
+		}
+	}
+	if !missing {
+		fieldsResolved.Store(true)
+		return nil
+	}
+
+	respBody, err := jiraRequest(ctx, jira, apiPath(jira, "field"))
+	if err != nil {
+		return fmt.Errorf("failed to list Jira fields: %w", err)
+	}
+
+	var fields []struct {
+		ID     string `json:"id"`
+		Name   string `json:"name"`
+		Custom bool   `json:"custom"`
+	}
+	if err := json.Unmarshal(respBody, &fields); err != nil {
+		return fmt.Errorf("failed to parse Jira fields: %w", err)
+	}
+
+	for _, field := range fields {
+		if id, found := wanted[field.Name]; found && field.Custom && *id == "" {
+			*id = field.ID
+		}
+	}
+
+	fieldsResolved.Store(true)
+	return nil
+}
+
+// jqlField returns how a field is referenced in JQL, e.g. cf[12311140] for
+// customfield_12311140.
+func jqlField(id string) string {
+	if num, found := strings.CutPrefix(id, "customfield_"); found {
+		return "cf[" + num + "]"
+	}
+	return id
+}
+
+// customKey returns the issue key held by a custom field, if any.
+func customKey(fields map[string]json.RawMessage, id string) string {
+	raw, found := fields[id]
+	if id == "" || !found {
+		return ""
+	}
+	var key issueKey
+	if err := json.Unmarshal(raw, &key); err != nil {
+		return ""
+	}
+	return string(key)
+}
+
+// sprintName returns the name of the latest sprint in a sprint field, which is
+// a list of objects on Cloud and a list of serialized strings on Server.
+func sprintName(raw json.RawMessage) string {
+	var sprints []json.RawMessage
+	if err := json.Unmarshal(raw, &sprints); err != nil || len(sprints) == 0 {
+		return ""
+	}
+	last := sprints[len(sprints)-1]
+
+	var obj struct {
+		Name string `json:"name"`
+	}
+	if err := json.Unmarshal(last, &obj); err == nil {
+		return obj.Name
+	}
+
+	var str string
+	if err := json.Unmarshal(last, &str); err != nil {
+		return ""
+	}
+	if m := sprintNameRE.FindStringSubmatch(str); m != nil {
+		return m[1]
+	}
+	return ""
+}
+
+// versionNames returns the comma-separated names held by a version field,
+// which may hold a single version or a list of them.
+func versionNames(raw json.RawMessage) string {
+	type version struct {
+		Name string `json:"name"`
+	}
+
+	var versions []version
+	if err := json.Unmarshal(raw, &versions); err != nil {
+		var v version
+		if err := json.Unmarshal(raw, &v); err != nil {
+			return ""
+		}
+		versions = []version{v}
+	}
+
+	names := make([]string, 0, len(versions))
+	for _, v := range versions {
+		if v.Name != "" {
+			names = append(names, v.Name)
+		}
+	}
+	return strings.Join(names, ", ")
+}
+
+// fieldText renders the value of an arbitrary field as text: strings and
+// numbers as they are, objects such as options, users and versions by their
+// value or name, and lists as comma-separated values.
+func fieldText(raw json.RawMessage) string {
+	if len(raw) == 0 {
+		return ""
+	}
+
+	var value any
+	if err := json.Unmarshal(raw, &value); err != nil {
+		return ""
+	}
+
+	switch v := value.(type) {
+	case string:
+		return v
+	case float64, bool:
+		return string(raw)
+	case []any:
+		var items []json.RawMessage
+		if err := json.Unmarshal(raw, &items); err != nil {
+			return ""
+		}
+		var texts []string
+		for _, item := range items {
+			if text := fieldText(item); text != "" {
+				texts = append(texts, text)
+			}
+		}
+		return strings.Join(texts, ", ")
+	case map[string]any:
+		for _, key := range []string{"value", "name", "displayName", "key"} {
+			if s, ok := v[key].(string); ok && s != "" {
+				return s
+			}
+		}
+	}
+	return ""
+}
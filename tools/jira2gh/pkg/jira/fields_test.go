@@ -0,0 +1,148 @@
+package jira
+
+import (
+	"encoding/json"
+	"jira2gh/pkg/config"
+	"net/http"
+	"testing"
+)
+
+func TestResolveFields(t *testing.T) {
+	fake := useFakeJira(t, func(path string, body map[string]any) (int, string) {
+		return http.StatusOK, `[
+			{"id": "summary", "name": "Summary", "custom": false},
+			{"id": "customfield_1", "name": "Epic Link", "custom": true},
+			{"id": "customfield_2", "name": "Parent Link", "custom": true},
+			{"id": "parent", "name": "Sprint", "custom": false},
+			{"id": "customfield_3", "name": "Sprint", "custom": true},
+			{"id": "customfield_4", "name": "Target Version", "custom": true}
+		]`
+	})
+
+	jiraCfg := &config.JiraConfig{Host: "https://jira.example.com"}
+	jiraCfg.Fields.ParentLink = "customfield_99"
+	for range 2 {
+		if err := resolveFields(t.Context(), jiraCfg); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	want := map[string]string{
+		"Epic Link":      "customfield_1",
+		"Parent Link":    "customfield_99", // configured
+		"Sprint":         "customfield_3",  // custom fields only
+		"Target Version": "customfield_4",
+	}
+	got := map[string]string{
+		"Epic Link":      jiraCfg.Fields.EpicLink,
+		"Parent Link":    jiraCfg.Fields.ParentLink,
+		"Sprint":         jiraCfg.Fields.Sprint,
+		"Target Version": jiraCfg.Fields.TargetVersion,
+	}
+	for name, id := range want {
+		if got[name] != id {
+			t.Errorf("got %s field %q, want %q", name, got[name], id)
+		}
+	}
+	if len(fake.requests) != 1 {
+		t.Errorf("got %d field lookups, want 1", len(fake.requests))
+	}
+}
+
+func TestResolveFieldsAllConfigured(t *testing.T) {
+	useFakeJira(t, func(path string, body map[string]any) (int, string) {
+		t.Fatalf("unexpected request to %s", path)
+		return http.StatusInternalServerError, ""
+	})
+
+	jiraCfg := &config.JiraConfig{Host: "https://jira.example.com"}
+	jiraCfg.Fields.EpicLink = "customfield_1"
+	jiraCfg.Fields.ParentLink = "customfield_2"
+	jiraCfg.Fields.Sprint = "customfield_3"
+	jiraCfg.Fields.TargetVersion = "customfield_4"
+	if err := resolveFields(t.Context(), jiraCfg); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestJQLField(t *testing.T) {
+	tests := []struct {
+		id   string
+		want string
+	}{
+		{"customfield_12311140", "cf[12311140]"},
+		{"parent", "parent"},
+	}
+	for _, tt := range tests {
+		if got := jqlField(tt.id); got != tt.want {
+			t.Errorf("jqlField(%q) = %q, want %q", tt.id, got, tt.want)
+		}
+	}
+}
+
+func TestCustomKey(t *testing.T) {
+	fields := map[string]json.RawMessage{
+		"customfield_1": json.RawMessage(`"A-1"`),
+		"customfield_2": json.RawMessage(`{"key": "A-2", "id": "10002"}`),
+		"customfield_3": json.RawMessage(`null`),
+		"customfield_4": json.RawMessage(`42`),
+	}
+	tests := []struct {
+		id   string
+		want string
+	}{
+		{"customfield_1", "A-1"},
+		{"customfield_2", "A-2"},
+		{"customfield_3", ""},
+		{"customfield_4", ""},
+		{"customfield_5", ""},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		if got := customKey(fields, tt.id); got != tt.want {
+			t.Errorf("customKey(%q) = %q, want %q", tt.id, got, tt.want)
+		}
+	}
+}
+
+func TestSprintName(t *testing.T) {
+	tests := []struct {
+		name string
+		raw  string
+		want string
+	}{
+		{"cloud", `[{"id": 1, "name": "Sprint 1"}, {"id": 2, "name": "Sprint 2"}]`, "Sprint 2"},
+		{"server", `["com.atlassian.greenhopper.service.sprint.Sprint@1a2b[id=1,rapidViewId=2,state=ACTIVE,name=Sprint 1,startDate=2024-01-01]"]`, "Sprint 1"},
+		{"server without name", `["com.atlassian.greenhopper.service.sprint.Sprint@1a2b[id=1,state=ACTIVE]"]`, ""},
+		{"empty", `[]`, ""},
+		{"null", `null`, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := sprintName(json.RawMessage(tt.raw)); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestVersionNames(t *testing.T) {
+	tests := []struct {
+		name string
+		raw  string
+		want string
+	}{
+		{"list", `[{"name": "4.18"}, {"name": "4.19"}]`, "4.18, 4.19"},
+		{"single", `{"name": "4.18"}`, "4.18"},
+		{"unnamed", `[{"id": "1"}, {"name": "4.19"}]`, "4.19"},
+		{"empty", `[]`, ""},
+		{"not a version", `"4.18"`, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := versionNames(json.RawMessage(tt.raw)); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
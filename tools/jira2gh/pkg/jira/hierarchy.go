@@ -0,0 +1,147 @@
+package jira
+
+import (
+	"context"
+	"fmt"
+	"jira2gh/pkg/config"
+	"slices"
+	"strings"
+)
+
+const (
+	// defaultHierarchyDepth covers OCPSTRAT → Feature → Epic → Issue.
+	defaultHierarchyDepth = 3
+	// childQueryBatchSize is the number of parents queried per JQL search.
+	childQueryBatchSize = 50
+)
+
+// HierarchyItem is one level of the Jira hierarchy a PR was found under.
+type HierarchyItem struct {
+	Key  string
+	Type string
+}
+
+// hierarchyDepth returns how many levels the project's hierarchy walks reach.
+func hierarchyDepth(proj *config.ProjectConfig) int {
+	if proj.HierarchyDepth <= 0 {
+		return defaultHierarchyDepth
+	}
+	return proj.HierarchyDepth
+}
+
+// walkUp returns the ancestors of key, top-most first, following parent,
+// Epic Link and Parent Link for at most depth levels.
+func walkUp(ctx context.Context, jira *config.JiraConfig, key string, depth int) ([]string, error) {
+	var chain []string
+	seen := map[string]bool{key: true}
+	cur := key
+	for range depth {
+		iss, err := getIssue(ctx, jira, cur)
+		if err != nil {
+			return nil, err
+		}
+		parent := iss.parentKey()
+		if parent == "" || seen[parent] {
+			break
+		}
+		seen[parent] = true
+		chain = append([]string{parent}, chain...)
+		cur = parent
+	}
+	return chain, nil
+}
+
+// walkDown returns every issue below root up to depth levels, in the order
+// they were found, along with the path of keys from root to each of them.
+// Issues reachable along more than one path keep the first one found, which
+// also guards against cycles.
+func walkDown(ctx context.Context, jira *config.JiraConfig, root string, depth int) (map[string][]string, []string, error) {
+	paths := map[string][]string{root: {root}}
+	order := []string{root}
+	level := []string{root}
+
+	for d := 0; d < depth && len(level) > 0; d++ {
+		var next []string
+		for len(level) > 0 {
+			n := min(len(level), childQueryBatchSize)
+			parents := level[:n]
+			level = level[n:]
+
+			children, err := getChildIssues(ctx, jira, parents)
+			if err != nil {
+				return nil, nil, err
+			}
+			for _, child := range children {
+				if _, seen := paths[child.Key]; seen {
+					continue
+				}
+				parent := child.parentIn(parents)
+				if parent == "" {
+					continue
+				}
+				paths[child.Key] = append(slices.Clone(paths[parent]), child.Key)
+				order = append(order, child.Key)
+				next = append(next, child.Key)
+			}
+		}
+		level = next
+	}
+
+	return paths, order, nil
+}
+
+// getChildIssues finds all issues whose parent, epic or parent link is one of
+// the given keys.
+func getChildIssues(ctx context.Context, jira *config.JiraConfig, keys []string) ([]*issue, error) {
+	list := strings.Join(keys, ", ")
+	clauses := []string{fmt.Sprintf("parent in (%s)", list)}
+	for _, id := range []string{jira.Fields.EpicLink, jira.Fields.ParentLink} {
+		if id != "" {
+			clauses = append(clauses, fmt.Sprintf("%s in (%s)", jqlField(id), list))
+		}
+	}
+	return jiraSearch(ctx, jira, strings.Join(clauses, " OR "))
+}
+
+// parentKey returns the closest parent of the issue, if any.
+func (iss *issue) parentKey() string {
+	for _, p := range []string{iss.Parent, iss.ParentEpic, iss.ParentLink} {
+		if p != "" {
+			return p
+		}
+	}
+	return ""
+}
+
+// parentIn returns which of the given keys is a parent of the issue.
+func (iss *issue) parentIn(keys []string) string {
+	for _, p := range []string{iss.Parent, iss.ParentEpic, iss.ParentLink} {
+		if p != "" && slices.Contains(keys, p) {
+			return p
+		}
+	}
+	return ""
+}
+
+// hierarchyItems resolves a path of keys to hierarchy items with their types.
+func hierarchyItems(keys []string) []HierarchyItem {
+	items := make([]HierarchyItem, len(keys))
+	for i, key := range keys {
+		items[i] = HierarchyItem{Key: key}
+		if iss, found := cachedIssue(key); found {
+			items[i].Type = iss.Type
+		}
+	}
+	return items
+}
+
+// nearestOfType returns the key of the lowest item in the hierarchy with the
+// given issue type.
+func nearestOfType(items []HierarchyItem, issueType string) string {
+	for i := len(items) - 1; i >= 0; i-- {
+		if items[i].Type == issueType {
+			return items[i].Key
+		}
+	}
+	return ""
+}
@@ -0,0 +1,303 @@
+package jira
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"jira2gh/pkg/config"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+// issueFields returns the fields requested for every issue we load, so that a
+// single search answers everything the sync needs to know about an issue.
+func issueFields(jira *config.JiraConfig) []string {
+	fields := []string{"issuetype", "status", "issuelinks", "parent", "assignee", "priority", "fixVersions"}
+	for _, id := range []string{jira.Fields.EpicLink, jira.Fields.ParentLink, jira.Fields.Sprint, jira.Fields.TargetVersion} {
+		if id != "" {
+			fields = append(fields, id)
+		}
+	}
+	return append(fields, jira.ExtraFields...)
+}
+
+// issue holds the fields of a Jira issue that the sync needs.
+type issue struct {
+	Key           string
+	Type          string
+	Status        string
+	Assignee      string
+	Priority      string
+	FixVersion    string
+	Parent        string
+	ParentEpic    string
+	ParentLink    string
+	Sprint        string
+	TargetVersion string
+	// Extra holds the values of the fields in JiraConfig.ExtraFields as text
+	Extra map[string]string
+	// Links holds the inward and outward issue links
+	Links []issueLink
+}
+
+// issueLink is a link from an issue to another one, as seen from the former.
+type issueLink struct {
+	Key string
+	// Type is the link type name, e.g. "Blocks"
+	Type string
+	// Relation describes the link in its direction, e.g. "is blocked by"
+	Relation string
+	// Direction is "inward" or "outward"
+	Direction string
+}
+
+// issueKey decodes a reference to another issue, which depending on the field
+// and Jira version is either the bare key or an object carrying it.
+type issueKey string
+
+func (k *issueKey) UnmarshalJSON(data []byte) error {
+	var key string
+	if err := json.Unmarshal(data, &key); err == nil {
+		*k = issueKey(key)
+		return nil
+	}
+	var obj struct {
+		Key string `json:"key"`
+	}
+	if err := json.Unmarshal(data, &obj); err != nil {
+		return err
+	}
+	*k = issueKey(obj.Key)
+	return nil
+}
+
+var (
+	// issueCache holds every issue loaded during this run, by key, and
+	// remoteLinkCache the remote links fetched by ExtractJiraPRs, so that
+	// repeated extractions only fetch those of changed issues. cacheMu guards
+	// both, since the server keeps them across events.
+	issueCache      = map[string]*issue{}
+	remoteLinkCache = map[string][]remoteLink{}
+	cacheMu         sync.Mutex
+)
+
+// ResetCache forgets every issue and remote link loaded so far, as well as the
+// resolved custom field IDs, so that the next sync sees the current state of
+// Jira.
+func ResetCache() {
+	cacheMu.Lock()
+	defer cacheMu.Unlock()
+	issueCache = map[string]*issue{}
+	remoteLinkCache = map[string][]remoteLink{}
+	fieldsResolved.Store(false)
+}
+
+// Invalidate forgets what is cached about a single issue, so that it is loaded
+// again the next time it is needed.
+func Invalidate(key string) {
+	cacheMu.Lock()
+	defer cacheMu.Unlock()
+	delete(issueCache, key)
+	delete(remoteLinkCache, key)
+}
+
+// cachedIssue returns the cached issue with the given key.
+func cachedIssue(key string) (*issue, bool) {
+	cacheMu.Lock()
+	defer cacheMu.Unlock()
+	iss, found := issueCache[key]
+	return iss, found
+}
+
+// cacheIssue caches an issue under its key and any other keys it was
+// requested by.
+func cacheIssue(iss *issue, keys ...string) {
+	cacheMu.Lock()
+	defer cacheMu.Unlock()
+	issueCache[iss.Key] = iss
+	for _, key := range keys {
+		issueCache[key] = iss
+	}
+}
+
+// ResolveKey returns the key of the issue with the given ID or key.
+func ResolveKey(ctx context.Context, jira *config.JiraConfig, idOrKey string) (string, error) {
+	if err := resolveFields(ctx, jira); err != nil {
+		return "", err
+	}
+	iss, err := getIssue(ctx, jira, idOrKey)
+	if err != nil {
+		return "", err
+	}
+	return iss.Key, nil
+}
+
+// rawIssue is the JSON shape of an issue as returned by search and get. The
+// fields are decoded later, since custom field IDs are only known at runtime.
+type rawIssue struct {
+	Key    string          `json:"key"`
+	Fields json.RawMessage `json:"fields"`
+}
+
+func (r *rawIssue) toIssue(jira *config.JiraConfig) (*issue, error) {
+	var fields struct {
+		IssueType struct {
+			Name string `json:"name"`
+		} `json:"issuetype"`
+		Status struct {
+			Name string `json:"name"`
+		} `json:"status"`
+		Assignee *struct {
+			DisplayName string `json:"displayName"`
+		} `json:"assignee"`
+		Priority *struct {
+			Name string `json:"name"`
+		} `json:"priority"`
+		FixVersions json.RawMessage `json:"fixVersions"`
+		Parent      issueKey        `json:"parent"`
+		IssueLinks  []struct {
+			Type struct {
+				Name    string `json:"name"`
+				Inward  string `json:"inward"`
+				Outward string `json:"outward"`
+			} `json:"type"`
+			InwardIssue *struct {
+				Key string `json:"key"`
+			} `json:"inwardIssue"`
+			OutwardIssue *struct {
+				Key string `json:"key"`
+			} `json:"outwardIssue"`
+		} `json:"issuelinks"`
+	}
+	if err := json.Unmarshal(r.Fields, &fields); err != nil {
+		return nil, fmt.Errorf("failed to parse fields of %s: %w", r.Key, err)
+	}
+
+	var custom map[string]json.RawMessage
+	if err := json.Unmarshal(r.Fields, &custom); err != nil {
+		return nil, fmt.Errorf("failed to parse fields of %s: %w", r.Key, err)
+	}
+
+	iss := &issue{
+		Key:           r.Key,
+		Type:          fields.IssueType.Name,
+		Status:        fields.Status.Name,
+		FixVersion:    versionNames(fields.FixVersions),
+		Parent:        string(fields.Parent),
+		ParentEpic:    customKey(custom, jira.Fields.EpicLink),
+		ParentLink:    customKey(custom, jira.Fields.ParentLink),
+		Sprint:        sprintName(custom[jira.Fields.Sprint]),
+		TargetVersion: versionNames(custom[jira.Fields.TargetVersion]),
+	}
+	for _, id := range jira.ExtraFields {
+		if value := fieldText(custom[id]); value != "" {
+			if iss.Extra == nil {
+				iss.Extra = map[string]string{}
+			}
+			iss.Extra[id] = value
+		}
+	}
+	if fields.Assignee != nil {
+		iss.Assignee = fields.Assignee.DisplayName
+	}
+	if fields.Priority != nil {
+		iss.Priority = fields.Priority.Name
+	}
+	for _, link := range fields.IssueLinks {
+		if link.InwardIssue != nil {
+			iss.Links = append(iss.Links, issueLink{
+				Key:       link.InwardIssue.Key,
+				Type:      link.Type.Name,
+				Relation:  link.Type.Inward,
+				Direction: "inward",
+			})
+		}
+		if link.OutwardIssue != nil {
+			iss.Links = append(iss.Links, issueLink{
+				Key:       link.OutwardIssue.Key,
+				Type:      link.Type.Name,
+				Relation:  link.Type.Outward,
+				Direction: "outward",
+			})
+		}
+	}
+	return iss, nil
+}
+
+// getIssue returns the issue with the given key, loading it if needed.
+func getIssue(ctx context.Context, jira *config.JiraConfig, key string) (*issue, error) {
+	if err := loadIssues(ctx, jira, []string{key}); err != nil {
+		return nil, err
+	}
+	iss, _ := cachedIssue(key)
+	return iss, nil
+}
+
+// loadIssues fetches all keys that are not cached yet using as few JQL
+// searches as possible, and adds them to the cache.
+func loadIssues(ctx context.Context, jira *config.JiraConfig, keys []string) error {
+	var missing []string
+	seen := map[string]bool{}
+	for _, key := range keys {
+		if _, found := cachedIssue(key); !found && !seen[key] {
+			missing = append(missing, key)
+			seen[key] = true
+		}
+	}
+
+	pageSize := jira.PageSize
+	if pageSize <= 0 {
+		pageSize = defaultPageSize
+	}
+
+	for len(missing) > 0 {
+		n := min(len(missing), pageSize)
+		chunk := missing[:n]
+		missing = missing[n:]
+
+		_, err := jiraSearch(ctx, jira, fmt.Sprintf("key in (%s)", strings.Join(chunk, ", ")))
+		var statusErr *statusError
+		if err != nil && !(errors.As(err, &statusErr) && statusErr.code == http.StatusBadRequest) {
+			return err
+		}
+		// A search fails as a whole if any key does not exist, and moved
+		// issues come back under their new key, so fetch leftovers one by one
+		for _, key := range chunk {
+			if _, found := cachedIssue(key); found {
+				continue
+			}
+			if err := loadIssue(ctx, jira, key); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// loadIssue fetches a single issue and caches it under the requested key.
+func loadIssue(ctx context.Context, jira *config.JiraConfig, key string) error {
+	issueURL, err := url.JoinPath(jira.Host, apiPath(jira, "issue", key))
+	if err != nil {
+		return err
+	}
+	respBody, err := jiraRequestURL(ctx, jira, issueURL+"?fields="+url.QueryEscape(strings.Join(issueFields(jira), ",")))
+	if err != nil {
+		return err
+	}
+
+	var raw rawIssue
+	if err := json.Unmarshal(respBody, &raw); err != nil {
+		return fmt.Errorf("failed to parse response: %w", err)
+	}
+
+	iss, err := raw.toIssue(jira)
+	if err != nil {
+		return err
+	}
+	cacheIssue(iss, key)
+	return nil
+}
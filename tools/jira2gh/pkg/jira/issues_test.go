@@ -0,0 +1,112 @@
+package jira
+
+import (
+	"fmt"
+	"jira2gh/pkg/config"
+	"net/http"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestLoadIssues(t *testing.T) {
+	tests := []struct {
+		name     string
+		pageSize int
+		cached   []string
+		keys     []string
+		// search maps the JQL of each search to the keys it finds; other
+		// searches fail as if a key did not exist
+		search map[string][]string
+		// issues maps the keys fetched one by one to the key they come back
+		// under; other keys are not found
+		issues       map[string]string
+		wantRequests []string
+		// wantCached maps the requested keys to the key of their cached issue
+		wantCached map[string]string
+	}{
+		{
+			name:     "keys in chunks of the page size",
+			pageSize: 2,
+			keys:     []string{"A-1", "A-2", "A-1", "A-3"},
+			search: map[string][]string{
+				"key in (A-1, A-2)": {"A-1", "A-2"},
+				"key in (A-3)":      {"A-3"},
+			},
+			wantRequests: []string{"key in (A-1, A-2)", "key in (A-3)"},
+			wantCached:   map[string]string{"A-1": "A-1", "A-2": "A-2", "A-3": "A-3"},
+		},
+		{
+			name:         "cached keys are not fetched",
+			cached:       []string{"A-1"},
+			keys:         []string{"A-1", "A-2"},
+			search:       map[string][]string{"key in (A-2)": {"A-2"}},
+			wantRequests: []string{"key in (A-2)"},
+			wantCached:   map[string]string{"A-1": "A-1", "A-2": "A-2"},
+		},
+		{
+			name:         "moved issues are fetched under their old key",
+			keys:         []string{"A-1", "A-2"},
+			search:       map[string][]string{"key in (A-1, A-2)": {"A-1"}},
+			issues:       map[string]string{"A-2": "B-9"},
+			wantRequests: []string{"key in (A-1, A-2)", "issue A-2"},
+			wantCached:   map[string]string{"A-1": "A-1", "A-2": "B-9"},
+		},
+		{
+			name:         "keys are fetched one by one if the search fails",
+			keys:         []string{"A-1", "A-2"},
+			issues:       map[string]string{"A-1": "A-1", "A-2": "A-2"},
+			wantRequests: []string{"key in (A-1, A-2)", "issue A-1", "issue A-2"},
+			wantCached:   map[string]string{"A-1": "A-1", "A-2": "A-2"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var requests []string
+			useFakeJira(t, func(path string, body map[string]any) (int, string) {
+				if key, ok := strings.CutPrefix(path, "/rest/api/2/issue/"); ok {
+					requests = append(requests, "issue "+key)
+					if moved, ok := tt.issues[key]; ok {
+						return http.StatusOK, fmt.Sprintf(`{"key": %q, "fields": {}}`, moved)
+					}
+					return http.StatusNotFound, `{"errorMessages": ["Issue Does Not Exist"]}`
+				}
+				jql := fmt.Sprint(body["jql"])
+				requests = append(requests, jql)
+				if found, ok := tt.search[jql]; ok {
+					return http.StatusOK, searchPage(``, found...)
+				}
+				return http.StatusBadRequest, `{"errorMessages": ["An issue with key does not exist"]}`
+			})
+			for _, key := range tt.cached {
+				cacheIssue(&issue{Key: key})
+			}
+
+			if err := loadIssues(t.Context(), &config.JiraConfig{Host: "https://jira.example.com", PageSize: tt.pageSize}, tt.keys); err != nil {
+				t.Fatal(err)
+			}
+			if !slices.Equal(requests, tt.wantRequests) {
+				t.Errorf("got requests %q, want %q", requests, tt.wantRequests)
+			}
+			for key, want := range tt.wantCached {
+				if iss, found := cachedIssue(key); !found || iss.Key != want {
+					t.Errorf("got %s cached as %v, want %s", key, iss, want)
+				}
+			}
+		})
+	}
+}
+
+func TestLoadIssuesFailsOnMissingIssue(t *testing.T) {
+	useFakeJira(t, func(path string, body map[string]any) (int, string) {
+		if strings.HasPrefix(path, "/rest/api/2/issue/") {
+			return http.StatusNotFound, `{"errorMessages": ["Issue Does Not Exist"]}`
+		}
+		return http.StatusBadRequest, `{"errorMessages": ["An issue with key does not exist"]}`
+	})
+
+	if err := loadIssues(t.Context(), &config.JiraConfig{Host: "https://jira.example.com"}, []string{"A-1"}); err == nil {
+		t.Error("got no error for an issue that does not exist")
+	}
+}
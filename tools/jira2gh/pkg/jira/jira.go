@@ -1,19 +1,42 @@
 package jira
 
 import (
-	"context"
 	"bytes"
+	"context"
 	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"io"
 	"jira2gh/pkg/config"
+	"jira2gh/pkg/httpclient"
+	"jira2gh/pkg/provider"
 	"net/http"
 	"net/url"
+	"path"
 	"slices"
+	"strconv"
 	"strings"
+	"sync/atomic"
+	"time"
 )
 
+// defaultPageSize is the number of issues requested per search page.
+const defaultPageSize = 100
+
+// legacySearch is set once the enhanced search endpoint turned out to be
+// unavailable, so that later searches go straight to the classic one.
+var legacySearch atomic.Bool
+
+// statusError is returned for non-200 responses from Jira.
+type statusError struct {
+	code int
+	body string
+}
+
+func (e *statusError) Error() string {
+	return fmt.Sprintf("unexpected status code %d: %s", e.code, e.body)
+}
+
 type PR struct {
 	URL         string
 	Title       string
@@ -22,163 +45,259 @@ type PR struct {
 	JiraFeature string
 	JiraEpic    string
 	JiraIssue   string
-	JobSummary  string
-	ItemID      string
+	// JiraRoot is the issue of the project's jiras the PR was found under,
+	// e.g. an epic, a feature or an OCPSTRAT issue
+	JiraRoot string
+	// JiraSprint and JiraTargetVersion come from the issue the PR is linked to
+	JiraSprint        string
+	JiraTargetVersion string
+	// JiraStatus, JiraAssignee, JiraPriority and JiraFixVersion come from
+	// the issue the PR is linked to as well
+	JiraStatus     string
+	JiraAssignee   string
+	JiraPriority   string
+	JiraFixVersion string
+	// JiraExtra holds the Jira fields read for jira.field:<id> sources
+	JiraExtra  map[string]string
+	JobSummary string
+	// Checks is the overall state of the PR's required checks
+	Checks string
+	// FailedJobs are the PR's failing required jobs, and Retests how often
+	// all of them were asked to be rerun at once
+	FailedJobs []provider.Job
+	Retests    int
+	Mergeable  string
+	Draft      bool
+	UpdatedAt  time.Time
+	Labels     []string
+	// Staleness flags open PRs that need attention, see StalenessNeedsRebase
+	// and StalenessStale
+	Staleness string
+	// Review summarises the review status of open PRs
+	Review string
+	ItemID string
+	// Fields holds the current values of the item's project fields by name,
+	// for PRs that are already in the project
+	Fields map[string]string
+	// FromJira and HasDetails tell whether the PR was read from Jira and
+	// from the system hosting it during this run. Fields are only cleared
+	// from sources that were read, so that missing data never wipes them.
+	FromJira   bool
+	HasDetails bool
+	// PlannedFields, when set, are the field values to add the PR with
+	// instead of those from the field mappings and rules, e.g. from a saved
+	// plan
+	PlannedFields map[string]string
+	// Hierarchy is the chain of Jira issues from the top-most ancestor down
+	// to JiraIssue
+	Hierarchy []HierarchyItem
+	// LinkPath is the chain of issue links that brought JiraIssue in, empty
+	// if it is part of the hierarchy itself
+	LinkPath []IssueLink
 }
 
-func (pr *PR) Metadata() map[string]string {
-	metadata := map[string]string{}
+func (pr *PR) String() string {
 	if pr.JiraFeature != "" {
-		metadata["Jira Feature"] = pr.JiraFeature
+		return fmt.Sprintf("Feature: %-20s Epic: %-20s Issue: %-20s URL: %s", pr.JiraFeature, pr.JiraEpic, pr.JiraIssue, pr.URL)
 	}
-	if pr.JiraEpic != "" {
-		metadata["Jira Epic"] = pr.JiraEpic
+	return fmt.Sprintf("Epic: %-20s Issue: %-20s URL: %s", pr.JiraEpic, pr.JiraIssue, pr.URL)
+}
+
+// trackedIssues holds every issue a project tracks below one root issue.
+type trackedIssues struct {
+	// keys lists the issues in the order they were found
+	keys []string
+	// hierarchy maps each issue to the chain of keys above and including it
+	hierarchy map[string][]string
+	// linkPaths maps issues found through links to the links followed
+	linkPaths map[string][]IssueLink
+}
+
+// collectIssues walks the Jira hierarchy below issueID and the issue links
+// allowed by the project's link config. The issue is level levels below the
+// tracked root, and the walk reaches exactly as far as one from the root.
+func collectIssues(ctx context.Context, jira *config.JiraConfig, proj *config.ProjectConfig, issueID string, level int) (*trackedIssues, error) {
+	if err := resolveFields(ctx, jira); err != nil {
+		return nil, err
 	}
-	if pr.JiraIssue != "" {
-		metadata["Jira Issue"] = pr.JiraIssue
+
+	depth := hierarchyDepth(proj)
+	ancestors, err := walkUp(ctx, jira, issueID, depth+level)
+	if err != nil {
+		return nil, err
 	}
-	if pr.Author != "" {
-		metadata["PR Author"] = pr.Author
+	paths, keys, err := walkDown(ctx, jira, issueID, depth-level)
+	if err != nil {
+		return nil, err
 	}
-	if pr.JobSummary != "" {
-		metadata["Job Summary"] = pr.JobSummary
+
+	hierarchy := make(map[string][]string, len(keys))
+	for _, issue := range keys {
+		hierarchy[issue] = append(slices.Clone(ancestors), paths[issue]...)
 	}
-	return metadata
-}
 
-func (pr *PR) String() string {
-	if pr.JiraFeature != "" {
-		return fmt.Sprintf("Feature: %-20s Epic: %-20s Issue: %-20s URL: %s", pr.JiraFeature, pr.JiraEpic, pr.JiraIssue, pr.URL)
+	// Expand with issue-to-issue links (e.g. "is blocked by", "relates to")
+	linked, linkPaths, err := expandLinks(ctx, jira, proj, keys)
+	if err != nil {
+		return nil, err
 	}
-	return fmt.Sprintf("Epic: %-20s Issue: %-20s URL: %s", pr.JiraEpic, pr.JiraIssue, pr.URL)
+	for _, issue := range linked {
+		// Linked issues sit below the hierarchy issue their link path starts at
+		origin := linkPaths[issue][0].From
+		hierarchy[issue] = append(slices.Clone(hierarchy[origin]), issue)
+	}
+	keys = append(keys, linked...)
+	if err := loadIssues(ctx, jira, keys); err != nil {
+		return nil, err
+	}
+
+	return &trackedIssues{keys: keys, hierarchy: hierarchy, linkPaths: linkPaths}, nil
 }
 
-// ExtractJiraPRs scrapes remote links from the epic's linked issues
-func ExtractJiraPRs(ctx context.Context, jira *config.JiraConfig, issueID string, ignoreJiras []string) (map[string]PR, error) {
-	respBody, err := jiraRequest(ctx, jira, fmt.Sprintf("rest/api/2/issue/%s", issueID))
+// TrackedIssues returns the keys of all issues the project tracks below
+// issueID, leaving out ignored ones.
+func TrackedIssues(ctx context.Context, jira *config.JiraConfig, proj *config.ProjectConfig, issueID string) ([]string, error) {
+	tracked, err := collectIssues(ctx, jira, proj, issueID, 0)
 	if err != nil {
 		return nil, err
 	}
-
-	var issueType struct {
-		Fields struct {
-			IssueType struct {
-				Name string `json:"name"`
-			} `json:"issuetype"`
-			ParentEpic string `json:"customfield_12311140"`
-		} `json:"fields"`
+	var keys []string
+	for _, key := range tracked.keys {
+		if !slices.Contains(proj.IgnoreJiras, key) {
+			keys = append(keys, key)
+		}
 	}
+	return keys, nil
+}
 
-	if err := json.Unmarshal(respBody, &issueType); err != nil {
-		return nil, fmt.Errorf("failed to parse response: %w", err)
+// RemoteLinkURLs returns the URLs of the remote links of an issue.
+func RemoteLinkURLs(ctx context.Context, jira *config.JiraConfig, issueID string) ([]string, error) {
+	remoteLinks, err := getIssueRemoteLinks(ctx, jira, issueID)
+	if err != nil {
+		return nil, err
+	}
+	urls := make([]string, len(remoteLinks))
+	for i, link := range remoteLinks {
+		urls[i] = link.URL
 	}
+	return urls, nil
+}
 
-	var feature string
-	var epic string
-	var issuesToScrape []string
-	// Map to track epic for each issue
-	issueEpicMap := make(map[string]string)
+// AddRemoteLink creates a remote link on an issue. The URL doubles as the
+// global ID, so adding the same link twice updates it instead.
+func AddRemoteLink(ctx context.Context, jira *config.JiraConfig, issueID, linkURL, title string) error {
+	reqBody, err := json.Marshal(map[string]any{
+		"globalId": linkURL,
+		"object": map[string]string{
+			"url":   linkURL,
+			"title": title,
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to marshal remote link: %w", err)
+	}
 
-	switch issueType.Fields.IssueType.Name {
-	case "Feature":
-		feature = issueID
-		// Features can contain Epics and Issues
-		// Get all child items (Epics and Issues) linked to this Feature
-		childItems, err := getFeatureChildItems(ctx, jira, issueID)
-		if err != nil {
-			return nil, err
-		}
-		// Include the Feature itself to capture PRs linked directly to it
-		issuesToScrape = append([]string{issueID}, childItems...)
-		issueEpicMap[issueID] = "" // Feature itself has no epic
+	remoteLinkURL, err := url.JoinPath(jira.Host, apiPath(jira, "issue", issueID, "remotelink"))
+	if err != nil {
+		return err
+	}
 
-		// For each child item, if it's an Epic, also get its linked issues
-		for _, item := range childItems {
-			itemType, itemEpic, err := getIssueTypeAndEpic(ctx, jira, item)
-			if err != nil {
-				return nil, err
-			}
+	if _, err := jiraRequestPost(ctx, jira, remoteLinkURL, reqBody); err != nil {
+		return fmt.Errorf("failed to add remote link to %s: %w", issueID, err)
+	}
+	return nil
+}
 
-			if itemType == "Epic" {
-				// This child is an Epic
-				issueEpicMap[item] = item
-				linkedIssues, err := getEpicLinkedIssues(ctx, jira, item)
-				if err != nil {
-					return nil, err
-				}
-				// Add all issues linked to this Epic
-				for _, linkedIssue := range linkedIssues {
-					issuesToScrape = append(issuesToScrape, linkedIssue)
-					issueEpicMap[linkedIssue] = item
-				}
-			} else {
-				// Regular issue under Feature
-				issueEpicMap[item] = itemEpic
-			}
-		}
-	case "Epic":
-		epic = issueID
-		// Get all issues linked to this epic
-		linkedIssues, err := getEpicLinkedIssues(ctx, jira, issueID)
-		if err != nil {
-			return nil, err
-		}
-		// Include the Epic itself to capture PRs linked directly to it
-		issuesToScrape = append([]string{issueID}, linkedIssues...)
-		for _, issue := range issuesToScrape {
-			issueEpicMap[issue] = epic
-		}
-	default:
-		epic = issueType.Fields.ParentEpic
-		issuesToScrape = []string{issueID}
-		issueEpicMap[issueID] = epic
+// Ancestors returns the issues above key, top-most first, as far up as the
+// project's hierarchy depth reaches.
+func Ancestors(ctx context.Context, jira *config.JiraConfig, proj *config.ProjectConfig, key string) ([]string, error) {
+	if err := resolveFields(ctx, jira); err != nil {
+		return nil, err
 	}
+	return walkUp(ctx, jira, key, hierarchyDepth(proj))
+}
 
-	// Expand with issue-to-issue links (e.g. "is blocked by", "relates to")
-	seen := make(map[string]bool, len(issuesToScrape))
-	for _, issue := range issuesToScrape {
-		seen[issue] = true
+// TrackedRoot returns the issue of the project's jiras that one of keys is or
+// is below, or "" if there is none. Keys are tried in order, so the lowest
+// one should come first.
+func TrackedRoot(ctx context.Context, jira *config.JiraConfig, proj *config.ProjectConfig, keys ...string) (string, error) {
+	for _, key := range keys {
+		if key != "" && slices.Contains(proj.Jiras, key) {
+			return key, nil
+		}
 	}
-	for _, issue := range issuesToScrape {
-		if slices.Contains(ignoreJiras, issue) {
+	for _, key := range keys {
+		if key == "" {
 			continue
 		}
-		linkedIssues, err := getIssueLinkedIssues(ctx, jira, issue)
+		ancestors, err := Ancestors(ctx, jira, proj, key)
 		if err != nil {
-			return nil, err
+			return "", err
 		}
-		for _, linked := range linkedIssues {
-			if !seen[linked] {
-				seen[linked] = true
-				issuesToScrape = append(issuesToScrape, linked)
-				if _, exists := issueEpicMap[linked]; !exists {
-					issueEpicMap[linked] = issueEpicMap[issue]
-				}
+		for i := len(ancestors) - 1; i >= 0; i-- {
+			if slices.Contains(proj.Jiras, ancestors[i]) {
+				return ancestors[i], nil
 			}
 		}
 	}
+	return "", nil
+}
+
+// ExtractJiraPRs walks the Jira hierarchy below issueID (OCPSTRAT → Feature →
+// Epic → Issue and so on) and scrapes remote links from every issue found and
+// from the issues they link to, as allowed by the project's link config.
+func ExtractJiraPRs(ctx context.Context, jira *config.JiraConfig, proj *config.ProjectConfig, issueID string) (map[string]PR, error) {
+	return ExtractJiraPRsUnder(ctx, jira, proj, issueID, issueID, 0)
+}
+
+// ExtractJiraPRsUnder is ExtractJiraPRs for an issue level levels below the
+// tracked root. It only walks as deep as a walk from the root would, so that
+// both find the same PRs under the issue, and none if the issue is out of the
+// root's reach.
+func ExtractJiraPRsUnder(ctx context.Context, jira *config.JiraConfig, proj *config.ProjectConfig, root, issueID string, level int) (map[string]PR, error) {
+	if level > hierarchyDepth(proj) {
+		return map[string]PR{}, nil
+	}
+	tracked, err := collectIssues(ctx, jira, proj, issueID, level)
+	if err != nil {
+		return nil, err
+	}
+	issuesToScrape, hierarchy, linkPaths := tracked.keys, tracked.hierarchy, tracked.linkPaths
 
 	prs := map[string]PR{}
 	for _, issue := range issuesToScrape {
-		if slices.Contains(ignoreJiras, issue) {
+		if slices.Contains(proj.IgnoreJiras, issue) {
 			continue
 		}
-		remoteLinks, err := getIssueRemoteLinks(ctx, jira, issue)
+		remoteLinks, err := cachedRemoteLinks(ctx, jira, issue)
 		if err != nil {
 			return nil, err
 		}
 
+		iss, _ := cachedIssue(issue)
+		items := hierarchyItems(hierarchy[issue])
 		for _, link := range remoteLinks {
-			url := link.Object.URL
-			if !strings.Contains(url, "github.com") || !strings.Contains(url, "/pull") {
+			url := link.URL
+			if _, ok := provider.Parse(url); !ok {
 				continue
 			}
 			prs[url] = PR{
-				URL:         url,
-				Title:       link.Object.Title,
-				JiraIssue:   issue,
-				JiraEpic:    issueEpicMap[issue],
-				JiraFeature: feature,
+				URL:               url,
+				Title:             link.Title,
+				JiraIssue:         issue,
+				JiraEpic:          nearestOfType(items, "Epic"),
+				JiraFeature:       nearestOfType(items, "Feature"),
+				JiraRoot:          root,
+				Hierarchy:         items,
+				LinkPath:          linkPaths[issue],
+				JiraSprint:        iss.Sprint,
+				JiraTargetVersion: iss.TargetVersion,
+				JiraStatus:        iss.Status,
+				JiraAssignee:      iss.Assignee,
+				JiraPriority:      iss.Priority,
+				JiraFixVersion:    iss.FixVersion,
+				JiraExtra:         iss.Extra,
+				FromJira:          true,
 			}
 		}
 	}
@@ -186,153 +305,164 @@ func ExtractJiraPRs(ctx context.Context, jira *config.JiraConfig, issueID string
 	return prs, nil
 }
 
-func getFeatureChildItems(ctx context.Context, jira *config.JiraConfig, featureID string) ([]string, error) {
-	// Use JQL to find all Epics and Issues linked to this Feature
-	// This searches for items where the parent is the Feature
-	jql := fmt.Sprintf("parent = %s", featureID)
-
-	items, err := jiraSearchJQL(ctx, jira, jql)
-	if err != nil {
-		return nil, err
-	}
-
-	return items, nil
+// remoteLink is a link from a Jira issue to an external resource.
+type remoteLink struct {
+	URL   string
+	Title string
 }
 
-func getEpicLinkedIssues(ctx context.Context, jira *config.JiraConfig, epicID string) ([]string, error) {
-	// Use JQL to find all issues linked to this epic
-	jql := fmt.Sprintf("\"Epic Link\" = %s", epicID)
-
-	issues, err := jiraSearchJQL(ctx, jira, jql)
+func cachedRemoteLinks(ctx context.Context, jira *config.JiraConfig, issueID string) ([]remoteLink, error) {
+	cacheMu.Lock()
+	links, found := remoteLinkCache[issueID]
+	cacheMu.Unlock()
+	if found {
+		return links, nil
+	}
+	links, err := getIssueRemoteLinks(ctx, jira, issueID)
 	if err != nil {
 		return nil, err
 	}
-
-	return issues, nil
+	cacheMu.Lock()
+	remoteLinkCache[issueID] = links
+	cacheMu.Unlock()
+	return links, nil
 }
 
-func getIssueTypeAndEpic(ctx context.Context, jira *config.JiraConfig, issueID string) (string, string, error) {
-	respBody, err := jiraRequest(ctx, jira, fmt.Sprintf("rest/api/2/issue/%s", issueID))
-	if err != nil {
-		return "", "", err
-	}
-
-	var issueData struct {
-		Fields struct {
-			IssueType struct {
-				Name string `json:"name"`
-			} `json:"issuetype"`
-			ParentEpic string `json:"customfield_12311140"`
-		} `json:"fields"`
-	}
-
-	if err := json.Unmarshal(respBody, &issueData); err != nil {
-		return "", "", fmt.Errorf("failed to parse response: %w", err)
-	}
-
-	return issueData.Fields.IssueType.Name, issueData.Fields.ParentEpic, nil
-}
-
-func getIssueLinkedIssues(ctx context.Context, jira *config.JiraConfig, issueID string) ([]string, error) {
-	respBody, err := jiraRequest(ctx, jira, fmt.Sprintf("rest/api/2/issue/%s", issueID))
+func getIssueRemoteLinks(ctx context.Context, jira *config.JiraConfig, issueID string) ([]remoteLink, error) {
+	respBody, err := jiraRequest(ctx, jira, apiPath(jira, "issue", issueID, "remotelink"))
 	if err != nil {
 		return nil, err
 	}
 
-	var issueData struct {
-		Fields struct {
-			IssueLinks []struct {
-				InwardIssue *struct {
-					Key string `json:"key"`
-				} `json:"inwardIssue"`
-				OutwardIssue *struct {
-					Key string `json:"key"`
-				} `json:"outwardIssue"`
-			} `json:"issuelinks"`
-		} `json:"fields"`
+	// Cloud may leave the title empty and put the text in the summary, and
+	// some integrations only set the global ID to the URL
+	var rawLinks []struct {
+		GlobalID string `json:"globalId"`
+		Object   struct {
+			URL     string `json:"url"`
+			Title   string `json:"title"`
+			Summary string `json:"summary"`
+		} `json:"object"`
 	}
 
-	if err := json.Unmarshal(respBody, &issueData); err != nil {
-		return nil, fmt.Errorf("failed to parse issue links: %w", err)
+	if err := json.Unmarshal(respBody, &rawLinks); err != nil {
+		return nil, fmt.Errorf("failed to parse remote links: %w", err)
 	}
 
-	var keys []string
-	for _, link := range issueData.Fields.IssueLinks {
-		if link.InwardIssue != nil {
-			keys = append(keys, link.InwardIssue.Key)
+	remoteLinks := make([]remoteLink, 0, len(rawLinks))
+	for _, raw := range rawLinks {
+		link := remoteLink{URL: raw.Object.URL, Title: raw.Object.Title}
+		if link.URL == "" {
+			if u, found := strings.CutPrefix(raw.GlobalID, "url="); found {
+				link.URL = u
+			} else if strings.HasPrefix(raw.GlobalID, "http") {
+				link.URL = raw.GlobalID
+			}
 		}
-		if link.OutwardIssue != nil {
-			keys = append(keys, link.OutwardIssue.Key)
+		if link.Title == "" {
+			link.Title = raw.Object.Summary
 		}
+		remoteLinks = append(remoteLinks, link)
 	}
 
-	return keys, nil
+	return remoteLinks, nil
 }
 
-func getIssueRemoteLinks(ctx context.Context, jira *config.JiraConfig, issueID string) ([]struct {
-	ID     int    `json:"id"`
-	Self   string `json:"self"`
-	Object struct {
-		URL   string `json:"url"`
-		Title string `json:"title"`
-	} `json:"object"`
-}, error) {
-	respBody, err := jiraRequest(ctx, jira, fmt.Sprintf("rest/api/2/issue/%s/remotelink", issueID))
-	if err != nil {
-		return nil, err
-	}
-
-	var remoteLinks []struct {
-		ID     int    `json:"id"`
-		Self   string `json:"self"`
-		Object struct {
-			URL   string `json:"url"`
-			Title string `json:"title"`
-		} `json:"object"`
-	}
+// jiraSearch returns all issues matching jql, following pagination, and adds
+// them to the issue cache.
+func jiraSearch(ctx context.Context, jira *config.JiraConfig, jql string) ([]*issue, error) {
+	pageSize := jira.PageSize
+	if pageSize <= 0 {
+		pageSize = defaultPageSize
+	}
+
+	var issues []*issue
+	var startAt int
+	var nextPageToken string
+	for {
+		req := map[string]interface{}{
+			"jql":        jql,
+			"fields":     issueFields(jira),
+			"maxResults": pageSize,
+		}
+		// Cloud pages with an opaque token, Server/DC with an offset
+		if nextPageToken != "" {
+			req["nextPageToken"] = nextPageToken
+		} else if startAt > 0 {
+			req["startAt"] = startAt
+		}
 
-	if err := json.Unmarshal(respBody, &remoteLinks); err != nil {
-		return nil, fmt.Errorf("failed to parse remote links: %w", err)
-	}
+		reqBody, err := json.Marshal(req)
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal search request: %w", err)
+		}
 
-	return remoteLinks, nil
-}
+		respBody, err := jiraSearchPost(ctx, jira, reqBody)
+		if err != nil {
+			return nil, err
+		}
 
-func jiraSearchJQL(ctx context.Context, jira *config.JiraConfig, jql string) ([]string, error) {
-	searchURL, err := url.JoinPath(jira.Host, "rest/api/2/search/jql")
-	if err != nil {
-		return nil, err
-	}
+		var searchResult struct {
+			Issues        []rawIssue `json:"issues"`
+			NextPageToken string     `json:"nextPageToken"`
+			IsLast        *bool      `json:"isLast"`
+			StartAt       int        `json:"startAt"`
+			Total         *int       `json:"total"`
+		}
 
-	reqBody, err := json.Marshal(map[string]interface{}{
-		"jql":    jql,
-		"fields": []string{"key"},
-	})
-	if err != nil {
-		return nil, fmt.Errorf("failed to marshal search request: %w", err)
-	}
+		if err := json.Unmarshal(respBody, &searchResult); err != nil {
+			return nil, fmt.Errorf("failed to parse search result: %w", err)
+		}
 
-	respBody, err := jiraRequestPost(ctx, jira, searchURL, reqBody)
-	if err != nil {
-		return nil, err
-	}
+		for _, raw := range searchResult.Issues {
+			iss, err := raw.toIssue(jira)
+			if err != nil {
+				return nil, err
+			}
+			cacheIssue(iss)
+			issues = append(issues, iss)
+		}
 
-	var searchResult struct {
-		Issues []struct {
-			Key string `json:"key"`
-		} `json:"issues"`
+		switch {
+		case len(searchResult.Issues) == 0:
+			return issues, nil
+		case searchResult.NextPageToken != "":
+			if searchResult.IsLast != nil && *searchResult.IsLast {
+				return issues, nil
+			}
+			nextPageToken = searchResult.NextPageToken
+		case searchResult.Total != nil:
+			startAt = searchResult.StartAt + len(searchResult.Issues)
+			if startAt >= *searchResult.Total {
+				return issues, nil
+			}
+		default:
+			return issues, nil
+		}
 	}
+}
 
-	if err := json.Unmarshal(respBody, &searchResult); err != nil {
-		return nil, fmt.Errorf("failed to parse search result: %w", err)
-	}
+// jiraSearchPost posts a search request, preferring the enhanced search
+// endpoint and falling back to the classic one on instances that lack it.
+func jiraSearchPost(ctx context.Context, jira *config.JiraConfig, reqBody []byte) ([]byte, error) {
+	for {
+		path := apiPath(jira, "search", "jql")
+		if legacySearch.Load() {
+			path = apiPath(jira, "search")
+		}
+		searchURL, err := url.JoinPath(jira.Host, path)
+		if err != nil {
+			return nil, err
+		}
 
-	keys := make([]string, len(searchResult.Issues))
-	for i, issue := range searchResult.Issues {
-		keys[i] = issue.Key
+		respBody, err := jiraRequestPost(ctx, jira, searchURL, reqBody)
+		var statusErr *statusError
+		if !legacySearch.Load() && errors.As(err, &statusErr) && statusErr.code == http.StatusNotFound {
+			legacySearch.Store(true)
+			continue
+		}
+		return respBody, err
 	}
-
-	return keys, nil
 }
 
 func jiraRequestPost(ctx context.Context, jira *config.JiraConfig, url string, body []byte) ([]byte, error) {
@@ -341,27 +471,45 @@ func jiraRequestPost(ctx context.Context, jira *config.JiraConfig, url string, b
 		return nil, fmt.Errorf("failed to create request: %w", err)
 	}
 
-	req.Header.Set("Authorization", fmt.Sprintf("Basic %s", base64.StdEncoding.EncodeToString([]byte(jira.Email+":"+jira.Token))))
+	if err := setAuth(req, jira); err != nil {
+		return nil, err
+	}
 	req.Header.Set("Content-Type", "application/json")
 
-	client := &http.Client{}
-	resp, err := client.Do(req)
+	resp, err := httpclient.Do(req)
 	if err != nil {
-		return nil, fmt.Errorf("failed to send request: %w", err)
+		return nil, err
 	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		respBody, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("unexpected status code %d: %s", resp.StatusCode, string(respBody))
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated {
+		return nil, &statusError{code: resp.StatusCode, body: string(resp.Body)}
 	}
 
-	respBody, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return nil, fmt.Errorf("failed to read response body: %w", err)
+	return resp.Body, nil
+}
+
+// setAuth sets the Authorization header according to the configured mode.
+func setAuth(req *http.Request, jira *config.JiraConfig) error {
+	switch jira.Auth {
+	case "", config.JiraAuthBasic, config.JiraAuthCloud:
+		req.Header.Set("Authorization", fmt.Sprintf("Basic %s", base64.StdEncoding.EncodeToString([]byte(jira.Email+":"+jira.Token))))
+	case config.JiraAuthBearer:
+		req.Header.Set("Authorization", "Bearer "+jira.Token)
+	default:
+		return fmt.Errorf("unknown Jira auth mode %q", jira.Auth)
 	}
+	return nil
+}
 
-	return respBody, nil
+// apiPath joins elems to the REST API base path of the configured version.
+func apiPath(jira *config.JiraConfig, elems ...string) string {
+	version := jira.APIVersion
+	if version == 0 {
+		version = 2
+		if jira.Auth == config.JiraAuthCloud {
+			version = 3
+		}
+	}
+	return path.Join(append([]string{"rest/api", strconv.Itoa(version)}, elems...)...)
 }
 
 func jiraRequest(ctx context.Context, jira *config.JiraConfig, path string) ([]byte, error) {
@@ -378,25 +526,18 @@ func jiraRequestURL(ctx context.Context, jira *config.JiraConfig, url string) ([
 		return nil, fmt.Errorf("failed to create request: %w", err)
 	}
 
-	req.Header.Set("Authorization", fmt.Sprintf("Basic %s", base64.StdEncoding.EncodeToString([]byte(jira.Email+":"+jira.Token))))
+	if err := setAuth(req, jira); err != nil {
+		return nil, err
+	}
 	req.Header.Set("Content-Type", "application/json")
 
-	client := &http.Client{}
-	resp, err := client.Do(req)
+	resp, err := httpclient.Do(req)
 	if err != nil {
-		return nil, fmt.Errorf("failed to send request: %w", err)
+		return nil, err
 	}
-	defer resp.Body.Close()
-
 	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("unexpected status code %d: %s", resp.StatusCode, string(body))
-	}
-
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return nil, fmt.Errorf("failed to read response body: %w", err)
+		return nil, &statusError{code: resp.StatusCode, body: string(resp.Body)}
 	}
 
-	return body, nil
+	return resp.Body, nil
 }
@@ -0,0 +1,297 @@
+package jira
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"jira2gh/pkg/config"
+	"jira2gh/pkg/httpclient"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// fakeJira answers Jira requests with what respond returns for their path and
+// JSON body, without any network.
+type fakeJira struct {
+	respond  func(path string, body map[string]any) (int, string)
+	requests []string
+	// auths holds the Authorization header of every request
+	auths []string
+}
+
+func (f *fakeJira) Send(req *http.Request) (*httpclient.Response, error) {
+	var body map[string]any
+	if req.Body != nil {
+		data, err := io.ReadAll(req.Body)
+		if err != nil {
+			return nil, err
+		}
+		if len(data) > 0 {
+			if err := json.Unmarshal(data, &body); err != nil {
+				return nil, err
+			}
+		}
+	}
+	f.requests = append(f.requests, req.URL.Path)
+	f.auths = append(f.auths, req.Header.Get("Authorization"))
+	code, resp := f.respond(req.URL.Path, body)
+	return &httpclient.Response{StatusCode: code, Header: http.Header{}, Body: []byte(resp)}, nil
+}
+
+// useFakeJira sends all requests of the test to a fakeJira.
+func useFakeJira(t *testing.T, respond func(path string, body map[string]any) (int, string)) *fakeJira {
+	t.Helper()
+	fake := &fakeJira{respond: respond}
+	httpclient.SetBackend(fake)
+	ResetCache()
+	legacySearch.Store(false)
+	t.Cleanup(func() {
+		httpclient.SetBackend(httpclient.Network{})
+		ResetCache()
+		legacySearch.Store(false)
+	})
+	return fake
+}
+
+// searchPage returns a search result holding issues with the given keys,
+// followed by the paging fields in extra.
+func searchPage(extra string, keys ...string) string {
+	issues := []string{}
+	for _, key := range keys {
+		issues = append(issues, fmt.Sprintf(`{"key": %q, "fields": {"issuetype": {"name": "Story"}}}`, key))
+	}
+	return fmt.Sprintf(`{"issues": [%s]%s}`, strings.Join(issues, ", "), extra)
+}
+
+func issueKeys(issues []*issue) []string {
+	var keys []string
+	for _, iss := range issues {
+		keys = append(keys, iss.Key)
+	}
+	return keys
+}
+
+func TestJiraSearchPagination(t *testing.T) {
+	tests := []struct {
+		name string
+		// pages are returned in order, one per request
+		pages []string
+		// wantPaging holds the nextPageToken or startAt of every request
+		wantPaging []string
+		wantKeys   []string
+	}{
+		{
+			name: "next page token until the last page",
+			pages: []string{
+				searchPage(`, "nextPageToken": "t1", "isLast": false`, "A-1", "A-2"),
+				searchPage(`, "nextPageToken": "t2", "isLast": true`, "A-3"),
+			},
+			wantPaging: []string{"", "t1"},
+			wantKeys:   []string{"A-1", "A-2", "A-3"},
+		},
+		{
+			name: "next page token until an empty page",
+			pages: []string{
+				searchPage(`, "nextPageToken": "t1"`, "A-1"),
+				searchPage(`, "nextPageToken": "t2"`, "A-2"),
+				searchPage(``),
+			},
+			wantPaging: []string{"", "t1", "t2"},
+			wantKeys:   []string{"A-1", "A-2"},
+		},
+		{
+			name: "start at until the total",
+			pages: []string{
+				searchPage(`, "startAt": 0, "total": 3`, "A-1", "A-2"),
+				searchPage(`, "startAt": 2, "total": 3`, "A-3"),
+			},
+			wantPaging: []string{"", "2"},
+			wantKeys:   []string{"A-1", "A-2", "A-3"},
+		},
+		{
+			name:       "single page without paging fields",
+			pages:      []string{searchPage(``, "A-1")},
+			wantPaging: []string{""},
+			wantKeys:   []string{"A-1"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var paging []string
+			useFakeJira(t, func(path string, body map[string]any) (int, string) {
+				if len(paging) == len(tt.pages) {
+					t.Fatalf("unexpected request %d", len(paging)+1)
+				}
+				switch {
+				case body["nextPageToken"] != nil:
+					paging = append(paging, fmt.Sprint(body["nextPageToken"]))
+				case body["startAt"] != nil:
+					paging = append(paging, fmt.Sprint(body["startAt"]))
+				default:
+					paging = append(paging, "")
+				}
+				return http.StatusOK, tt.pages[len(paging)-1]
+			})
+
+			issues, err := jiraSearch(t.Context(), &config.JiraConfig{Host: "https://jira.example.com"}, "project = A")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := issueKeys(issues); !slices.Equal(got, tt.wantKeys) {
+				t.Errorf("got issues %v, want %v", got, tt.wantKeys)
+			}
+			if !slices.Equal(paging, tt.wantPaging) {
+				t.Errorf("got pages %q, want %q", paging, tt.wantPaging)
+			}
+		})
+	}
+}
+
+func TestJiraSearchFallsBackToLegacySearch(t *testing.T) {
+	fake := useFakeJira(t, func(path string, body map[string]any) (int, string) {
+		if path == "/rest/api/2/search/jql" {
+			return http.StatusNotFound, `{"errorMessages": ["not found"]}`
+		}
+		return http.StatusOK, searchPage(`, "startAt": 0, "total": 1`, "A-1")
+	})
+
+	jiraCfg := &config.JiraConfig{Host: "https://jira.example.com"}
+	for range 2 {
+		issues, err := jiraSearch(t.Context(), jiraCfg, "project = A")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := issueKeys(issues); !slices.Equal(got, []string{"A-1"}) {
+			t.Errorf("got issues %v, want [A-1]", got)
+		}
+	}
+
+	// the enhanced endpoint is only tried once
+	want := []string{"/rest/api/2/search/jql", "/rest/api/2/search", "/rest/api/2/search"}
+	if !slices.Equal(fake.requests, want) {
+		t.Errorf("got requests %v, want %v", fake.requests, want)
+	}
+}
+
+func TestAuthModes(t *testing.T) {
+	v3Links, err := os.ReadFile(filepath.Join("testdata", "remotelink-v3.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	const v2Links = `[{"globalId": "url=https://github.com/o/r/pull/1", "object": {"url": "https://github.com/o/r/pull/1", "title": "o/r#1"}}]`
+	v2Want := []remoteLink{{URL: "https://github.com/o/r/pull/1", Title: "o/r#1"}}
+	// Cloud leaves titles to the summary and URLs to the global ID
+	v3Want := []remoteLink{
+		{URL: "https://github.com/o/r/pull/1", Title: "Fix the sync of epics"},
+		{URL: "https://github.com/o/r/pull/2", Title: "o/r#2: Retry on rate limits"},
+		{URL: "https://gitlab.com/g/p/-/merge_requests/3", Title: "Add GitLab support"},
+	}
+
+	tests := []struct {
+		name      string
+		jira      config.JiraConfig
+		links     string
+		wantAuth  string
+		wantAPI   string
+		wantLinks []remoteLink
+		wantErr   bool
+	}{
+		{
+			name:      "default",
+			jira:      config.JiraConfig{Email: "me@example.com", Token: "secret"},
+			links:     v2Links,
+			wantAuth:  "Basic bWVAZXhhbXBsZS5jb206c2VjcmV0",
+			wantAPI:   "/rest/api/2",
+			wantLinks: v2Want,
+		},
+		{
+			name:      "basic",
+			jira:      config.JiraConfig{Auth: config.JiraAuthBasic, Email: "me@example.com", Token: "secret"},
+			links:     v2Links,
+			wantAuth:  "Basic bWVAZXhhbXBsZS5jb206c2VjcmV0",
+			wantAPI:   "/rest/api/2",
+			wantLinks: v2Want,
+		},
+		{
+			name:      "bearer",
+			jira:      config.JiraConfig{Auth: config.JiraAuthBearer, Token: "secret"},
+			links:     v2Links,
+			wantAuth:  "Bearer secret",
+			wantAPI:   "/rest/api/2",
+			wantLinks: v2Want,
+		},
+		{
+			name:      "cloud uses v3",
+			jira:      config.JiraConfig{Auth: config.JiraAuthCloud, Email: "me@example.com", Token: "secret"},
+			links:     string(v3Links),
+			wantAuth:  "Basic bWVAZXhhbXBsZS5jb206c2VjcmV0",
+			wantAPI:   "/rest/api/3",
+			wantLinks: v3Want,
+		},
+		{
+			name:      "cloud pinned to v2",
+			jira:      config.JiraConfig{Auth: config.JiraAuthCloud, APIVersion: 2, Email: "me@example.com", Token: "secret"},
+			links:     v2Links,
+			wantAuth:  "Basic bWVAZXhhbXBsZS5jb206c2VjcmV0",
+			wantAPI:   "/rest/api/2",
+			wantLinks: v2Want,
+		},
+		{
+			name:      "bearer on v3",
+			jira:      config.JiraConfig{Auth: config.JiraAuthBearer, APIVersion: 3, Token: "secret"},
+			links:     string(v3Links),
+			wantAuth:  "Bearer secret",
+			wantAPI:   "/rest/api/3",
+			wantLinks: v3Want,
+		},
+		{
+			name:    "unknown mode",
+			jira:    config.JiraConfig{Auth: "oauth", Token: "secret"},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := useFakeJira(t, func(path string, body map[string]any) (int, string) {
+				if strings.HasSuffix(path, "/remotelink") {
+					return http.StatusOK, tt.links
+				}
+				return http.StatusOK, searchPage(``, "A-1")
+			})
+
+			tt.jira.Host = "https://jira.example.com"
+			links, err := getIssueRemoteLinks(t.Context(), &tt.jira, "A-1")
+			if tt.wantErr {
+				if err == nil || len(fake.requests) > 0 {
+					t.Errorf("got error %v after %d requests, want an error before any", err, len(fake.requests))
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !slices.Equal(links, tt.wantLinks) {
+				t.Errorf("got links %v, want %v", links, tt.wantLinks)
+			}
+			if _, err := jiraSearch(t.Context(), &tt.jira, "project = A"); err != nil {
+				t.Fatal(err)
+			}
+
+			wantRequests := []string{tt.wantAPI + "/issue/A-1/remotelink", tt.wantAPI + "/search/jql"}
+			if !slices.Equal(fake.requests, wantRequests) {
+				t.Errorf("got requests %v, want %v", fake.requests, wantRequests)
+			}
+			for _, auth := range fake.auths {
+				if auth != tt.wantAuth {
+					t.Errorf("got Authorization %q, want %q", auth, tt.wantAuth)
+				}
+			}
+		})
+	}
+}
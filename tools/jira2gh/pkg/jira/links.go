@@ -0,0 +1,91 @@
+package jira
+
+import (
+	"context"
+	"jira2gh/pkg/config"
+	"slices"
+	"strings"
+)
+
+// defaultLinkDepth follows links of the issues in the hierarchy, but not the
+// links of the issues found that way.
+const defaultLinkDepth = 1
+
+// IssueLink is one step of the link path that brought an issue into the sync.
+type IssueLink struct {
+	From     string
+	Relation string
+	To       string
+}
+
+func (l IssueLink) String() string {
+	return l.From + " " + l.Relation + " " + l.To
+}
+
+// expandLinks follows the issue links allowed by the project's link config,
+// starting from issues, for up to the configured depth. It returns the issues
+// found that way in the order they were found, along with the path of links
+// that led to each of them.
+func expandLinks(ctx context.Context, jira *config.JiraConfig, proj *config.ProjectConfig, issues []string) ([]string, map[string][]IssueLink, error) {
+	depth := defaultLinkDepth
+	if proj.Links.Depth != nil {
+		depth = *proj.Links.Depth
+	}
+
+	seen := make(map[string]bool, len(issues))
+	for _, issue := range issues {
+		seen[issue] = true
+	}
+
+	var found []string
+	paths := map[string][]IssueLink{}
+	level := issues
+	for d := 0; d < depth && len(level) > 0; d++ {
+		if err := loadIssues(ctx, jira, level); err != nil {
+			return nil, nil, err
+		}
+
+		var next []string
+		for _, issue := range level {
+			if slices.Contains(proj.IgnoreJiras, issue) {
+				continue
+			}
+			iss, err := getIssue(ctx, jira, issue)
+			if err != nil {
+				return nil, nil, err
+			}
+			for _, link := range iss.Links {
+				if seen[link.Key] || !linkAllowed(proj.Links, link) {
+					continue
+				}
+				seen[link.Key] = true
+				paths[link.Key] = append(slices.Clone(paths[issue]), IssueLink{
+					From:     issue,
+					Relation: link.Relation,
+					To:       link.Key,
+				})
+				found = append(found, link.Key)
+				next = append(next, link.Key)
+			}
+		}
+		level = next
+	}
+
+	return found, paths, nil
+}
+
+// linkAllowed reports whether a link passes the allow and deny rules. With no
+// allow rules every link is allowed unless denied.
+func linkAllowed(cfg config.LinkConfig, link issueLink) bool {
+	matches := func(rule config.LinkRule) bool {
+		if rule.Direction != "" && !strings.EqualFold(rule.Direction, link.Direction) {
+			return false
+		}
+		return strings.EqualFold(rule.Type, link.Type) || strings.EqualFold(rule.Type, link.Relation)
+	}
+
+	if slices.ContainsFunc(cfg.Deny, matches) {
+		return false
+	}
+	return len(cfg.Allow) == 0 || slices.ContainsFunc(cfg.Allow, matches)
+}
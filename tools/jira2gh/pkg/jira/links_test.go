@@ -0,0 +1,174 @@
+package jira
+
+import (
+	"jira2gh/pkg/config"
+	"net/http"
+	"reflect"
+	"slices"
+	"testing"
+)
+
+func TestLinkAllowed(t *testing.T) {
+	blocks := issueLink{Key: "A-2", Type: "Blocks", Relation: "is blocked by", Direction: "inward"}
+	clones := issueLink{Key: "A-3", Type: "Cloners", Relation: "clones", Direction: "outward"}
+
+	tests := []struct {
+		name string
+		cfg  config.LinkConfig
+		link issueLink
+		want bool
+	}{
+		{
+			name: "no rules",
+			link: blocks,
+			want: true,
+		},
+		{
+			name: "allowed by type",
+			cfg:  config.LinkConfig{Allow: []config.LinkRule{{Type: "blocks"}}},
+			link: blocks,
+			want: true,
+		},
+		{
+			name: "allowed by relation",
+			cfg:  config.LinkConfig{Allow: []config.LinkRule{{Type: "Is Blocked By"}}},
+			link: blocks,
+			want: true,
+		},
+		{
+			name: "not allowed",
+			cfg:  config.LinkConfig{Allow: []config.LinkRule{{Type: "Blocks"}}},
+			link: clones,
+			want: false,
+		},
+		{
+			name: "allowed in the link's direction",
+			cfg:  config.LinkConfig{Allow: []config.LinkRule{{Type: "Blocks", Direction: "inward"}}},
+			link: blocks,
+			want: true,
+		},
+		{
+			name: "allowed in the other direction only",
+			cfg:  config.LinkConfig{Allow: []config.LinkRule{{Type: "Blocks", Direction: "outward"}}},
+			link: blocks,
+			want: false,
+		},
+		{
+			name: "denied",
+			cfg:  config.LinkConfig{Deny: []config.LinkRule{{Type: "Cloners"}}},
+			link: clones,
+			want: false,
+		},
+		{
+			name: "not denied",
+			cfg:  config.LinkConfig{Deny: []config.LinkRule{{Type: "Cloners"}}},
+			link: blocks,
+			want: true,
+		},
+		{
+			name: "deny wins over allow",
+			cfg: config.LinkConfig{
+				Allow: []config.LinkRule{{Type: "Blocks"}},
+				Deny:  []config.LinkRule{{Type: "is blocked by"}},
+			},
+			link: blocks,
+			want: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := linkAllowed(tt.cfg, tt.link); got != tt.want {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExpandLinks(t *testing.T) {
+	depth := func(d int) *int { return &d }
+
+	tests := []struct {
+		name      string
+		links     config.LinkConfig
+		ignore    []string
+		wantFound []string
+		wantPaths map[string][]IssueLink
+	}{
+		{
+			name:      "one link away by default",
+			wantFound: []string{"A-2", "A-3"},
+			wantPaths: map[string][]IssueLink{
+				"A-2": {{From: "A-1", Relation: "is blocked by", To: "A-2"}},
+				"A-3": {{From: "A-1", Relation: "clones", To: "A-3"}},
+			},
+		},
+		{
+			name:      "further links with a larger depth",
+			links:     config.LinkConfig{Depth: depth(2)},
+			wantFound: []string{"A-2", "A-3", "A-4"},
+			wantPaths: map[string][]IssueLink{
+				"A-2": {{From: "A-1", Relation: "is blocked by", To: "A-2"}},
+				"A-3": {{From: "A-1", Relation: "clones", To: "A-3"}},
+				"A-4": {
+					{From: "A-1", Relation: "is blocked by", To: "A-2"},
+					{From: "A-2", Relation: "relates to", To: "A-4"},
+				},
+			},
+		},
+		{
+			name:      "disabled",
+			links:     config.LinkConfig{Depth: depth(0)},
+			wantPaths: map[string][]IssueLink{},
+		},
+		{
+			name:      "denied links are not followed",
+			links:     config.LinkConfig{Depth: depth(2), Deny: []config.LinkRule{{Type: "Blocks"}}},
+			wantFound: []string{"A-3"},
+			wantPaths: map[string][]IssueLink{
+				"A-3": {{From: "A-1", Relation: "clones", To: "A-3"}},
+			},
+		},
+		{
+			name:      "links of ignored issues are not followed",
+			links:     config.LinkConfig{Depth: depth(2)},
+			ignore:    []string{"A-2"},
+			wantFound: []string{"A-2", "A-3"},
+			wantPaths: map[string][]IssueLink{
+				"A-2": {{From: "A-1", Relation: "is blocked by", To: "A-2"}},
+				"A-3": {{From: "A-1", Relation: "clones", To: "A-3"}},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			useFakeJira(t, func(path string, body map[string]any) (int, string) {
+				t.Fatalf("unexpected request to %s", path)
+				return http.StatusInternalServerError, ""
+			})
+			cacheIssue(&issue{Key: "A-1", Links: []issueLink{
+				{Key: "A-2", Type: "Blocks", Relation: "is blocked by", Direction: "inward"},
+				{Key: "A-3", Type: "Cloners", Relation: "clones", Direction: "outward"},
+			}})
+			cacheIssue(&issue{Key: "A-2", Links: []issueLink{
+				{Key: "A-1", Type: "Blocks", Relation: "blocks", Direction: "outward"},
+				{Key: "A-4", Type: "Relates", Relation: "relates to", Direction: "outward"},
+			}})
+			cacheIssue(&issue{Key: "A-3"})
+			cacheIssue(&issue{Key: "A-4"})
+
+			proj := &config.ProjectConfig{Links: tt.links, IgnoreJiras: tt.ignore}
+			found, paths, err := expandLinks(t.Context(), &config.JiraConfig{}, proj, []string{"A-1"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !slices.Equal(found, tt.wantFound) {
+				t.Errorf("got found %v, want %v", found, tt.wantFound)
+			}
+			if !reflect.DeepEqual(paths, tt.wantPaths) {
+				t.Errorf("got paths %v, want %v", paths, tt.wantPaths)
+			}
+		})
+	}
+}
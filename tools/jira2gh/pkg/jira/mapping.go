@@ -0,0 +1,203 @@
+package jira
+
+import (
+	"jira2gh/pkg/config"
+	"jira2gh/pkg/provider"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Value returns the value of a field mapping source for the PR, see
+// config.FieldSources.
+func (pr *PR) Value(source string) string {
+	if id, found := strings.CutPrefix(source, config.JiraFieldSource); found {
+		return pr.JiraExtra[id]
+	}
+
+	switch source {
+	case "pr.url":
+		return pr.URL
+	case "pr.title":
+		return pr.Title
+	case "pr.author":
+		return pr.Author
+	case "pr.state":
+		return pr.State
+	case "pr.checks":
+		return pr.Checks
+	case "pr.draft":
+		return strconv.FormatBool(pr.Draft)
+	case "pr.mergeable":
+		return pr.Mergeable
+	case "pr.updated_at":
+		if pr.UpdatedAt.IsZero() {
+			return ""
+		}
+		return pr.UpdatedAt.Format(time.DateOnly)
+	case "pr.staleness":
+		return pr.Staleness
+	case "pr.review":
+		return pr.Review
+	case "pr.repo", "pr.number":
+		ref, ok := provider.Parse(pr.URL)
+		if !ok {
+			return ""
+		}
+		if source == "pr.repo" {
+			return ref.Repo
+		}
+		return ref.Number
+	case "jira.issue":
+		return pr.JiraIssue
+	case "jira.epic":
+		return pr.JiraEpic
+	case "jira.feature":
+		return pr.JiraFeature
+	case "jira.status":
+		return pr.JiraStatus
+	case "jira.assignee":
+		return pr.JiraAssignee
+	case "jira.priority":
+		return pr.JiraPriority
+	case "jira.fix_version":
+		return pr.JiraFixVersion
+	case "jira.sprint":
+		return pr.JiraSprint
+	case "jira.target_version":
+		return pr.JiraTargetVersion
+	case "summary.jobs":
+		return pr.JobSummary
+	case "summary.failed_jobs":
+		return provider.FormatJobs(pr.FailedJobs, pr.Retests)
+	}
+	return ""
+}
+
+// Known reports whether the value of a source was read during this run, so
+// that a field mapped from it may be cleared when the value is empty.
+func (pr *PR) Known(source string) bool {
+	switch {
+	case strings.HasPrefix(source, "jira."):
+		return pr.FromJira
+	case strings.HasPrefix(source, "pr.") || strings.HasPrefix(source, "summary."):
+		return pr.HasDetails
+	}
+	return false
+}
+
+// Metadata returns the project field values of the PR according to the given
+// mappings. Fields whose value is empty are left out.
+func (pr *PR) Metadata(mappings []config.FieldMapping) map[string]string {
+	metadata := map[string]string{}
+	for _, m := range mappings {
+		value := pr.Value(m.Source)
+		if mapped, found := m.Values[value]; found {
+			value = mapped
+		}
+		if value != "" {
+			metadata[m.Field] = value
+		}
+	}
+	return metadata
+}
+
+// FieldValues returns the project field values of the PR from the project's
+// field mappings and rules, along with the values set by rules. Planned
+// field values take precedence over both.
+func (pr *PR) FieldValues(proj *config.ProjectConfig) (map[string]string, []Transition) {
+	if pr.PlannedFields != nil {
+		return maps.Clone(pr.PlannedFields), nil
+	}
+	values := pr.Metadata(proj.FieldMappings())
+	transitions := pr.EvalRules(proj.Rules)
+	for _, t := range transitions {
+		values[t.Field] = t.Value
+	}
+	return values, transitions
+}
+
+// Transition is a field value set by a rule.
+type Transition struct {
+	Field string
+	Value string
+	Rule  string
+}
+
+// EvalRules returns the field values set by the rules matching the PR. When
+// several rules set the same field, the first one wins.
+func (pr *PR) EvalRules(rules []config.Rule) []Transition {
+	var transitions []Transition
+	set := map[string]bool{}
+	for _, rule := range rules {
+		if !pr.matches(rule) {
+			continue
+		}
+		for _, field := range slices.Sorted(maps.Keys(rule.Set)) {
+			if set[field] {
+				continue
+			}
+			set[field] = true
+			transitions = append(transitions, Transition{Field: field, Value: rule.Set[field], Rule: rule.String()})
+		}
+	}
+	return transitions
+}
+
+// matches reports whether the PR satisfies all conditions of the rule.
+func (pr *PR) matches(rule config.Rule) bool {
+	for source, values := range rule.When {
+		value := pr.Value(source)
+		if !slices.ContainsFunc(values, func(v string) bool { return strings.EqualFold(v, value) }) {
+			return false
+		}
+	}
+	return true
+}
+
+// CopyJira copies everything that was read from Jira from another PR, so
+// that PRs already in the project can be updated from the current Jira state.
+func (pr *PR) CopyJira(from PR) {
+	pr.JiraFeature = from.JiraFeature
+	pr.JiraEpic = from.JiraEpic
+	pr.JiraIssue = from.JiraIssue
+	pr.JiraRoot = from.JiraRoot
+	pr.JiraSprint = from.JiraSprint
+	pr.JiraTargetVersion = from.JiraTargetVersion
+	pr.JiraStatus = from.JiraStatus
+	pr.JiraAssignee = from.JiraAssignee
+	pr.JiraPriority = from.JiraPriority
+	pr.JiraFixVersion = from.JiraFixVersion
+	pr.JiraExtra = from.JiraExtra
+	pr.Hierarchy = from.Hierarchy
+	pr.LinkPath = from.LinkPath
+	pr.FromJira = from.FromJira
+}
+
+// Staleness values of PRs that need attention. A PR that needs a rebase is
+// flagged as such even if it is stale as well.
+const (
+	StalenessNeedsRebase = "needs rebase"
+	StalenessStale       = "stale"
+)
+
+// needsRebaseLabel is set by Prow on PRs with merge conflicts.
+const needsRebaseLabel = "needs-rebase"
+
+// SetStaleness flags the PR if it is open and needs a rebase, or has had no
+// activity for longer than the project allows.
+func (pr *PR) SetStaleness(cfg config.StalenessConfig, now time.Time) {
+	pr.Staleness = ""
+	if pr.State != "OPEN" {
+		return
+	}
+	if pr.Mergeable == provider.Conflicting || slices.Contains(pr.Labels, needsRebaseLabel) {
+		pr.Staleness = StalenessNeedsRebase
+		return
+	}
+	if threshold := cfg.Threshold(pr.Draft); threshold > 0 && !pr.UpdatedAt.IsZero() && now.Sub(pr.UpdatedAt) > threshold {
+		pr.Staleness = StalenessStale
+	}
+}
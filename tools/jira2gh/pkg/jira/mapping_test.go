@@ -0,0 +1,280 @@
+package jira
+
+import (
+	"jira2gh/pkg/config"
+	"jira2gh/pkg/provider"
+	"maps"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestFieldValues(t *testing.T) {
+	pr := PR{
+		URL:            "https://github.com/o/r/pull/7",
+		Title:          "OCPBUGS-1: fix it",
+		Author:         "alice",
+		State:          "OPEN",
+		JiraIssue:      "OCPBUGS-1",
+		JiraEpic:       "EPIC-1",
+		JiraStatus:     "Code Review",
+		JiraAssignee:   "bob",
+		JiraFixVersion: "4.19",
+		JiraExtra:      map[string]string{"customfield_10020": "Team A"},
+		JobSummary:     "2/2 required jobs passed",
+		FailedJobs:     []provider.Job{{Name: "unit", Retests: 1}},
+	}
+
+	tests := []struct {
+		name   string
+		fields []config.FieldMapping
+		want   map[string]string
+	}{
+		{
+			name: "default mappings leave empty values out",
+			want: map[string]string{
+				"Jira Epic":     "EPIC-1",
+				"Jira Issue":    "OCPBUGS-1",
+				"Jira Status":   "Code Review",
+				"Jira Assignee": "bob",
+				"Fix Version":   "4.19",
+				"PR Author":     "alice",
+				"Job Summary":   "2/2 required jobs passed",
+				"Failed Jobs":   "unit (1 retest)",
+			},
+		},
+		{
+			name: "configured mappings replace the default ones",
+			fields: []config.FieldMapping{
+				{Field: "Repository", Source: "pr.repo"},
+				{Field: "Number", Source: "pr.number"},
+				{Field: "Team", Source: "jira.field:customfield_10020"},
+				{Field: "Draft", Source: "pr.draft"},
+				{Field: "Sprint", Source: "jira.sprint"},
+			},
+			want: map[string]string{"Repository": "o/r", "Number": "7", "Team": "Team A", "Draft": "false"},
+		},
+		{
+			name: "values are transformed and unlisted ones written unchanged",
+			fields: []config.FieldMapping{
+				{Field: "Status", Source: "jira.status", Values: map[string]string{"New": "Todo", "Code Review": "In Review"}},
+				{Field: "State", Source: "pr.state", Values: map[string]string{"MERGED": "Done"}},
+			},
+			want: map[string]string{"Status": "In Review", "State": "OPEN"},
+		},
+		{
+			name: "the empty key sets a value for empty sources",
+			fields: []config.FieldMapping{
+				{Field: "Priority", Source: "jira.priority", Values: map[string]string{"": "Undefined"}},
+				{Field: "Assignee", Source: "jira.assignee", Values: map[string]string{"": "nobody"}},
+			},
+			want: map[string]string{"Priority": "Undefined", "Assignee": "bob"},
+		},
+		{
+			name: "values may be mapped to empty",
+			fields: []config.FieldMapping{
+				{Field: "Status", Source: "jira.status", Values: map[string]string{"Code Review": ""}},
+			},
+			want: map[string]string{},
+		},
+		{
+			name: "several fields from one source",
+			fields: []config.FieldMapping{
+				{Field: "Issue", Source: "jira.issue"},
+				{Field: "Issue Copy", Source: "jira.issue"},
+			},
+			want: map[string]string{"Issue": "OCPBUGS-1", "Issue Copy": "OCPBUGS-1"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, transitions := pr.FieldValues(&config.ProjectConfig{Fields: tt.fields})
+			if !maps.Equal(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+			if len(transitions) > 0 {
+				t.Errorf("got transitions %v without rules", transitions)
+			}
+		})
+	}
+}
+
+func TestEvalRules(t *testing.T) {
+	merged := PR{State: "MERGED", JiraStatus: "Verified", JiraAssignee: "bob"}
+	// Status is mapped from the Jira status, so rules override a mapped value
+	fields := []config.FieldMapping{{Field: "Status", Source: "jira.status"}}
+	done := config.Rule{Name: "done", When: map[string]config.RuleValues{"pr.state": {"MERGED"}}, Set: map[string]string{"Status": "Done"}}
+
+	tests := []struct {
+		name            string
+		pr              PR
+		rules           []config.Rule
+		wantTransitions []Transition
+		wantValues      map[string]string
+	}{
+		{
+			name:       "no rules",
+			pr:         merged,
+			wantValues: map[string]string{"Status": "Verified"},
+		},
+		{
+			name:            "matching rule overrides the mapping",
+			pr:              merged,
+			rules:           []config.Rule{done},
+			wantTransitions: []Transition{{Field: "Status", Value: "Done", Rule: "done"}},
+			wantValues:      map[string]string{"Status": "Done"},
+		},
+		{
+			name:       "rule not matching",
+			pr:         PR{State: "OPEN", JiraStatus: "New"},
+			rules:      []config.Rule{done},
+			wantValues: map[string]string{"Status": "New"},
+		},
+		{
+			name: "all conditions must match",
+			pr:   merged,
+			rules: []config.Rule{{
+				When: map[string]config.RuleValues{"pr.state": {"MERGED"}, "jira.status": {"Closed"}},
+				Set:  map[string]string{"Status": "Done"},
+			}},
+			wantValues: map[string]string{"Status": "Verified"},
+		},
+		{
+			name: "values match case-insensitively and any of several",
+			pr:   merged,
+			rules: []config.Rule{{
+				When: map[string]config.RuleValues{"pr.state": {"merged"}, "jira.status": {"closed", "verified"}},
+				Set:  map[string]string{"Status": "Done"},
+			}},
+			wantTransitions: []Transition{{Field: "Status", Value: "Done", Rule: "when jira.status=closed|verified, pr.state=merged"}},
+			wantValues:      map[string]string{"Status": "Done"},
+		},
+		{
+			name: "empty value matches an empty source",
+			pr:   PR{State: "OPEN", JiraStatus: "New"},
+			rules: []config.Rule{{
+				Name: "unassigned",
+				When: map[string]config.RuleValues{"jira.assignee": {""}},
+				Set:  map[string]string{"Triage": "Needed"},
+			}},
+			wantTransitions: []Transition{{Field: "Triage", Value: "Needed", Rule: "unassigned"}},
+			wantValues:      map[string]string{"Status": "New", "Triage": "Needed"},
+		},
+		{
+			name: "first matching rule wins per field",
+			pr:   merged,
+			rules: []config.Rule{
+				{Name: "not this", When: map[string]config.RuleValues{"pr.state": {"OPEN"}}, Set: map[string]string{"Status": "In Progress"}},
+				done,
+				{Name: "verified", When: map[string]config.RuleValues{"jira.status": {"Verified"}}, Set: map[string]string{"Status": "Verified", "QE": "Done"}},
+			},
+			wantTransitions: []Transition{
+				{Field: "Status", Value: "Done", Rule: "done"},
+				{Field: "QE", Value: "Done", Rule: "verified"},
+			},
+			wantValues: map[string]string{"Status": "Done", "QE": "Done"},
+		},
+		{
+			name: "fields set by a rule in name order",
+			pr:   merged,
+			rules: []config.Rule{{
+				Name: "merged",
+				When: map[string]config.RuleValues{"pr.state": {"MERGED"}},
+				Set:  map[string]string{"Status": "Done", "Iteration": "", "Docs": "Needed"},
+			}},
+			wantTransitions: []Transition{
+				{Field: "Docs", Value: "Needed", Rule: "merged"},
+				{Field: "Iteration", Value: "", Rule: "merged"},
+				{Field: "Status", Value: "Done", Rule: "merged"},
+			},
+			wantValues: map[string]string{"Status": "Done", "Iteration": "", "Docs": "Needed"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.pr.EvalRules(tt.rules); !slices.Equal(got, tt.wantTransitions) {
+				t.Errorf("got transitions %v, want %v", got, tt.wantTransitions)
+			}
+			values, transitions := tt.pr.FieldValues(&config.ProjectConfig{Fields: fields, Rules: tt.rules})
+			if !maps.Equal(values, tt.wantValues) {
+				t.Errorf("got values %v, want %v", values, tt.wantValues)
+			}
+			if !slices.Equal(transitions, tt.wantTransitions) {
+				t.Errorf("got field value transitions %v, want %v", transitions, tt.wantTransitions)
+			}
+		})
+	}
+}
+
+func TestSetStaleness(t *testing.T) {
+	now := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	days := func(n int) time.Duration { return time.Duration(n) * 24 * time.Hour }
+	duration := func(d time.Duration) *time.Duration { return &d }
+
+	tests := []struct {
+		name string
+		pr   PR
+		cfg  config.StalenessConfig
+		want string
+	}{
+		{
+			name: "recent",
+			pr:   PR{State: "OPEN", UpdatedAt: now.Add(-days(13))},
+		},
+		{
+			name: "stale by default",
+			pr:   PR{State: "OPEN", UpdatedAt: now.Add(-days(15))},
+			want: StalenessStale,
+		},
+		{
+			name: "stale by config",
+			pr:   PR{State: "OPEN", UpdatedAt: now.Add(-days(4))},
+			cfg:  config.StalenessConfig{StaleAfter: duration(days(3))},
+			want: StalenessStale,
+		},
+		{
+			name: "disabled",
+			pr:   PR{State: "OPEN", UpdatedAt: now.Add(-days(100))},
+			cfg:  config.StalenessConfig{StaleAfter: duration(0)},
+		},
+		{
+			name: "drafts are never stale by default",
+			pr:   PR{State: "OPEN", Draft: true, UpdatedAt: now.Add(-days(100))},
+		},
+		{
+			name: "stale draft",
+			pr:   PR{State: "OPEN", Draft: true, UpdatedAt: now.Add(-days(31))},
+			cfg:  config.StalenessConfig{DraftStaleAfter: days(30)},
+			want: StalenessStale,
+		},
+		{
+			name: "unknown activity",
+			pr:   PR{State: "OPEN"},
+		},
+		{
+			name: "merge conflict",
+			pr:   PR{State: "OPEN", Mergeable: provider.Conflicting, UpdatedAt: now.Add(-days(100))},
+			want: StalenessNeedsRebase,
+		},
+		{
+			name: "needs rebase label",
+			pr:   PR{State: "OPEN", Labels: []string{"lgtm", "needs-rebase"}, UpdatedAt: now},
+			want: StalenessNeedsRebase,
+		},
+		{
+			name: "merged",
+			pr:   PR{State: "MERGED", Staleness: StalenessStale, Mergeable: provider.Conflicting, UpdatedAt: now.Add(-days(100))},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.pr.SetStaleness(tt.cfg, now)
+			if tt.pr.Staleness != tt.want {
+				t.Errorf("got %q, want %q", tt.pr.Staleness, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,254 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Kind identifies the system hosting a change request.
+type Kind string
+
+const (
+	GitHub Kind = "github"
+	GitLab Kind = "gitlab"
+)
+
+// Ref identifies a change request, i.e. a GitHub PR or a GitLab MR.
+type Ref struct {
+	Kind Kind
+	Host string
+	// Repo is owner/repo on GitHub and the full project path on GitLab
+	Repo   string
+	Number string
+	URL    string
+}
+
+// Short formats the change request as owner/repo#123 for GitHub PRs and
+// group/project!123 for GitLab MRs.
+func (r Ref) Short() string {
+	if r.Kind == GitLab {
+		return r.Repo + "!" + r.Number
+	}
+	return r.Repo + "#" + r.Number
+}
+
+// Parse recognises GitHub PR and GitLab MR URLs, e.g.
+// https://github.com/owner/repo/pull/123 and
+// https://gitlab.com/group/project/-/merge_requests/123.
+func Parse(rawURL string) (Ref, bool) {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Host == "" {
+		return Ref{}, false
+	}
+	parts := strings.Split(strings.Trim(u.Path, "/"), "/")
+
+	if u.Host == "github.com" {
+		if len(parts) >= 4 && parts[2] == "pull" && parts[3] != "" {
+			return Ref{
+				Kind:   GitHub,
+				Host:   u.Host,
+				Repo:   parts[0] + "/" + parts[1],
+				Number: parts[3],
+				URL:    rawURL,
+			}, true
+		}
+		return Ref{}, false
+	}
+
+	// GitLab can be self-hosted, so go by the path rather than the host
+	for i := 1; i+2 < len(parts); i++ {
+		if parts[i] == "-" && parts[i+1] == "merge_requests" && parts[i+2] != "" {
+			return Ref{
+				Kind:   GitLab,
+				Host:   u.Host,
+				Repo:   strings.Join(parts[:i], "/"),
+				Number: parts[i+2],
+				URL:    rawURL,
+			}, true
+		}
+	}
+
+	return Ref{}, false
+}
+
+// Short formats a change request URL as owner/repo#123 or group/project!123,
+// or returns the URL unchanged if it is not recognised.
+func Short(rawURL string) string {
+	if ref, ok := Parse(rawURL); ok {
+		return ref.Short()
+	}
+	return rawURL
+}
+
+// Details is what a provider reports about a single change request. States
+// are normalised to GitHub's OPEN, MERGED and CLOSED.
+type Details struct {
+	Title      string
+	Author     string
+	State      string
+	JobSummary string
+	// Checks is the overall state of the required checks, one of the Checks*
+	// constants or empty if there are none
+	Checks string
+	// FailedJobs are the required jobs that failed, by name, and Retests how
+	// often all failed jobs were asked to be rerun at once, e.g. with /retest
+	FailedJobs []Job
+	Retests    int
+	// Commit is the head commit the jobs ran on, and JobResults the state of
+	// each required job on it, one of the Checks* constants
+	Commit     string
+	JobResults map[string]string
+	// Mergeable is MERGEABLE, CONFLICTING or UNKNOWN while it is being
+	// computed
+	Mergeable string
+	Draft     bool
+	UpdatedAt time.Time
+	Labels    []string
+	Review    Review
+	Err       error
+}
+
+// Job is a CI job of a change request.
+type Job struct {
+	Name string
+	// URL links to the job's logs, e.g. on Prow
+	URL string
+	// Retests is how often the job was asked to be rerun by name
+	Retests int
+}
+
+func (j Job) String() string {
+	s := j.Name
+	switch j.Retests {
+	case 0:
+	case 1:
+		s += " (1 retest)"
+	default:
+		s += fmt.Sprintf(" (%d retests)", j.Retests)
+	}
+	if j.URL != "" {
+		s += " " + j.URL
+	}
+	return s
+}
+
+// FormatJobs renders jobs as e.g. "e2e-aws (2 retests) https://..., unit
+// https://...; 3 retests of the PR", where the PR-wide retests rerun all of
+// them and are not counted per job.
+func FormatJobs(jobs []Job, retests int) string {
+	parts := make([]string, len(jobs))
+	for i, j := range jobs {
+		parts[i] = j.String()
+	}
+	s := strings.Join(parts, ", ")
+	switch {
+	case len(jobs) == 0 || retests == 0:
+	case retests == 1:
+		s += "; 1 retest of the PR"
+	default:
+		s += fmt.Sprintf("; %d retests of the PR", retests)
+	}
+	return s
+}
+
+// Review is the review status of a change request.
+type Review struct {
+	// Requested are the reviewers whose review is still pending
+	Requested []string
+	// States counts the latest review of each reviewer by state, e.g.
+	// APPROVED or CHANGES_REQUESTED
+	States map[string]int
+	// Approvers are the OWNERS approvers whose approval is still needed
+	Approvers []string
+	// LastRequested is when a review was last requested
+	LastRequested time.Time
+}
+
+// reviewStates are the review states in the order they are summarised.
+var reviewStates = []string{"APPROVED", "CHANGES_REQUESTED", "COMMENTED", "DISMISSED"}
+
+// Summary renders the review as e.g. "1 approved, 1 changes requested,
+// waiting on alice, bob for 3d, needs approval from carol". The wait is
+// given in whole days so that the summary changes at most once a day.
+func (r Review) Summary(now time.Time) string {
+	var parts []string
+	for _, state := range reviewStates {
+		if n := r.States[state]; n > 0 {
+			parts = append(parts, fmt.Sprintf("%d %s", n, strings.ToLower(strings.ReplaceAll(state, "_", " "))))
+		}
+	}
+	if len(r.Requested) > 0 {
+		waiting := "waiting on " + strings.Join(r.Requested, ", ")
+		if !r.LastRequested.IsZero() {
+			waiting += fmt.Sprintf(" for %dd", int(now.Sub(r.LastRequested)/(24*time.Hour)))
+		}
+		parts = append(parts, waiting)
+	}
+	if len(r.Approvers) > 0 {
+		parts = append(parts, "needs approval from "+strings.Join(r.Approvers, ", "))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// Mergeability of a change request.
+const (
+	Mergeable   = "MERGEABLE"
+	Conflicting = "CONFLICTING"
+)
+
+// Overall states of the required checks of a change request.
+const (
+	ChecksPassed  = "passed"
+	ChecksFailed  = "failed"
+	ChecksRunning = "running"
+)
+
+// Provider fetches details for change requests hosted on one kind of system.
+type Provider interface {
+	// FetchDetails returns the details of each of the given change requests,
+	// setting Err for those that could not be fetched.
+	FetchDetails(ctx context.Context, refs []Ref) (map[string]Details, error)
+}
+
+var providers = map[Kind]Provider{}
+
+// Register makes a provider available for change requests of the given kind.
+func Register(kind Kind, p Provider) {
+	providers[kind] = p
+}
+
+// FetchDetails fetches the details of change requests from whichever provider
+// hosts them. URLs that are not recognised have Err set.
+func FetchDetails(ctx context.Context, urls []string) (map[string]Details, error) {
+	details := make(map[string]Details, len(urls))
+	byKind := map[Kind][]Ref{}
+	for _, u := range urls {
+		ref, ok := Parse(u)
+		if !ok {
+			details[u] = Details{Err: fmt.Errorf("unsupported change request URL: %s", u)}
+			continue
+		}
+		byKind[ref.Kind] = append(byKind[ref.Kind], ref)
+	}
+
+	for kind, refs := range byKind {
+		p, found := providers[kind]
+		if !found {
+			for _, ref := range refs {
+				details[ref.URL] = Details{Err: fmt.Errorf("no provider registered for %s", kind)}
+			}
+			continue
+		}
+		kindDetails, err := p.FetchDetails(ctx, refs)
+		if err != nil {
+			return nil, err
+		}
+		maps.Copy(details, kindDetails)
+	}
+
+	return details, nil
+}
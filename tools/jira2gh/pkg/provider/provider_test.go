@@ -0,0 +1,186 @@
+package provider
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name      string
+		url       string
+		want      Ref
+		wantOK    bool
+		wantShort string
+	}{
+		{
+			name:      "GitHub PR",
+			url:       "https://github.com/o/r/pull/1",
+			want:      Ref{Kind: GitHub, Host: "github.com", Repo: "o/r", Number: "1", URL: "https://github.com/o/r/pull/1"},
+			wantOK:    true,
+			wantShort: "o/r#1",
+		},
+		{
+			name:      "GitHub PR tab",
+			url:       "https://github.com/o/r/pull/12/files",
+			want:      Ref{Kind: GitHub, Host: "github.com", Repo: "o/r", Number: "12", URL: "https://github.com/o/r/pull/12/files"},
+			wantOK:    true,
+			wantShort: "o/r#12",
+		},
+		{
+			name:      "GitHub issue",
+			url:       "https://github.com/o/r/issues/1",
+			wantShort: "https://github.com/o/r/issues/1",
+		},
+		{
+			name:      "GitHub PR without a number",
+			url:       "https://github.com/o/r/pull/",
+			wantShort: "https://github.com/o/r/pull/",
+		},
+		{
+			name:      "GitLab MR",
+			url:       "https://gitlab.com/g/p/-/merge_requests/3",
+			want:      Ref{Kind: GitLab, Host: "gitlab.com", Repo: "g/p", Number: "3", URL: "https://gitlab.com/g/p/-/merge_requests/3"},
+			wantOK:    true,
+			wantShort: "g/p!3",
+		},
+		{
+			name:      "self-hosted GitLab MR in a subgroup",
+			url:       "https://gitlab.example.com/g/sub/p/-/merge_requests/42/diffs",
+			want:      Ref{Kind: GitLab, Host: "gitlab.example.com", Repo: "g/sub/p", Number: "42", URL: "https://gitlab.example.com/g/sub/p/-/merge_requests/42/diffs"},
+			wantOK:    true,
+			wantShort: "g/sub/p!42",
+		},
+		{
+			name:      "GitLab issue",
+			url:       "https://gitlab.com/g/p/-/issues/3",
+			wantShort: "https://gitlab.com/g/p/-/issues/3",
+		},
+		{
+			name:      "GitLab MR without a project",
+			url:       "https://gitlab.com/-/merge_requests/3",
+			wantShort: "https://gitlab.com/-/merge_requests/3",
+		},
+		{
+			name:      "not a URL",
+			url:       "o/r#1",
+			wantShort: "o/r#1",
+		},
+		{
+			name:      "unparsable",
+			url:       "https://github.com/o/r/pull/1%zz",
+			wantShort: "https://github.com/o/r/pull/1%zz",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := Parse(tt.url)
+			if got != tt.want || ok != tt.wantOK {
+				t.Errorf("got %+v, %t, want %+v, %t", got, ok, tt.want, tt.wantOK)
+			}
+			if short := Short(tt.url); short != tt.wantShort {
+				t.Errorf("got short form %q, want %q", short, tt.wantShort)
+			}
+		})
+	}
+}
+
+func TestFormatJobs(t *testing.T) {
+	tests := []struct {
+		name    string
+		jobs    []Job
+		retests int
+		want    string
+	}{
+		{
+			name: "no jobs",
+		},
+		{
+			name:    "no jobs with retests",
+			retests: 2,
+		},
+		{
+			name: "jobs",
+			jobs: []Job{{Name: "e2e-aws", URL: "https://prow/e2e-aws"}, {Name: "unit"}},
+			want: "e2e-aws https://prow/e2e-aws, unit",
+		},
+		{
+			name: "retests by name",
+			jobs: []Job{{Name: "e2e-aws", Retests: 1}, {Name: "unit", URL: "https://prow/unit", Retests: 2}},
+			want: "e2e-aws (1 retest), unit (2 retests) https://prow/unit",
+		},
+		{
+			name:    "one retest of the PR",
+			jobs:    []Job{{Name: "unit"}},
+			retests: 1,
+			want:    "unit; 1 retest of the PR",
+		},
+		{
+			name:    "retests of the PR",
+			jobs:    []Job{{Name: "e2e-aws", Retests: 1}, {Name: "unit"}},
+			retests: 3,
+			want:    "e2e-aws (1 retest), unit; 3 retests of the PR",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := FormatJobs(tt.jobs, tt.retests); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReviewSummary(t *testing.T) {
+	now := time.Date(2024, 3, 10, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name   string
+		review Review
+		want   string
+	}{
+		{
+			name: "no review",
+		},
+		{
+			name:   "states in a fixed order",
+			review: Review{States: map[string]int{"COMMENTED": 2, "APPROVED": 1, "CHANGES_REQUESTED": 1}},
+			want:   "1 approved, 1 changes requested, 2 commented",
+		},
+		{
+			name:   "waiting on reviewers",
+			review: Review{Requested: []string{"alice", "bob"}},
+			want:   "waiting on alice, bob",
+		},
+		{
+			name:   "waiting in whole days",
+			review: Review{Requested: []string{"alice"}, LastRequested: now.Add(-(3*24 + 23) * time.Hour)},
+			want:   "waiting on alice for 3d",
+		},
+		{
+			name:   "needs approval",
+			review: Review{Approvers: []string{"carol"}},
+			want:   "needs approval from carol",
+		},
+		{
+			name: "everything",
+			review: Review{
+				States:        map[string]int{"APPROVED": 1},
+				Requested:     []string{"alice"},
+				LastRequested: now.Add(-24 * time.Hour),
+				Approvers:     []string{"carol", "dave"},
+			},
+			want: "1 approved, waiting on alice for 1d, needs approval from carol, dave",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.review.Summary(now); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,238 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"jira2gh/pkg/config"
+	"jira2gh/pkg/jira"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+)
+
+var planCmd = &cobra.Command{
+	Use:   "plan [<issue-id>...]",
+	Short: "Save the changes a sync would make, to review them before jira2gh apply",
+	Long: `Works out the PRs to add and remove and the field values to update for
+every project, like a regular sync, and writes them to a plan file instead of
+applying them. The plan is json unless the file name ends in .yaml or .yml.
+Run jira2gh apply with the file to make exactly these changes.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		ctx := context.Background()
+		cfg := loadConfig(ctx, cmd, args)
+
+		path, _ := cmd.Flags().GetString("output")
+		toStdout := path == "" || path == "-"
+		if toStdout {
+			// Keep stdout clean for the plan
+			config.Quiet = true
+		}
+
+		if err := savePlans(ctx, cfg, path, toStdout); err != nil {
+			// Errors still go to stderr when stdout was silenced for the plan
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(StatusCodeError)
+		}
+	},
+}
+
+func init() {
+	planCmd.Flags().StringP("output", "o", "", "File to write the plan to (default stdout)")
+	rootCmd.AddCommand(planCmd)
+}
+
+// savePlans writes the sync plans of all projects to path, or to stdout.
+func savePlans(ctx context.Context, cfg *config.NewConfig, path string, toStdout bool) error {
+	plans, err := collectPlans(ctx, cfg)
+	if err != nil {
+		return err
+	}
+
+	if toStdout {
+		return writePlans(os.Stdout, "json", plans)
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("failed to create plan file: %w", err)
+	}
+	if err := writePlans(f, planFormat(path), plans); err != nil {
+		f.Close()
+		return fmt.Errorf("failed to write plan file: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("failed to write plan file: %w", err)
+	}
+
+	config.Println("")
+	for _, plan := range plans {
+		config.Printf("%s/%s: %d to add, %d to remove, %d field updates\n",
+			plan.Owner, plan.Project, len(plan.Add), len(plan.Remove), len(plan.Updates))
+	}
+	config.Printf("\nSaved plan to %s, run 'jira2gh apply %s' to apply it.\n", path, path)
+	return nil
+}
+
+// collectPlans works out the sync plans of all projects without applying
+// them.
+func collectPlans(ctx context.Context, cfg *config.NewConfig) ([]projectPlan, error) {
+	var plans []projectPlan
+	for i, proj := range cfg.Projects {
+		if i > 0 {
+			config.Println("")
+		}
+		plan, err := planSync(ctx, cfg.Jira, proj)
+		if err != nil {
+			return nil, err
+		}
+		plans = append(plans, plan.output(proj))
+	}
+	return plans, nil
+}
+
+// projectPlan is the machine-readable form of a project's sync plan.
+type projectPlan struct {
+	Owner   string `json:"owner" yaml:"owner"`
+	Project string `json:"project" yaml:"project"`
+	// ProjectID is the node ID of the project the plan was made for
+	ProjectID string        `json:"project_id" yaml:"project_id"`
+	Add       []plannedPR   `json:"add" yaml:"add"`
+	Remove    []plannedPR   `json:"remove" yaml:"remove"`
+	Updates   []fieldChange `json:"updates" yaml:"updates"`
+}
+
+// plannedPR is a PR to add to or remove from a project.
+type plannedPR struct {
+	URL         string `json:"url" yaml:"url"`
+	Title       string `json:"title" yaml:"title"`
+	Author      string `json:"author" yaml:"author"`
+	State       string `json:"state" yaml:"state"`
+	JobSummary  string `json:"job_summary,omitempty" yaml:"job_summary,omitempty"`
+	JiraIssue   string `json:"jira_issue,omitempty" yaml:"jira_issue,omitempty"`
+	JiraEpic    string `json:"jira_epic,omitempty" yaml:"jira_epic,omitempty"`
+	JiraFeature string `json:"jira_feature,omitempty" yaml:"jira_feature,omitempty"`
+	// JiraRoot is the tracked issue the PR is or was found under
+	JiraRoot string `json:"jira_root,omitempty" yaml:"jira_root,omitempty"`
+	// Path and Via are formatted as in the human-readable output
+	Path string `json:"path,omitempty" yaml:"path,omitempty"`
+	Via  string `json:"via,omitempty" yaml:"via,omitempty"`
+	// Fields are the project field values a new PR is added with, and the
+	// current ones of a PR to remove
+	Fields map[string]string `json:"fields,omitempty" yaml:"fields,omitempty"`
+	// ItemID is only set for PRs to remove
+	ItemID string `json:"item_id,omitempty" yaml:"item_id,omitempty"`
+	Reason string `json:"reason,omitempty" yaml:"reason,omitempty"`
+}
+
+// output converts the plan to its machine-readable form.
+func (p *syncPlan) output(proj *config.ProjectConfig) projectPlan {
+	out := projectPlan{
+		Owner:     proj.GitHubOwner,
+		Project:   proj.GitHubProject,
+		ProjectID: proj.GitHubProjectID,
+		Add:       []plannedPR{},
+		Remove:    []plannedPR{},
+		Updates:   p.changes,
+	}
+	if out.Updates == nil {
+		out.Updates = []fieldChange{}
+	}
+
+	for _, pr := range p.add {
+		planned := newPlannedPR(pr)
+		planned.Fields, _ = pr.FieldValues(proj)
+		planned.Reason = fmt.Sprintf("linked from %s under %s", pr.JiraIssue, pr.JiraRoot)
+		out.Add = append(out.Add, planned)
+	}
+	for _, pr := range p.remove {
+		planned := newPlannedPR(pr)
+		planned.Fields = pr.Fields
+		planned.ItemID = pr.ItemID
+		planned.Reason = fmt.Sprintf("no longer linked from any issue under %s", pr.JiraRoot)
+		out.Remove = append(out.Remove, planned)
+	}
+
+	byURL := func(a, b plannedPR) int { return strings.Compare(a.URL, b.URL) }
+	slices.SortFunc(out.Add, byURL)
+	slices.SortFunc(out.Remove, byURL)
+	return out
+}
+
+func newPlannedPR(pr jira.PR) plannedPR {
+	return plannedPR{
+		URL:         pr.URL,
+		Title:       pr.Title,
+		Author:      pr.Author,
+		State:       pr.State,
+		JobSummary:  pr.JobSummary,
+		JiraIssue:   pr.JiraIssue,
+		JiraEpic:    pr.JiraEpic,
+		JiraFeature: pr.JiraFeature,
+		JiraRoot:    pr.JiraRoot,
+		Path:        formatHierarchy(pr.Hierarchy),
+		Via:         formatLinkPath(pr.LinkPath),
+	}
+}
+
+// empty reports whether the plan would not change anything.
+func (p projectPlan) empty() bool {
+	return len(p.Add) == 0 && len(p.Remove) == 0 && len(p.Updates) == 0
+}
+
+// writePlans writes the plans in the given format, json or yaml.
+func writePlans(w io.Writer, format string, plans []projectPlan) error {
+	if plans == nil {
+		plans = []projectPlan{}
+	}
+	switch format {
+	case "json":
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(plans)
+	case "yaml":
+		enc := yaml.NewEncoder(w)
+		enc.SetIndent(2)
+		if err := enc.Encode(plans); err != nil {
+			return err
+		}
+		return enc.Close()
+	default:
+		return fmt.Errorf("unknown output format %q, must be json or yaml", format)
+	}
+}
+
+// planFormat returns the plan file format for a file name, yaml for .yaml
+// and .yml files and json otherwise.
+func planFormat(path string) string {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		return "yaml"
+	default:
+		return "json"
+	}
+}
+
+// readPlans reads a plan file written by writePlans. YAML being a superset
+// of JSON, both formats are read the same way.
+func readPlans(path string) ([]projectPlan, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read plan file: %w", err)
+	}
+	var plans []projectPlan
+	if err := yaml.Unmarshal(data, &plans); err != nil {
+		return nil, fmt.Errorf("failed to parse plan file %s: %w", path, err)
+	}
+	for _, plan := range plans {
+		if plan.Owner == "" || plan.Project == "" {
+			return nil, fmt.Errorf("invalid plan file %s: project without owner or number", path)
+		}
+	}
+	return plans, nil
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"bytes"
+	"jira2gh/pkg/config"
+	"jira2gh/pkg/jira"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestProjectPlanOutput(t *testing.T) {
+	proj := &config.ProjectConfig{
+		GitHubOwner:     "example",
+		GitHubProject:   "7",
+		GitHubProjectID: "PVT_7",
+		Fields:          []config.FieldMapping{{Field: "Jira Status", Source: "jira.status"}},
+	}
+	plan := &syncPlan{
+		add: []jira.PR{
+			{
+				URL: "https://github.com/o/r/pull/2", Title: "Second", JiraIssue: "TASK-2", JiraRoot: "ROOT-1", JiraStatus: "Done",
+				Hierarchy: []jira.HierarchyItem{{Key: "ROOT-1", Type: "Feature"}, {Key: "TASK-2"}},
+			},
+			{
+				URL: "https://github.com/o/r/pull/1", Title: "First", JiraIssue: "TASK-9", JiraRoot: "ROOT-1", JiraStatus: "New",
+				LinkPath: []jira.IssueLink{{From: "TASK-1", Relation: "is blocked by", To: "TASK-9"}},
+			},
+		},
+		remove: []jira.PR{
+			{URL: "https://github.com/o/r/pull/3", ItemID: "PVTI_3", JiraRoot: "ROOT-1", Fields: map[string]string{"Jira Status": "Closed"}},
+		},
+	}
+
+	got := plan.output(proj)
+	want := projectPlan{
+		Owner:     "example",
+		Project:   "7",
+		ProjectID: "PVT_7",
+		Add: []plannedPR{
+			{
+				URL: "https://github.com/o/r/pull/1", Title: "First", JiraIssue: "TASK-9", JiraRoot: "ROOT-1",
+				Via:    "TASK-1 is blocked by TASK-9",
+				Fields: map[string]string{"Jira Status": "New"},
+				Reason: "linked from TASK-9 under ROOT-1",
+			},
+			{
+				URL: "https://github.com/o/r/pull/2", Title: "Second", JiraIssue: "TASK-2", JiraRoot: "ROOT-1",
+				Path:   "ROOT-1 (Feature) → TASK-2",
+				Fields: map[string]string{"Jira Status": "Done"},
+				Reason: "linked from TASK-2 under ROOT-1",
+			},
+		},
+		Remove: []plannedPR{
+			{
+				URL: "https://github.com/o/r/pull/3", JiraRoot: "ROOT-1", ItemID: "PVTI_3",
+				Fields: map[string]string{"Jira Status": "Closed"},
+				Reason: "no longer linked from any issue under ROOT-1",
+			},
+		},
+		Updates: []fieldChange{},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got plan\n%+v\nwant\n%+v", got, want)
+	}
+
+	// An empty plan lists nothing to do rather than nulls
+	var buf bytes.Buffer
+	if err := writePlans(&buf, "json", []projectPlan{(&syncPlan{}).output(proj)}); err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range []string{`"add": []`, `"remove": []`, `"updates": []`} {
+		if !strings.Contains(buf.String(), key) {
+			t.Errorf("empty plan lacks %s:\n%s", key, buf.String())
+		}
+	}
+}
+
+func TestPlanRoundTrip(t *testing.T) {
+	plans := []projectPlan{
+		{
+			Owner:     "example",
+			Project:   "7",
+			ProjectID: "PVT_7",
+			Add: []plannedPR{{
+				URL: "https://github.com/o/r/pull/2", Title: "Fix: quoting \"things\"", Author: "dev", State: "OPEN",
+				JiraIssue: "TASK-2", JiraRoot: "ROOT-1", Path: "ROOT-1 (Feature) → TASK-2",
+				Fields: map[string]string{"Jira Status": "Done", "Note": "yes"},
+				Reason: "linked from TASK-2 under ROOT-1",
+			}},
+			Remove: []plannedPR{{
+				URL: "https://github.com/o/r/pull/3", ItemID: "PVTI_3", JiraRoot: "ROOT-1",
+				Reason: "no longer linked from any issue under ROOT-1",
+			}},
+			Updates: []fieldChange{
+				{URL: "https://github.com/o/r/pull/1", ItemID: "PVTI_1", Field: "Jira Status", Old: "", New: "123"},
+				{URL: "https://github.com/o/r/pull/1", ItemID: "PVTI_1", Field: "Review", Old: "null", New: "Approved", Rule: "approved"},
+			},
+		},
+		{Owner: "example", Project: "8", Add: []plannedPR{}, Remove: []plannedPR{}, Updates: []fieldChange{}},
+	}
+
+	for _, name := range []string{"plan.json", "plan.yaml", "plan.yml"} {
+		t.Run(name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), name)
+			f, err := os.Create(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := writePlans(f, planFormat(path), plans); err != nil {
+				t.Fatal(err)
+			}
+			if err := f.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := readPlans(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, plans) {
+				t.Errorf("got plans\n%+v\nwant\n%+v", got, plans)
+			}
+		})
+	}
+}
+
+func TestReadPlansErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		wantErr string
+	}{
+		{name: "not a plan", content: `{"owner": "example"}`, wantErr: "failed to parse plan file"},
+		{name: "no owner", content: `[{"project": "7"}]`, wantErr: "project without owner or number"},
+		{name: "no project", content: "- owner: example\n", wantErr: "project without owner or number"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "plan.json")
+			if err := os.WriteFile(path, []byte(tt.content), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			_, err := readPlans(path)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("got error %v, want it to contain %q", err, tt.wantErr)
+			}
+		})
+	}
+
+	if err := writePlans(&bytes.Buffer{}, "toml", nil); err == nil {
+		t.Error("writing an unknown format succeeded")
+	}
+}
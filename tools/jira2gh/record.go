@@ -0,0 +1,125 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"jira2gh/pkg/httpclient"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// recordedConfig is the name of the config file copied into a recording. It
+// does not end in .yaml, which is ignored by git, so that recordings can be
+// committed as test fixtures.
+const recordedConfig = "config.yml"
+
+// recordedTime is the name of the file holding the time a recording was
+// made at.
+const recordedTime = "recorded_at"
+
+// replayToken stands in for tokens that are not set when replaying, since
+// no request reaches a server.
+const replayToken = "replay"
+
+// backendConfigured is set once --record or --replay took effect, so that
+// reloading the config does not start over.
+var backendConfigured bool
+
+// clock returns the current time. Replays set it to the time of the
+// recording, so that ages such as staleness come out as they did then.
+var clock = time.Now
+
+// configureBackend sends all Jira, GitHub and GitLab requests through a
+// recorder or a replayer as asked by --record and --replay. It reports
+// whether a recording is replayed.
+func configureBackend(cmd *cobra.Command) (bool, error) {
+	recordDir, _ := cmd.Flags().GetString("record")
+	replayDir, _ := cmd.Flags().GetString("replay")
+	if recordDir != "" && replayDir != "" {
+		return false, fmt.Errorf("--record and --replay cannot be used together")
+	}
+	if backendConfigured {
+		return replayDir != "", nil
+	}
+	backendConfigured = true
+
+	switch {
+	case recordDir != "":
+		recorder, err := httpclient.NewRecorder(recordDir)
+		if err != nil {
+			return false, err
+		}
+		at := []byte(time.Now().UTC().Format(time.RFC3339) + "\n")
+		if err := os.WriteFile(filepath.Join(recordDir, recordedTime), at, 0o644); err != nil {
+			return false, fmt.Errorf("failed to record the time: %w", err)
+		}
+		httpclient.SetBackend(recorder)
+	case replayDir != "":
+		replayer, err := httpclient.NewReplayer(replayDir)
+		if err != nil {
+			return false, err
+		}
+		at, err := replayedTime(replayDir)
+		if err != nil {
+			return false, err
+		}
+		if !at.IsZero() {
+			clock = func() time.Time { return at }
+		}
+		httpclient.SetBackend(replayer)
+	}
+	return replayDir != "", nil
+}
+
+// recordConfig copies the config file into the recording, so that replaying
+// it does not need the original one.
+func recordConfig(cmd *cobra.Command, cfgFile string) error {
+	recordDir, _ := cmd.Flags().GetString("record")
+	if recordDir == "" || cfgFile == "" {
+		return nil
+	}
+	data, err := os.ReadFile(cfgFile)
+	if err != nil {
+		return fmt.Errorf("failed to read config file %s: %w", cfgFile, err)
+	}
+	if err := os.WriteFile(filepath.Join(recordDir, recordedConfig), data, 0o600); err != nil {
+		return fmt.Errorf("failed to record config file: %w", err)
+	}
+	return nil
+}
+
+// replayedConfig returns the config file saved in the recording being
+// replayed, if any.
+func replayedConfig(cmd *cobra.Command) string {
+	replayDir, _ := cmd.Flags().GetString("replay")
+	if replayDir == "" {
+		return ""
+	}
+	path := filepath.Join(replayDir, recordedConfig)
+	if _, err := os.Stat(path); err != nil {
+		return ""
+	}
+	return path
+}
+
+// replayedTime returns the time the recording in dir was made at, or the zero
+// time for recordings that do not say.
+func replayedTime(dir string) (time.Time, error) {
+	data, err := os.ReadFile(filepath.Join(dir, recordedTime))
+	if errors.Is(err, fs.ErrNotExist) {
+		return time.Time{}, nil
+	}
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to read the time of the recording: %w", err)
+	}
+	at, err := time.Parse(time.RFC3339, strings.TrimSpace(string(data)))
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid time of the recording in %s: %w", recordedTime, err)
+	}
+	return at, nil
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"jira2gh/pkg/config"
+	"jira2gh/pkg/github"
+	"jira2gh/pkg/httpclient"
+	"jira2gh/pkg/jira"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// TestReplayPlan replays a recorded sync and compares its plan with the one
+// saved next to the recording. The recording was made at a fixed time, which
+// the replay must pick up for anything computed from the current time to come
+// out the same.
+func TestReplayPlan(t *testing.T) {
+	dir := filepath.Join("testdata", "replay", "sync")
+	t.Cleanup(func() {
+		httpclient.SetBackend(httpclient.Network{})
+		backendConfigured = false
+		clock = time.Now
+		config.Quiet = false
+		jira.ResetCache()
+		github.ResetCache()
+		rootCmd.Flags().Set("replay", "")
+		rootCmd.Flags().Set("quiet", "false")
+	})
+	t.Setenv("JIRA_API_TOKEN", "")
+	t.Setenv("GITHUB_TOKEN", "")
+
+	if err := rootCmd.ParseFlags([]string{"--replay", dir, "--quiet"}); err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	cfg, err := buildConfig(ctx, rootCmd, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	plans, err := collectPlans(ctx, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got bytes.Buffer
+	if err := writePlans(&got, "json", plans); err != nil {
+		t.Fatal(err)
+	}
+	want, err := os.ReadFile(filepath.Join(dir, "plan.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got.Bytes(), want) {
+		t.Errorf("replayed plan differs from plan.json:\n%s", got.String())
+	}
+}
@@ -0,0 +1,344 @@
+package main
+
+import (
+	"bufio"
+	"cmp"
+	"fmt"
+	"io"
+	"jira2gh/pkg/config"
+	"jira2gh/pkg/jira"
+	"jira2gh/pkg/provider"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// selectPRs makes the sync prompt for each PR to add or remove instead of
+// for all of them at once, set by --select.
+var selectPRs bool
+
+// PR choices in the selector.
+const (
+	choiceSkip = iota
+	choiceSelected
+	choiceIgnore
+)
+
+const tuiHelp = "↑/↓ move · space toggle · i ignore from now on · a all · n none · enter done · q skip all"
+
+const selectHelp = `  <n>, <n>-<m>, ...  toggle PRs
+  i <n>, ...         ignore PRs from now on (toggle)
+  a / n              select all / none
+  d or Enter         done
+  q                  skip all, ignoring nothing`
+
+// selectableItem is a PR in the selector.
+type selectableItem struct {
+	pr     jira.PR
+	ref    provider.Ref
+	choice int
+}
+
+// pickPRs lets the user toggle the given PRs one by one, grouped by repo,
+// all of them being selected at first. It returns the selected PRs and the
+// ones to ignore from now on. The action is e.g. "add to" or "remove from".
+// On a terminal the PRs are picked with the arrow keys, otherwise by number.
+func pickPRs(in *bufio.Reader, prs []jira.PR, action, jiraHost string) (selected, ignored []jira.PR, err error) {
+	items := make([]*selectableItem, 0, len(prs))
+	for _, pr := range prs {
+		ref, _ := provider.Parse(pr.URL)
+		items = append(items, &selectableItem{pr: pr, ref: ref, choice: choiceSelected})
+	}
+	slices.SortFunc(items, func(a, b *selectableItem) int {
+		numA, _ := strconv.Atoi(a.ref.Number)
+		numB, _ := strconv.Atoi(b.ref.Number)
+		return cmp.Or(strings.Compare(a.ref.Repo, b.ref.Repo), cmp.Compare(numA, numB))
+	})
+
+	done := false
+	if restore, rawErr := makeRaw(); rawErr == nil {
+		done, err = selectOnTerminal(in, items, action, jiraHost, restore)
+	} else {
+		done, err = promptSelection(in, items, action, jiraHost)
+	}
+	if err != nil || !done {
+		return nil, nil, err
+	}
+	for _, item := range items {
+		switch item.choice {
+		case choiceSelected:
+			selected = append(selected, item.pr)
+		case choiceIgnore:
+			ignored = append(ignored, item.pr)
+		}
+	}
+	return selected, ignored, nil
+}
+
+// selectOnTerminal runs the selector full screen on a terminal in raw mode,
+// which restore switches back. It reports whether the selection was
+// confirmed rather than dropped.
+func selectOnTerminal(in *bufio.Reader, items []*selectableItem, action, jiraHost string, restore func()) (bool, error) {
+	fmt.Print("\x1b[?1049h\x1b[?25l")
+	defer func() {
+		fmt.Print("\x1b[?25h\x1b[?1049l")
+		restore()
+	}()
+
+	cursor, offset := 0, 0
+	for {
+		rows, cols := terminalSize()
+		var screen string
+		screen, offset = renderSelection(items, cursor, offset, rows, cols, action, jiraHost)
+		fmt.Print("\x1b[H\x1b[2J" + screen)
+
+		key, err := in.ReadByte()
+		if err != nil {
+			return false, fmt.Errorf("failed to read selection: %w", err)
+		}
+		switch key {
+		case 'q', 3: // Ctrl-C
+			return false, nil
+		case '\r', '\n', 'd':
+			return true, nil
+		case 27: // Esc, or the start of an arrow key
+			if in.Buffered() < 2 {
+				return false, nil
+			}
+			seq := make([]byte, 2)
+			if _, err := io.ReadFull(in, seq); err != nil {
+				return false, fmt.Errorf("failed to read selection: %w", err)
+			}
+			switch string(seq) {
+			case "[A":
+				cursor = max(cursor-1, 0)
+			case "[B":
+				cursor = min(cursor+1, len(items)-1)
+			}
+		case 'k':
+			cursor = max(cursor-1, 0)
+		case 'j':
+			cursor = min(cursor+1, len(items)-1)
+		case ' ', 'x':
+			items[cursor].toggle(choiceSelected)
+		case 'i':
+			items[cursor].toggle(choiceIgnore)
+		case 'a':
+			setChoices(items, choiceSelected)
+		case 'n':
+			setChoices(items, choiceSkip)
+		}
+	}
+}
+
+// renderSelection draws the selector for a terminal of the given size,
+// scrolling the list from offset as little as needed to show the cursor. It
+// returns the screen and the new offset.
+func renderSelection(items []*selectableItem, cursor, offset, rows, cols int, action, jiraHost string) (string, int) {
+	counts := map[int]int{}
+	for _, item := range items {
+		counts[item.choice]++
+	}
+	header := []string{
+		fmt.Sprintf("Select the PRs to %s the project (%d selected, %d to ignore):", action, counts[choiceSelected], counts[choiceIgnore]),
+		"",
+	}
+
+	var list []string
+	// top is the first line to show for the cursor, its repo if it is the
+	// repo's first PR
+	top, cursorLine := 0, 0
+	repo := ""
+	for i, item := range items {
+		if item.ref.Repo != repo || i == 0 {
+			repo = item.ref.Repo
+			list = append(list, "  "+repo)
+		}
+		pointer := " "
+		if i == cursor {
+			pointer, cursorLine, top = ">", len(list), len(list)
+			if item.ref.Repo != items[max(i-1, 0)].ref.Repo || i == 0 {
+				top--
+			}
+		}
+		list = append(list, fmt.Sprintf("  %s %s %s  %s", pointer, item.mark(), strings.TrimPrefix(item.ref.Short(), item.ref.Repo), item.pr.Title))
+	}
+
+	pr := items[cursor].pr
+	footer := []string{"", fmt.Sprintf("  Author: %-20s State: %s", pr.Author, pr.State)}
+	if pr.JiraIssue != "" {
+		footer = append(footer, fmt.Sprintf("  Jira:   %s/browse/%s", jiraHost, pr.JiraIssue))
+	}
+	footer = append(footer, "  Link:   "+pr.URL, "", tuiHelp)
+
+	height := max(rows-len(header)-len(footer), 1)
+	switch {
+	case top < offset:
+		offset = top
+	case cursorLine >= offset+height:
+		offset = cursorLine - height + 1
+	}
+	offset = max(min(offset, len(list)-height), 0)
+	visible := list[offset:min(offset+height, len(list))]
+
+	lines := slices.Concat(header, visible, footer)
+	for i, line := range lines {
+		lines[i] = truncate(line, cols)
+	}
+	return strings.Join(lines, "\r\n"), offset
+}
+
+// truncate cuts a line to the given number of characters.
+func truncate(line string, width int) string {
+	runes := []rune(line)
+	if len(runes) <= width {
+		return line
+	}
+	return string(runes[:max(width-1, 0)]) + "…"
+}
+
+// promptSelection asks for the PRs to toggle by number, for when stdin is not
+// a terminal. It reports whether the selection was confirmed rather than
+// dropped.
+func promptSelection(in *bufio.Reader, items []*selectableItem, action, jiraHost string) (bool, error) {
+	for {
+		displaySelection(items, action, jiraHost)
+		fmt.Print("> ")
+		line, readErr := in.ReadString('\n')
+		if readErr != nil && (readErr != io.EOF || line == "") {
+			return false, fmt.Errorf("failed to read selection: %w", readErr)
+		}
+
+		cmd := strings.TrimSpace(strings.ToLower(line))
+		switch cmd {
+		case "", "d", "done":
+			return true, nil
+		case "q", "quit":
+			return false, nil
+		case "a", "all":
+			setChoices(items, choiceSelected)
+			continue
+		case "n", "none":
+			setChoices(items, choiceSkip)
+			continue
+		case "?", "h", "help":
+			continue
+		}
+
+		target := choiceSelected
+		if rest, found := strings.CutPrefix(cmd, "i "); found {
+			cmd, target = rest, choiceIgnore
+		}
+		indexes, parseErr := parseSelection(cmd, len(items))
+		if parseErr != nil {
+			fmt.Printf("  %v\n", parseErr)
+			continue
+		}
+		for _, i := range indexes {
+			items[i].toggle(target)
+		}
+	}
+}
+
+// toggle sets the choice of the item, or clears it if it was already set.
+func (item *selectableItem) toggle(choice int) {
+	if item.choice == choice {
+		item.choice = choiceSkip
+	} else {
+		item.choice = choice
+	}
+}
+
+// mark renders the choice of the item.
+func (item *selectableItem) mark() string {
+	switch item.choice {
+	case choiceSelected:
+		return "[x]"
+	case choiceIgnore:
+		return "[i]"
+	}
+	return "[ ]"
+}
+
+func setChoices(items []*selectableItem, choice int) {
+	for _, item := range items {
+		item.choice = choice
+	}
+}
+
+// displaySelection prints the PRs with their number and choice, grouped by
+// repo like displayGroupedPRs.
+func displaySelection(items []*selectableItem, action, jiraHost string) {
+	counts := map[int]int{}
+	for _, item := range items {
+		counts[item.choice]++
+	}
+	fmt.Printf("\nSelect the PRs to %s the project (%d selected, %d to ignore):\n",
+		action, counts[choiceSelected], counts[choiceIgnore])
+
+	repo := ""
+	for i, item := range items {
+		if item.ref.Repo != repo || i == 0 {
+			repo = item.ref.Repo
+			fmt.Printf("\n  %s\n", repo)
+		}
+		pr := item.pr
+		fmt.Printf("  %s %3d  %s  %s\n", item.mark(), i+1, strings.TrimPrefix(item.ref.Short(), item.ref.Repo), pr.Title)
+		fmt.Printf("             Author: %-20s State: %s\n", pr.Author, pr.State)
+		if pr.JiraIssue != "" {
+			fmt.Printf("             Jira:   %s/browse/%s\n", jiraHost, pr.JiraIssue)
+		}
+		fmt.Printf("             Link:   %s\n", pr.URL)
+	}
+	fmt.Printf("\n%s\n", selectHelp)
+}
+
+// parseSelection parses PR numbers and ranges such as "1 3,5-7" into
+// indexes.
+func parseSelection(s string, n int) ([]int, error) {
+	var indexes []int
+	for field := range strings.FieldsFuncSeq(s, func(r rune) bool { return r == ',' || r == ' ' }) {
+		from, to, isRange := strings.Cut(field, "-")
+		if !isRange {
+			to = from
+		}
+		first, err := strconv.Atoi(from)
+		if err != nil {
+			return nil, fmt.Errorf("invalid selection %q, type ? for help", field)
+		}
+		last, err := strconv.Atoi(to)
+		if err != nil {
+			return nil, fmt.Errorf("invalid selection %q, type ? for help", field)
+		}
+		if first < 1 || last > n || first > last {
+			return nil, fmt.Errorf("no PR %s, the PRs are numbered 1 to %d", field, n)
+		}
+		for i := first; i <= last; i++ {
+			indexes = append(indexes, i-1)
+		}
+	}
+	return indexes, nil
+}
+
+// ignorePRs adds PRs to the project's ignore_prs, and to the config file if
+// there is one so that they stay ignored.
+func ignorePRs(cfgPath string, proj *config.ProjectConfig, prs []jira.PR) {
+	if len(prs) == 0 {
+		return
+	}
+	refs := make([]string, len(prs))
+	for i, pr := range prs {
+		refs[i] = provider.Short(pr.URL)
+	}
+	proj.IgnorePRs = append(proj.IgnorePRs, refs...)
+
+	if cfgPath == "" {
+		config.Printf("\nNo config file in use, ignoring %s for this run only.\n", strings.Join(refs, ", "))
+		return
+	}
+	if err := config.AddIgnoredPRs(cfgPath, proj, refs); err != nil {
+		config.Printf("Warning: could not save ignored PRs: %v\n", err)
+		return
+	}
+	config.Printf("\nAdded %s to ignore_prs in %s.\n", strings.Join(refs, ", "), cfgPath)
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestParseSelection(t *testing.T) {
+	tests := []struct {
+		input   string
+		n       int
+		want    []int
+		wantErr bool
+	}{
+		{input: "1", n: 3, want: []int{0}},
+		{input: "1 3", n: 3, want: []int{0, 2}},
+		{input: "1,3", n: 3, want: []int{0, 2}},
+		{input: " 1, 3 ", n: 3, want: []int{0, 2}},
+		{input: "2-4", n: 5, want: []int{1, 2, 3}},
+		{input: "1,3-4 2", n: 5, want: []int{0, 2, 3, 1}},
+		{input: "3-3", n: 3, want: []int{2}},
+		{input: "", n: 3, want: nil},
+		{input: "0", n: 3, wantErr: true},
+		{input: "4", n: 3, wantErr: true},
+		{input: "2-4", n: 3, wantErr: true},
+		{input: "3-1", n: 3, wantErr: true},
+		{input: "a", n: 3, wantErr: true},
+		{input: "1-", n: 3, wantErr: true},
+		{input: "-1", n: 3, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			got, err := parseSelection(tt.input, tt.n)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v, want error %v", err, tt.wantErr)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,733 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"jira2gh/pkg/config"
+	"jira2gh/pkg/github"
+	"jira2gh/pkg/jira"
+	"log"
+	"maps"
+	"net/http"
+	"net/http/httputil"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"slices"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+const (
+	// maxPayloadSize is the largest webhook payload accepted, which is what
+	// GitHub caps its deliveries at.
+	maxPayloadSize = 25 << 20
+	// eventQueueSize is the number of events buffered while one is processed.
+	eventQueueSize = 100
+	// itemsTTL is how long the fetched project items are reused across events.
+	itemsTTL = 10 * time.Minute
+	// cacheTTL is how long the Jira issues, remote links and project fields
+	// cached by the sync are reused across events. Only the issue an event
+	// is about is loaded again before then.
+	cacheTTL = 30 * time.Minute
+)
+
+var serveCmd = &cobra.Command{
+	Use:   "serve [<issue-id>...]",
+	Short: "Update the projects from Jira and GitHub webhooks",
+	Long: `Listens for Jira issue and remote link webhooks on /webhook/jira, and for
+GitHub pull_request, check_suite, check_run and status webhooks on
+/webhook/github. Each event only updates the project items it affects; status
+events, which Prow reports its jobs with, are matched to PRs by commit.
+
+Deliveries must carry an HMAC-SHA256 signature made with JIRA_WEBHOOK_SECRET
+or GITHUB_WEBHOOK_SECRET respectively; an endpoint is disabled if its secret
+is not set. New PRs are always added, PRs no longer linked from Jira are only
+removed from projects whose watch_policy is add-remove.
+
+Requests can be saved with --save-events and replayed offline with
+--replay-events, which processes the given files in order and exits. Replayed requests are
+trusted and not verified.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+
+		cfg := loadConfig(ctx, cmd, args)
+		verbose, _ := cmd.Flags().GetBool("verbose")
+		config.Quiet = !verbose
+
+		s := &server{
+			jiraCfg:      cfg.Jira,
+			githubSecret: os.Getenv("GITHUB_WEBHOOK_SECRET"),
+			jiraSecret:   os.Getenv("JIRA_WEBHOOK_SECRET"),
+			logger:       log.New(os.Stdout, "", log.LstdFlags),
+			events:       make(chan webhookEvent, eventQueueSize),
+		}
+		s.saveDir, _ = cmd.Flags().GetString("save-events")
+		for _, proj := range cfg.Projects {
+			s.projects = append(s.projects, &projectState{proj: proj})
+		}
+
+		var err error
+		if files, _ := cmd.Flags().GetStringSlice("replay-events"); len(files) > 0 {
+			err = s.replay(ctx, files)
+		} else {
+			addr, _ := cmd.Flags().GetString("addr")
+			err = s.serve(ctx, addr)
+		}
+		if err != nil {
+			s.logger.Printf("Error: %v", err)
+			os.Exit(StatusCodeError)
+		}
+	},
+}
+
+func init() {
+	serveCmd.Flags().String("addr", ":8080", "Address to listen on")
+	serveCmd.Flags().String("save-events", "", "Directory to save every webhook request to, for use with --replay-events")
+	serveCmd.Flags().StringSlice("replay-events", nil, "Process the given saved webhook requests in order and exit, instead of listening")
+	serveCmd.Flags().BoolP("verbose", "v", false, "Print the full sync output instead of one summary line per event")
+	rootCmd.AddCommand(serveCmd)
+}
+
+type server struct {
+	jiraCfg      *config.JiraConfig
+	projects     []*projectState
+	githubSecret string
+	jiraSecret   string
+	saveDir      string
+	logger       *log.Logger
+	events       chan webhookEvent
+	// replaying processes events right away and trusts them
+	replaying bool
+	// cachedSince is when the Jira and project field caches were last reset
+	cachedSince time.Time
+}
+
+// projectState is what the server knows about a project between events.
+type projectState struct {
+	proj *config.ProjectConfig
+	// items are the project items by URL, as fetched at itemsAt
+	items   map[string]jira.PR
+	itemsAt time.Time
+	// jiraPRs are the PRs linked from Jira as of the last Jira event, nil
+	// until they could be loaded
+	jiraPRs map[string]jira.PR
+	// issues are the Jira issues the project's PRs were found under, along
+	// with its root issues
+	issues map[string]bool
+}
+
+func (ps *projectState) name() string {
+	return ps.proj.GitHubOwner + "/" + ps.proj.GitHubProject
+}
+
+// setJiraPRs stores the PRs linked from Jira and the issues they were found
+// under.
+func (ps *projectState) setJiraPRs(prs map[string]jira.PR) {
+	ps.jiraPRs = prs
+	ps.issues = map[string]bool{}
+	for _, id := range ps.proj.Jiras {
+		ps.issues[id] = true
+	}
+	for _, pr := range prs {
+		for _, item := range pr.Hierarchy {
+			ps.issues[item.Key] = true
+		}
+		for _, link := range pr.LinkPath {
+			ps.issues[link.From] = true
+			ps.issues[link.To] = true
+		}
+	}
+}
+
+// tracks reports whether a change to an issue may affect the project, i.e.
+// whether the issue or one of its ancestors is one the project's PRs were
+// found under. Everything may until the Jira PRs could be loaded.
+func (ps *projectState) tracks(keys []string) bool {
+	return ps.jiraPRs == nil || slices.ContainsFunc(keys, func(key string) bool { return ps.issues[key] })
+}
+
+// webhookEvent is the part of a webhook delivery the sync cares about.
+type webhookEvent struct {
+	// name is the event type, e.g. pull_request or jira:issue_updated
+	name string
+	// prURLs are the PRs a GitHub event is about
+	prURLs []string
+	// issue is the key or ID of the issue a Jira event is about
+	issue string
+	// repo and sha identify the commit a status event is about, whose PRs
+	// are looked up when it is processed
+	repo string
+	sha  string
+}
+
+func (s *server) serve(ctx context.Context, addr string) error {
+	mux := http.NewServeMux()
+	s.routes(mux)
+	srv := &http.Server{Addr: addr, Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		s.work(ctx)
+	}()
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		srv.Shutdown(shutdownCtx)
+	}()
+
+	if s.githubSecret == "" {
+		s.logger.Println("GITHUB_WEBHOOK_SECRET is not set, GitHub webhooks are disabled")
+	}
+	if s.jiraSecret == "" {
+		s.logger.Println("JIRA_WEBHOOK_SECRET is not set, Jira webhooks are disabled")
+	}
+	s.logger.Printf("Listening on %s", addr)
+	if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+
+	<-done
+	s.logger.Println("Shutting down")
+	return nil
+}
+
+// replay feeds saved webhook requests through the handlers one by one.
+func (s *server) replay(ctx context.Context, files []string) error {
+	s.replaying = true
+	mux := http.NewServeMux()
+	s.routes(mux)
+	s.loadBaseline(ctx)
+
+	for _, file := range files {
+		req, err := readSavedRequest(file)
+		if err != nil {
+			return err
+		}
+		resp := &replayResponse{header: http.Header{}}
+		mux.ServeHTTP(resp, req.WithContext(ctx))
+		if resp.code >= http.StatusBadRequest {
+			s.logger.Printf("%s: %d %s", file, resp.code, strings.TrimSpace(resp.body.String()))
+		}
+	}
+	return nil
+}
+
+// replayResponse records the status and body the handlers reply to a
+// replayed request with.
+type replayResponse struct {
+	header http.Header
+	code   int
+	body   bytes.Buffer
+}
+
+func (r *replayResponse) Header() http.Header {
+	return r.header
+}
+
+func (r *replayResponse) WriteHeader(code int) {
+	if r.code == 0 {
+		r.code = code
+	}
+}
+
+func (r *replayResponse) Write(data []byte) (int, error) {
+	r.WriteHeader(http.StatusOK)
+	return r.body.Write(data)
+}
+
+// readSavedRequest reads a webhook request saved with --save-events.
+func readSavedRequest(file string) (*http.Request, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.ReadRequest(bufio.NewReader(bytes.NewReader(data)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse request from %s: %w", file, err)
+	}
+	return req, nil
+}
+
+func (s *server) routes(mux *http.ServeMux) {
+	mux.HandleFunc("POST /webhook/github", s.handleGitHub)
+	mux.HandleFunc("POST /webhook/jira", s.handleJira)
+	mux.HandleFunc("GET /healthz", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+}
+
+func (s *server) handleGitHub(w http.ResponseWriter, r *http.Request) {
+	body, ok := s.readPayload(w, r, s.githubSecret, "X-Hub-Signature-256")
+	if !ok {
+		return
+	}
+	ev, err := parseGitHubEvent(r.Header.Get("X-GitHub-Event"), body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	s.dispatch(w, r, ev)
+}
+
+func (s *server) handleJira(w http.ResponseWriter, r *http.Request) {
+	body, ok := s.readPayload(w, r, s.jiraSecret, "X-Hub-Signature")
+	if !ok {
+		return
+	}
+	ev, err := parseJiraEvent(body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	s.dispatch(w, r, ev)
+}
+
+// readPayload reads the request body, verifies its signature and saves the
+// request if asked to. It writes the error response itself.
+func (s *server) readPayload(w http.ResponseWriter, r *http.Request, secret, signatureHeader string) ([]byte, bool) {
+	if !s.replaying && secret == "" {
+		http.Error(w, "webhook secret not configured", http.StatusForbidden)
+		return nil, false
+	}
+
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxPayloadSize))
+	if err != nil {
+		http.Error(w, "failed to read payload", http.StatusBadRequest)
+		return nil, false
+	}
+	if !s.replaying && !validSignature(secret, body, r.Header.Get(signatureHeader)) {
+		http.Error(w, "invalid signature", http.StatusUnauthorized)
+		return nil, false
+	}
+
+	// Only verified requests are saved, since replaying trusts them
+	if s.saveDir != "" {
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		if err := s.saveRequest(r); err != nil {
+			s.logger.Printf("Failed to save request: %v", err)
+		}
+	}
+	return body, true
+}
+
+// saveRequest writes the raw request to the save directory.
+func (s *server) saveRequest(r *http.Request) error {
+	dump, err := httputil.DumpRequest(r, true)
+	if err != nil {
+		return err
+	}
+	source := strings.TrimPrefix(r.URL.Path, "/webhook/")
+	name := fmt.Sprintf("%d-%s.http", time.Now().UnixNano(), source)
+	return os.WriteFile(filepath.Join(s.saveDir, name), dump, 0o600)
+}
+
+// validSignature checks a "sha256=<hex>" HMAC signature of the body.
+func validSignature(secret string, body []byte, header string) bool {
+	sig, found := strings.CutPrefix(header, "sha256=")
+	if !found {
+		return false
+	}
+	got, err := hex.DecodeString(sig)
+	if err != nil {
+		return false
+	}
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return hmac.Equal(got, mac.Sum(nil))
+}
+
+// dispatch queues an event, or processes it right away when replaying.
+// Events that do not concern any PR or issue are acknowledged and dropped.
+func (s *server) dispatch(w http.ResponseWriter, r *http.Request, ev webhookEvent) {
+	if len(ev.prURLs) == 0 && ev.issue == "" && ev.sha == "" {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	if s.replaying {
+		s.process(r.Context(), ev)
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	select {
+	case s.events <- ev:
+		w.WriteHeader(http.StatusAccepted)
+	default:
+		http.Error(w, "event queue full", http.StatusServiceUnavailable)
+	}
+}
+
+// parseGitHubEvent extracts the PRs a GitHub event is about, or the commit
+// for status events. Other event types, e.g. ping, yield an empty event.
+func parseGitHubEvent(name string, body []byte) (webhookEvent, error) {
+	ev := webhookEvent{name: name}
+
+	type pullRequests []struct {
+		Number int `json:"number"`
+	}
+	var payload struct {
+		PullRequest struct {
+			HTMLURL string `json:"html_url"`
+		} `json:"pull_request"`
+		CheckSuite struct {
+			PullRequests pullRequests `json:"pull_requests"`
+		} `json:"check_suite"`
+		CheckRun struct {
+			PullRequests pullRequests `json:"pull_requests"`
+		} `json:"check_run"`
+		SHA        string `json:"sha"`
+		Repository struct {
+			FullName string `json:"full_name"`
+			HTMLURL  string `json:"html_url"`
+		} `json:"repository"`
+	}
+
+	var prs pullRequests
+	switch name {
+	case "pull_request", "check_suite", "check_run", "status":
+		if err := json.Unmarshal(body, &payload); err != nil {
+			return ev, fmt.Errorf("failed to parse %s payload: %w", name, err)
+		}
+	default:
+		return ev, nil
+	}
+
+	switch name {
+	case "pull_request":
+		if payload.PullRequest.HTMLURL != "" {
+			ev.prURLs = append(ev.prURLs, payload.PullRequest.HTMLURL)
+		}
+	case "check_suite":
+		prs = payload.CheckSuite.PullRequests
+	case "check_run":
+		prs = payload.CheckRun.PullRequests
+	case "status":
+		// Status payloads carry no PRs at all, only the commit
+		ev.repo = payload.Repository.FullName
+		ev.sha = payload.SHA
+	}
+	// Check payloads only carry the numbers of PRs from the same repository
+	for _, pr := range prs {
+		ev.prURLs = append(ev.prURLs, fmt.Sprintf("%s/pull/%d", payload.Repository.HTMLURL, pr.Number))
+	}
+	return ev, nil
+}
+
+// parseJiraEvent extracts the issue a Jira event is about. Issue events carry
+// the issue, remote link events only its ID.
+func parseJiraEvent(body []byte) (webhookEvent, error) {
+	var payload struct {
+		WebhookEvent string `json:"webhookEvent"`
+		Issue        *struct {
+			ID  string `json:"id"`
+			Key string `json:"key"`
+		} `json:"issue"`
+		IssueID         json.RawMessage `json:"issueId"`
+		RemoteIssueLink *struct {
+			IssueID json.RawMessage `json:"issueId"`
+		} `json:"remoteIssueLink"`
+	}
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return webhookEvent{}, fmt.Errorf("failed to parse Jira payload: %w", err)
+	}
+
+	ev := webhookEvent{name: payload.WebhookEvent}
+	switch {
+	case payload.Issue != nil && payload.Issue.Key != "":
+		ev.issue = payload.Issue.Key
+	case payload.Issue != nil && payload.Issue.ID != "":
+		ev.issue = payload.Issue.ID
+	case payload.RemoteIssueLink != nil && len(payload.RemoteIssueLink.IssueID) > 0:
+		ev.issue = strings.Trim(string(payload.RemoteIssueLink.IssueID), `"`)
+	case len(payload.IssueID) > 0:
+		ev.issue = strings.Trim(string(payload.IssueID), `"`)
+	}
+	return ev, nil
+}
+
+// work processes queued events one at a time until ctx is cancelled.
+func (s *server) work(ctx context.Context) {
+	s.loadBaseline(ctx)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case ev := <-s.events:
+			s.process(ctx, ev)
+		}
+	}
+}
+
+// loadBaseline fetches the items and Jira PRs of every project, so that
+// events can be compared against them. Projects that fail are loaded on the
+// next event instead.
+func (s *server) loadBaseline(ctx context.Context) {
+	s.cachedSince = time.Now()
+	for _, ps := range s.projects {
+		if err := ps.refreshItems(ctx); err != nil {
+			s.logger.Printf("%s: failed to load project items: %v", ps.name(), err)
+			continue
+		}
+		jiraPRs, err := extractJiraPRs(ctx, s.jiraCfg, ps.proj)
+		if err != nil {
+			s.logger.Printf("%s: failed to load Jira PRs: %v", ps.name(), err)
+			continue
+		}
+		ps.setJiraPRs(jiraPRs)
+		s.logger.Printf("%s: tracking %d items and %d PRs linked from Jira", ps.name(), len(ps.items), len(jiraPRs))
+	}
+}
+
+func (s *server) process(ctx context.Context, ev webhookEvent) {
+	defer saveJobHistory()
+	if time.Since(s.cachedSince) > cacheTTL {
+		jira.ResetCache()
+		github.ResetCache()
+		s.cachedSince = time.Now()
+	}
+	if ev.issue != "" {
+		if err := s.processIssue(ctx, ev.issue); err != nil {
+			s.logger.Printf("%s %s: %v", ev.name, ev.issue, err)
+		}
+		return
+	}
+	if ev.sha != "" {
+		urls, err := github.CommitPRs(ctx, ev.repo, ev.sha)
+		if err != nil {
+			s.logger.Printf("%s %s@%s: %v", ev.name, ev.repo, ev.sha, err)
+			return
+		}
+		ev.prURLs = append(ev.prURLs, urls...)
+	}
+	if err := s.processPRs(ctx, ev.prURLs); err != nil {
+		s.logger.Printf("%s %s: %v", ev.name, strings.Join(ev.prURLs, ", "), err)
+	}
+}
+
+// refreshItems fetches the project items again once they are older than
+// itemsTTL.
+func (ps *projectState) refreshItems(ctx context.Context) error {
+	if ps.items != nil && time.Since(ps.itemsAt) < itemsTTL {
+		return nil
+	}
+	items, err := github.FetchGitHubPRs(ctx, ps.proj)
+	if err != nil {
+		return err
+	}
+	ps.items = items
+	ps.itemsAt = time.Now()
+	return nil
+}
+
+// processPRs refreshes the fields of the given PRs in every project they are
+// in, e.g. after their checks completed.
+func (s *server) processPRs(ctx context.Context, urls []string) error {
+	for _, ps := range s.projects {
+		if err := ps.refreshItems(ctx); err != nil {
+			return err
+		}
+		prs := map[string]jira.PR{}
+		for _, url := range urls {
+			if pr, found := ps.items[url]; found {
+				if jiraPR, linked := ps.jiraPRs[url]; linked {
+					pr.CopyJira(jiraPR)
+				}
+				prs[url] = pr
+			}
+		}
+		if len(prs) == 0 {
+			continue
+		}
+
+		if err := enrichPRs(ctx, ps.proj, prs); err != nil {
+			return err
+		}
+		updated := updateProjectFields(ctx, ps.proj, prs)
+		s.logger.Printf("%s: %s: %s", ps.name(), summarizePRs(slices.Collect(maps.Values(prs))), updatedSummary(updated))
+	}
+	return nil
+}
+
+// processIssue brings the projects tracking a Jira issue up to date with a
+// change to it: PRs newly linked below it are added, PRs no longer linked are
+// removed according to the watch policy, and the fields of PRs under it are
+// updated. Only the subtree under the issue is walked, and projects that
+// track neither the issue nor its ancestors are not walked at all.
+func (s *server) processIssue(ctx context.Context, idOrKey string) error {
+	jira.Invalidate(idOrKey)
+	key := idOrKey
+	if jiraKeyRE.FindString(idOrKey) != idOrKey {
+		var err error
+		key, err = jira.ResolveKey(ctx, s.jiraCfg, idOrKey)
+		if err != nil {
+			return err
+		}
+		jira.Invalidate(key)
+	}
+
+	for _, ps := range s.projects {
+		ancestors, err := jira.Ancestors(ctx, s.jiraCfg, ps.proj, key)
+		if err != nil {
+			return err
+		}
+		if !ps.tracks(append(ancestors, key)) {
+			continue
+		}
+
+		if err := ps.refreshItems(ctx); err != nil {
+			return err
+		}
+		underIssue, jiraPRs, err := s.issuePRs(ctx, ps, key, ancestors)
+		if err != nil {
+			return err
+		}
+
+		// PRs under the issue, and PRs that were not linked before
+		candidates := map[string]jira.PR{}
+		existing := map[string]jira.PR{}
+		for url, pr := range jiraPRs {
+			_, known := ps.jiraPRs[url]
+			if _, under := underIssue[url]; !under && (known || ps.jiraPRs == nil) {
+				continue
+			}
+			if item, found := ps.items[url]; found {
+				item.CopyJira(pr)
+				existing[url] = item
+			} else {
+				candidates[url] = pr
+			}
+		}
+		if err := enrichPRs(ctx, ps.proj, candidates, existing); err != nil {
+			return err
+		}
+		filterAuthors(ps.proj, candidates)
+
+		// PRs that were linked before but are not anymore
+		vanished := map[string]jira.PR{}
+		for url := range ps.jiraPRs {
+			if _, stillLinked := jiraPRs[url]; !stillLinked {
+				if item, found := ps.items[url]; found {
+					vanished[url] = item
+				}
+			}
+		}
+
+		newPRs, _ := diffPRs(ps.proj, candidates, ps.items)
+		findJiraRoots(ctx, s.jiraCfg, ps.proj, jiraPRs, vanished)
+		_, removedPRs := diffPRs(ps.proj, jiraPRs, vanished)
+
+		var parts []string
+		if len(newPRs) > 0 {
+			if err := github.AddToProject(ctx, ps.proj, newPRs); err != nil {
+				return err
+			}
+			ps.items = nil
+			parts = append(parts, "added "+summarizePRs(newPRs))
+		}
+		if len(removedPRs) > 0 {
+			if ps.proj.WatchPolicy == config.WatchPolicyAddRemove {
+				if err := github.RemoveFromProject(ctx, ps.proj, removedPRs); err != nil {
+					return err
+				}
+				ps.items = nil
+				parts = append(parts, "removed "+summarizePRs(removedPRs))
+			} else {
+				parts = append(parts, "not removing "+summarizePRs(removedPRs)+" (add-only)")
+			}
+		}
+		if updated := updateProjectFields(ctx, ps.proj, existing); updated > 0 {
+			parts = append(parts, updatedSummary(updated))
+		}
+		ps.setJiraPRs(jiraPRs)
+
+		if len(parts) == 0 {
+			parts = append(parts, "no changes")
+		}
+		summary := strings.Join(parts, ", ")
+		if github.DryRun {
+			summary += " (dry-run)"
+		}
+		s.logger.Printf("%s: %s: %s", ps.name(), key, summary)
+	}
+	return nil
+}
+
+// issuePRs returns the PRs linked below an issue and the project's Jira PRs
+// with them merged in. Only the issue's subtree is walked, and only as deep as
+// a walk from its tracked root, the lowest of the project's jiras among its
+// ancestors, reaches. Issues that are not below any of them, e.g. ones tracked
+// through an issue link, and projects whose Jira PRs were never loaded get the
+// whole tree walked instead.
+func (s *server) issuePRs(ctx context.Context, ps *projectState, key string, ancestors []string) (map[string]jira.PR, map[string]jira.PR, error) {
+	// The issue is level levels below its root
+	root, level := "", 0
+	for i, k := range append(ancestors, key) {
+		if slices.Contains(ps.proj.Jiras, k) {
+			root, level = k, len(ancestors)-i
+		}
+	}
+
+	if root == "" || ps.jiraPRs == nil {
+		jiraPRs, err := extractJiraPRs(ctx, s.jiraCfg, ps.proj)
+		if err != nil {
+			return nil, nil, err
+		}
+		underIssue := map[string]jira.PR{}
+		for url, pr := range jiraPRs {
+			if prUnderIssue(pr, key) {
+				underIssue[url] = pr
+			}
+		}
+		return underIssue, jiraPRs, nil
+	}
+
+	underIssue, err := jira.ExtractJiraPRsUnder(ctx, s.jiraCfg, ps.proj, root, key, level)
+	if err != nil {
+		return nil, nil, err
+	}
+	for url := range underIssue {
+		if shouldIgnorePR(url, ps.proj) {
+			delete(underIssue, url)
+		}
+	}
+
+	// PRs that were under the issue before and are not anymore drop out
+	jiraPRs := map[string]jira.PR{}
+	for url, pr := range ps.jiraPRs {
+		if !prUnderIssue(pr, key) {
+			jiraPRs[url] = pr
+		}
+	}
+	maps.Copy(jiraPRs, underIssue)
+	return underIssue, jiraPRs, nil
+}
+
+// prUnderIssue reports whether the issue is the PR's issue, one of its
+// ancestors, or on the link path that brought it in.
+func prUnderIssue(pr jira.PR, key string) bool {
+	if slices.ContainsFunc(pr.Hierarchy, func(item jira.HierarchyItem) bool { return item.Key == key }) {
+		return true
+	}
+	return slices.ContainsFunc(pr.LinkPath, func(link jira.IssueLink) bool { return link.From == key || link.To == key })
+}
+
+func updatedSummary(updated int) string {
+	if updated == 1 {
+		return "1 field value updated"
+	}
+	return fmt.Sprintf("%d field values updated", updated)
+}
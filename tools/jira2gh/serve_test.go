@@ -0,0 +1,332 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"jira2gh/pkg/config"
+	"jira2gh/pkg/httpclient"
+	"jira2gh/pkg/jira"
+	"log"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"testing"
+)
+
+const testSecret = "s3cret"
+
+// newTestServer returns a server that queues events instead of processing
+// them, so that the handlers can be driven without any network.
+func newTestServer() (*server, *http.ServeMux) {
+	s := &server{
+		githubSecret: testSecret,
+		jiraSecret:   testSecret,
+		logger:       log.New(io.Discard, "", 0),
+		events:       make(chan webhookEvent, eventQueueSize),
+	}
+	mux := http.NewServeMux()
+	s.routes(mux)
+	return s, mux
+}
+
+// signedRequest reads a saved webhook request and signs it with secret.
+func signedRequest(t *testing.T, file, secret string) *http.Request {
+	t.Helper()
+	req, err := readSavedRequest(filepath.Join("testdata", "webhooks", file))
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, err := io.ReadAll(req.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	signature := "sha256=" + hex.EncodeToString(mac.Sum(nil))
+	req.Header.Set("X-Hub-Signature-256", signature)
+	req.Header.Set("X-Hub-Signature", signature)
+	req.Body = io.NopCloser(bytes.NewReader(body))
+	req.RequestURI = ""
+	return req
+}
+
+func TestWebhookHandlers(t *testing.T) {
+	tests := []struct {
+		file   string
+		code   int
+		prURLs []string
+		issue  string
+		repo   string
+		sha    string
+	}{
+		{
+			file:   "github-pull_request.http",
+			code:   http.StatusAccepted,
+			prURLs: []string{"https://github.com/openshift/origin/pull/101"},
+		},
+		{
+			file: "github-check_suite.http",
+			code: http.StatusAccepted,
+			prURLs: []string{
+				"https://github.com/openshift/origin/pull/101",
+				"https://github.com/openshift/origin/pull/102",
+			},
+		},
+		{
+			file: "github-status.http",
+			code: http.StatusAccepted,
+			repo: "openshift/origin",
+			sha:  "6dcb09b5b57875f334f61aebed695e2e4193db5e",
+		},
+		{
+			file: "github-ping.http",
+			code: http.StatusNoContent,
+		},
+		{
+			file:  "jira-issue_updated.http",
+			code:  http.StatusAccepted,
+			issue: "OCPBUGS-1234",
+		},
+		{
+			file:  "jira-remote_issue_link_created.http",
+			code:  http.StatusAccepted,
+			issue: "15000001",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.file, func(t *testing.T) {
+			s, mux := newTestServer()
+			rec := httptest.NewRecorder()
+			mux.ServeHTTP(rec, signedRequest(t, tt.file, testSecret))
+			if rec.Code != tt.code {
+				t.Fatalf("got status %d, want %d: %s", rec.Code, tt.code, rec.Body)
+			}
+
+			if tt.code != http.StatusAccepted {
+				if len(s.events) != 0 {
+					t.Fatalf("got %d queued events, want none", len(s.events))
+				}
+				return
+			}
+			if len(s.events) != 1 {
+				t.Fatalf("got %d queued events, want 1", len(s.events))
+			}
+			ev := <-s.events
+			if !slices.Equal(ev.prURLs, tt.prURLs) || ev.issue != tt.issue || ev.repo != tt.repo || ev.sha != tt.sha {
+				t.Errorf("got event %+v, want PRs %v, issue %q, commit %s@%s", ev, tt.prURLs, tt.issue, tt.repo, tt.sha)
+			}
+		})
+	}
+}
+
+func TestWebhookInvalidSignature(t *testing.T) {
+	for _, file := range []string{"github-pull_request.http", "jira-issue_updated.http"} {
+		t.Run(file, func(t *testing.T) {
+			s, mux := newTestServer()
+			rec := httptest.NewRecorder()
+			mux.ServeHTTP(rec, signedRequest(t, file, "wrong"))
+			if rec.Code != http.StatusUnauthorized {
+				t.Fatalf("got status %d, want %d", rec.Code, http.StatusUnauthorized)
+			}
+			if len(s.events) != 0 {
+				t.Fatalf("got %d queued events, want none", len(s.events))
+			}
+		})
+	}
+}
+
+// fakeJiraTree answers Jira searches and remote link requests from a fixed
+// tree of issues, remembering which issues were asked about.
+type fakeJiraTree struct {
+	// parents maps each issue to its parent, "" for top-most ones
+	parents map[string]string
+	links   map[string][]string
+	// requests holds the path of every remote link request and the JQL of
+	// every search
+	requests []string
+}
+
+var jqlInRE = regexp.MustCompile(`^(key|parent) in \(([^)]*)\)`)
+
+func (f *fakeJiraTree) Send(req *http.Request) (*httpclient.Response, error) {
+	if key, found := strings.CutSuffix(strings.TrimPrefix(req.URL.Path, "/rest/api/2/issue/"), "/remotelink"); found {
+		f.requests = append(f.requests, req.URL.Path)
+		var objects []string
+		for _, url := range f.links[key] {
+			objects = append(objects, fmt.Sprintf(`{"object": {"url": %q}}`, url))
+		}
+		return f.respond("[" + strings.Join(objects, ", ") + "]"), nil
+	}
+
+	var search struct {
+		JQL string `json:"jql"`
+	}
+	if req.Body != nil {
+		if err := json.NewDecoder(req.Body).Decode(&search); err != nil {
+			return nil, err
+		}
+	}
+	m := jqlInRE.FindStringSubmatch(search.JQL)
+	if m == nil {
+		return &httpclient.Response{StatusCode: http.StatusNotFound, Header: http.Header{}}, nil
+	}
+	f.requests = append(f.requests, search.JQL)
+	keys := strings.Split(m[2], ", ")
+	var issues []string
+	for _, key := range slices.Sorted(maps.Keys(f.parents)) {
+		if (m[1] == "key" && slices.Contains(keys, key)) || (m[1] == "parent" && slices.Contains(keys, f.parents[key])) {
+			issues = append(issues, fmt.Sprintf(`{"key": %q, "fields": {"issuetype": {"name": "Story"}, "parent": {"key": %q}}}`, key, f.parents[key]))
+		}
+	}
+	return f.respond(`{"issues": [` + strings.Join(issues, ", ") + `]}`), nil
+}
+
+func (f *fakeJiraTree) respond(body string) *httpclient.Response {
+	return &httpclient.Response{StatusCode: http.StatusOK, Header: http.Header{}, Body: []byte(body)}
+}
+
+func TestIssuePRsWalksSubtree(t *testing.T) {
+	fake := &fakeJiraTree{
+		parents: map[string]string{
+			"ROOT-1": "", "EPIC-1": "ROOT-1", "EPIC-2": "ROOT-1",
+			"TASK-1": "EPIC-1", "TASK-2": "EPIC-1", "TASK-3": "EPIC-2",
+		},
+		links: map[string][]string{
+			"TASK-1": {"https://github.com/o/r/pull/1"},
+			"TASK-2": {"https://github.com/o/r/pull/2", "https://github.com/o/r/pull/4"},
+			"TASK-3": {"https://github.com/o/r/pull/3"},
+		},
+	}
+	httpclient.SetBackend(fake)
+	t.Cleanup(func() {
+		httpclient.SetBackend(httpclient.Network{})
+		jira.ResetCache()
+	})
+	jira.ResetCache()
+
+	under := func(url string, keys ...string) jira.PR {
+		pr := jira.PR{URL: url, JiraIssue: keys[len(keys)-1], JiraRoot: "ROOT-1", FromJira: true}
+		for _, key := range keys {
+			pr.Hierarchy = append(pr.Hierarchy, jira.HierarchyItem{Key: key})
+		}
+		return pr
+	}
+	s := &server{jiraCfg: &config.JiraConfig{
+		Host: "https://jira.example.com",
+		Fields: config.JiraFieldsConfig{
+			EpicLink: "customfield_1", ParentLink: "customfield_2", Sprint: "customfield_3", TargetVersion: "customfield_4",
+		},
+	}}
+	ps := &projectState{proj: &config.ProjectConfig{Jiras: []string{"ROOT-1"}, IgnorePRs: []string{"o/r#4"}}}
+	// PR 9 was linked from TASK-2 before, PR 3 sits in the other epic
+	ps.setJiraPRs(map[string]jira.PR{
+		"https://github.com/o/r/pull/1": under("https://github.com/o/r/pull/1", "ROOT-1", "EPIC-1", "TASK-1"),
+		"https://github.com/o/r/pull/3": under("https://github.com/o/r/pull/3", "ROOT-1", "EPIC-2", "TASK-3"),
+		"https://github.com/o/r/pull/9": under("https://github.com/o/r/pull/9", "ROOT-1", "EPIC-1", "TASK-2"),
+	})
+
+	ctx := t.Context()
+	ancestors := []string{"ROOT-1"}
+	underIssue, jiraPRs, err := s.issuePRs(ctx, ps, "EPIC-1", ancestors)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wantUnder := []string{"https://github.com/o/r/pull/1", "https://github.com/o/r/pull/2"}
+	if got := slices.Sorted(maps.Keys(underIssue)); !slices.Equal(got, wantUnder) {
+		t.Errorf("got PRs under the issue %v, want %v", got, wantUnder)
+	}
+	for url, pr := range underIssue {
+		keys := make([]string, len(pr.Hierarchy))
+		for i, item := range pr.Hierarchy {
+			keys[i] = item.Key
+		}
+		if pr.JiraRoot != "ROOT-1" || len(keys) == 0 || keys[0] != "ROOT-1" {
+			t.Errorf("%s: got root %q and hierarchy %v, want them to start at ROOT-1", url, pr.JiraRoot, keys)
+		}
+	}
+	wantAll := []string{"https://github.com/o/r/pull/1", "https://github.com/o/r/pull/2", "https://github.com/o/r/pull/3"}
+	if got := slices.Sorted(maps.Keys(jiraPRs)); !slices.Equal(got, wantAll) {
+		t.Errorf("got Jira PRs %v, want %v", got, wantAll)
+	}
+
+	// Nothing outside the subtree is read again
+	for _, r := range fake.requests {
+		if strings.Contains(r, "EPIC-2") || strings.Contains(r, "TASK-3") {
+			t.Errorf("request outside the subtree: %s", r)
+		}
+	}
+}
+
+func TestIssuePRsStopsAtRootDepth(t *testing.T) {
+	// SUB-1 sits four levels below the tracked ROOT-1, out of reach of the
+	// default depth of three
+	fake := &fakeJiraTree{
+		parents: map[string]string{
+			"ROOT-1": "", "FEAT-1": "ROOT-1", "EPIC-1": "FEAT-1", "TASK-1": "EPIC-1", "SUB-1": "TASK-1",
+		},
+		links: map[string][]string{
+			"TASK-1": {"https://github.com/o/r/pull/1"},
+			"SUB-1":  {"https://github.com/o/r/pull/5"},
+		},
+	}
+	httpclient.SetBackend(fake)
+	t.Cleanup(func() {
+		httpclient.SetBackend(httpclient.Network{})
+		jira.ResetCache()
+	})
+
+	s := &server{jiraCfg: &config.JiraConfig{
+		Host: "https://jira.example.com",
+		Fields: config.JiraFieldsConfig{
+			EpicLink: "customfield_1", ParentLink: "customfield_2", Sprint: "customfield_3", TargetVersion: "customfield_4",
+		},
+	}}
+
+	tests := []struct {
+		key       string
+		ancestors []string
+	}{
+		{key: "FEAT-1", ancestors: []string{"ROOT-1"}},
+		{key: "EPIC-1", ancestors: []string{"ROOT-1", "FEAT-1"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.key, func(t *testing.T) {
+			jira.ResetCache()
+			fake.requests = nil
+			ps := &projectState{proj: &config.ProjectConfig{Jiras: []string{"ROOT-1"}}}
+			ps.setJiraPRs(map[string]jira.PR{})
+
+			underIssue, jiraPRs, err := s.issuePRs(t.Context(), ps, tt.key, tt.ancestors)
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := []string{"https://github.com/o/r/pull/1"}
+			if got := slices.Sorted(maps.Keys(underIssue)); !slices.Equal(got, want) {
+				t.Errorf("got PRs under the issue %v, want %v", got, want)
+			}
+			if got := slices.Sorted(maps.Keys(jiraPRs)); !slices.Equal(got, want) {
+				t.Errorf("got Jira PRs %v, want %v", got, want)
+			}
+			if pr := underIssue[want[0]]; pr.JiraRoot != "ROOT-1" || len(pr.Hierarchy) != 4 || pr.Hierarchy[0].Key != "ROOT-1" {
+				t.Errorf("got root %q and hierarchy %v, want the full path from ROOT-1", pr.JiraRoot, pr.Hierarchy)
+			}
+			for _, r := range fake.requests {
+				if strings.Contains(r, "SUB-1") {
+					t.Errorf("request beyond the root's depth: %s", r)
+				}
+			}
+		})
+	}
+}
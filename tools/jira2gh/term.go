@@ -0,0 +1,33 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"golang.org/x/term"
+)
+
+// makeRaw switches the terminal to raw mode, so that keys are read as they
+// are pressed, and returns a function restoring it. It fails if stdin is not
+// a terminal.
+func makeRaw() (restore func(), err error) {
+	fd := int(os.Stdin.Fd())
+	if !term.IsTerminal(fd) {
+		return nil, fmt.Errorf("stdin is not a terminal")
+	}
+	state, err := term.MakeRaw(fd)
+	if err != nil {
+		return nil, fmt.Errorf("failed to switch the terminal to raw mode: %w", err)
+	}
+	return func() { term.Restore(fd, state) }, nil
+}
+
+// terminalSize returns the number of rows and columns of the terminal, or
+// defaults if they cannot be told.
+func terminalSize() (rows, cols int) {
+	cols, rows, err := term.GetSize(int(os.Stdout.Fd()))
+	if err != nil || rows <= 0 || cols <= 0 {
+		return 24, 80
+	}
+	return rows, cols
+}
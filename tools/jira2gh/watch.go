@@ -0,0 +1,168 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"jira2gh/pkg/config"
+	"jira2gh/pkg/github"
+	"jira2gh/pkg/jira"
+	"log"
+	"os"
+	"os/signal"
+	"slices"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// defaultWatchInterval is the time between two syncs in watch mode.
+const defaultWatchInterval = 15 * time.Minute
+
+var watchCmd = &cobra.Command{
+	Use:   "watch [<issue-id>...]",
+	Short: "Keep the projects in sync, applying changes automatically",
+	Long: `Syncs every project on an interval without prompting. New PRs are always
+added; PRs no longer linked from Jira are only removed from projects whose
+watch_policy is add-remove. The config file is reloaded when it changes, and
+SIGINT or SIGTERM stops it, cancelling any sync in progress.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+
+		cfg := loadConfig(ctx, cmd, args)
+		watch(ctx, cmd, args, cfg)
+	},
+}
+
+func init() {
+	watchCmd.Flags().Duration("interval", defaultWatchInterval, "Time between two syncs (overrides watch.interval from the config)")
+	watchCmd.Flags().BoolP("verbose", "v", false, "Print the full sync output instead of one summary line per project")
+	rootCmd.AddCommand(watchCmd)
+}
+
+// watch syncs all projects every interval until ctx is cancelled.
+func watch(ctx context.Context, cmd *cobra.Command, args []string, cfg *config.NewConfig) {
+	logger := log.New(os.Stdout, "", log.LstdFlags)
+	verbose, _ := cmd.Flags().GetBool("verbose")
+	config.Quiet = !verbose
+
+	modTime := fileModTime(cfg.Path)
+	for {
+		if cfg.Path != "" {
+			if mt := fileModTime(cfg.Path); !mt.Equal(modTime) {
+				modTime = mt
+				newCfg, err := buildConfig(ctx, cmd, args)
+				if err != nil {
+					logger.Printf("Failed to reload %s, keeping the previous config: %v", cfg.Path, err)
+				} else {
+					cfg = newCfg
+					logger.Printf("Reloaded %s", cfg.Path)
+				}
+				config.Quiet = !verbose
+			}
+		}
+
+		// Every cycle must see the current state of Jira and the projects
+		jira.ResetCache()
+		github.ResetCache()
+
+		for _, proj := range cfg.Projects {
+			if ctx.Err() != nil {
+				break
+			}
+			name := proj.GitHubOwner + "/" + proj.GitHubProject
+			summary, err := watchProject(ctx, cfg.Jira, proj)
+			if err != nil {
+				logger.Printf("%s: sync failed: %v", name, err)
+				continue
+			}
+			logger.Printf("%s: %s", name, summary)
+		}
+
+		interval := cfg.Watch.Interval
+		if cmd.Flags().Changed("interval") || interval <= 0 {
+			interval, _ = cmd.Flags().GetDuration("interval")
+		}
+
+		select {
+		case <-ctx.Done():
+			logger.Println("Shutting down")
+			return
+		case <-time.After(interval):
+		}
+	}
+}
+
+// watchProject syncs one project according to its watch policy and returns a
+// one-line summary of what changed.
+func watchProject(ctx context.Context, jiraCfg *config.JiraConfig, proj *config.ProjectConfig) (string, error) {
+	plan, err := planSync(ctx, jiraCfg, proj)
+	if err != nil {
+		return "", err
+	}
+
+	var parts []string
+	if updated := applyFieldChanges(ctx, proj, plan.items, plan.changes); updated > 0 {
+		parts = append(parts, updatedSummary(updated))
+	}
+	saveJobHistory()
+	if len(plan.add) > 0 {
+		if err := github.AddToProject(ctx, proj, plan.add); err != nil {
+			return "", err
+		}
+		parts = append(parts, "added "+summarizePRs(plan.add))
+	}
+	if len(plan.remove) > 0 {
+		if proj.WatchPolicy == config.WatchPolicyAddRemove {
+			if err := github.RemoveFromProject(ctx, proj, plan.remove); err != nil {
+				return "", err
+			}
+			parts = append(parts, "removed "+summarizePRs(plan.remove))
+		} else {
+			parts = append(parts, "not removing "+summarizePRs(plan.remove)+" (add-only)")
+		}
+	}
+
+	if stale := stalePRs(plan.items); len(stale) > 0 {
+		parts = append(parts, fmt.Sprintf("%s stale or needing a rebase", plural(len(stale), "PR")))
+	}
+
+	if len(parts) == 0 {
+		return "no changes", nil
+	}
+	summary := strings.Join(parts, ", ")
+	if github.DryRun {
+		summary += " (dry-run)"
+	}
+	return summary, nil
+}
+
+// summarizePRs renders PRs as e.g. "2 PRs (owner/repo#1, group/project!2)".
+func summarizePRs(prs []jira.PR) string {
+	refs := make([]string, len(prs))
+	for i, pr := range prs {
+		refs[i] = github.FormatPRShort(pr.URL)
+	}
+	slices.Sort(refs)
+
+	prWord := "PRs"
+	if len(prs) == 1 {
+		prWord = "PR"
+	}
+	return fmt.Sprintf("%d %s (%s)", len(prs), prWord, strings.Join(refs, ", "))
+}
+
+// fileModTime returns the modification time of a file, or the zero time if it
+// cannot be read.
+func fileModTime(path string) time.Time {
+	if path == "" {
+		return time.Time{}
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return time.Time{}
+	}
+	return info.ModTime()
+}
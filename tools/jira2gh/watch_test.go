@@ -0,0 +1,127 @@
+package main
+
+import (
+	"context"
+	"io"
+	"jira2gh/pkg/config"
+	"jira2gh/pkg/github"
+	"jira2gh/pkg/httpclient"
+	"jira2gh/pkg/jira"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// replayWithWrites replays the recorded reads of a sync and accepts the
+// writes it leads to, which the recording does not hold, remembering them.
+type replayWithWrites struct {
+	replayer *httpclient.Replayer
+	writes   []string
+}
+
+func (r *replayWithWrites) Send(req *http.Request) (*httpclient.Response, error) {
+	var query string
+	if req.GetBody != nil {
+		body, err := req.GetBody()
+		if err != nil {
+			return nil, err
+		}
+		data, err := io.ReadAll(body)
+		if err != nil {
+			return nil, err
+		}
+		query = string(data)
+	}
+	if !strings.Contains(query, "mutation") && !strings.Contains(query, "resource(url") {
+		return r.replayer.Send(req)
+	}
+	if strings.Contains(query, "mutation") {
+		r.writes = append(r.writes, query)
+	}
+	// The recorded sync adds a single PR, which resolves and is added as
+	// c0 and a0
+	resp := `{"data": {"c0": {"id": "PR_2"}, "a0": {"item": {"id": "PVTI_2"}}}}`
+	return &httpclient.Response{StatusCode: http.StatusOK, Header: http.Header{}, Body: []byte(resp)}, nil
+}
+
+func TestWatchPolicies(t *testing.T) {
+	dir := filepath.Join("testdata", "replay", "sync")
+	t.Cleanup(func() {
+		httpclient.SetBackend(httpclient.Network{})
+		backendConfigured = false
+		clock = time.Now
+		config.Quiet = false
+		jira.ResetCache()
+		github.ResetCache()
+		rootCmd.Flags().Set("replay", "")
+		rootCmd.Flags().Set("quiet", "false")
+	})
+	t.Setenv("JIRA_API_TOKEN", "")
+	t.Setenv("GITHUB_TOKEN", "")
+
+	if err := rootCmd.ParseFlags([]string{"--replay", dir, "--quiet"}); err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	cfg, err := buildConfig(ctx, rootCmd, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		policy      string
+		wantSummary string
+		wantRemoved bool
+	}{
+		{
+			policy:      "",
+			wantSummary: "added 1 PR (example/repo#2), not removing 1 PR (example/repo#3) (add-only)",
+		},
+		{
+			policy:      config.WatchPolicyAddOnly,
+			wantSummary: "added 1 PR (example/repo#2), not removing 1 PR (example/repo#3) (add-only)",
+		},
+		{
+			policy:      config.WatchPolicyAddRemove,
+			wantSummary: "added 1 PR (example/repo#2), removed 1 PR (example/repo#3)",
+			wantRemoved: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.policy, func(t *testing.T) {
+			replayer, err := httpclient.NewReplayer(dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			backend := &replayWithWrites{replayer: replayer}
+			httpclient.SetBackend(backend)
+			jira.ResetCache()
+			github.ResetCache()
+
+			proj := *cfg.Projects[0]
+			proj.WatchPolicy = tt.policy
+			summary, err := watchProject(ctx, cfg.Jira, &proj)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !strings.Contains(summary, tt.wantSummary) {
+				t.Errorf("got summary %q, want it to contain %q", summary, tt.wantSummary)
+			}
+
+			added, removed := false, false
+			for _, w := range backend.writes {
+				added = added || strings.Contains(w, "addProjectV2ItemById")
+				removed = removed || strings.Contains(w, "deleteProjectV2Item") && strings.Contains(w, "PVTI_3")
+			}
+			if !added {
+				t.Errorf("new PR not added: %v", backend.writes)
+			}
+			if removed != tt.wantRemoved {
+				t.Errorf("got PR removed %t, want %t", removed, tt.wantRemoved)
+			}
+		})
+	}
+}